@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"time"
 
 	"github.com/luismesas/goPi/piface"
@@ -8,8 +9,7 @@ import (
 
 //
 type Buzzer struct {
-	pfd  *piface.PiFaceDigital
-	stop bool
+	pfd *piface.PiFaceDigital
 }
 
 //
@@ -19,20 +19,24 @@ func NewBuzzer(pfd *piface.PiFaceDigital) *Buzzer {
 	}
 }
 
-//
-func (b *Buzzer) Watch() {
-	// is somebody sitting on the buzzer?
+// Watch blocks until the buzzer is pressed or ctx is done
+func (b *Buzzer) Watch(ctx context.Context) error {
 	ticker := time.NewTicker(time.Millisecond * 50)
-	for b.pfd.Switches[0].Value() == byte(0) && !b.stop {
-		<-ticker.C
+	defer ticker.Stop()
+	wait := func(pressed bool) error {
+		for (b.pfd.Switches[0].Value() == byte(0)) == pressed {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		return nil
 	}
-	// wait for pressing the buzzer
-	for b.pfd.Switches[0].Value() != byte(0) && !b.stop {
-		<-ticker.C
+	// is somebody sitting on the buzzer?
+	if err := wait(true); err != nil {
+		return err
 	}
-}
-
-//
-func (b *Buzzer) Unwatch() {
-	b.stop = true
+	// wait for pressing the buzzer
+	return wait(false)
 }
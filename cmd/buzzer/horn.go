@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"time"
 
 	"github.com/luismesas/goPi/piface"
+	"github.com/marcsauter/buzzer/pkg/health"
 )
 
 const (
@@ -13,41 +15,50 @@ const (
 
 //
 type Horn struct {
-	pfd     *piface.PiFaceDigital
-	unwatch bool
+	pfd       *piface.PiFaceDigital
+	timer     relayTimer
+	heartbeat *health.Heartbeat
 }
 
 //
 func NewHorn(pfd *piface.PiFaceDigital) *Horn {
 	return &Horn{
-		pfd: pfd,
+		pfd:       pfd,
+		timer:     relayTimer{relay: "horn"},
+		heartbeat: health.NewHeartbeat(5 * time.Second),
 	}
 }
 
 //
 func (h *Horn) On() {
 	h.pfd.Relays[HornRelay].AllOn()
+	h.timer.on()
 }
 
 //
 func (h *Horn) Off() {
 	h.pfd.Relays[HornRelay].AllOff()
+	h.timer.off()
 }
 
-//
-func (h *Horn) WatchButton() {
-	go func() {
-		ticker := time.NewTicker(time.Millisecond * 50)
-		for !h.unwatch {
-			if h.pfd.Switches[HornButton].Value() == byte(0) {
-				h.Off()
-			}
-			<-ticker.C
+// WatchButton switches off if the button is pressed until ctx is done
+func (h *Horn) WatchButton(ctx context.Context) error {
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+	for {
+		if h.pfd.Switches[HornButton].Value() == byte(0) {
+			h.Off()
+		}
+		h.heartbeat.Beat()
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
 		}
-	}()
+	}
 }
 
-//
-func (h *Horn) UnwatchButton() {
-	h.unwatch = true
+// Check returns an error if the board was not read for 5 seconds e.g. the button loop is stuck
+func (h *Horn) Check() error {
+	return h.heartbeat.Check()
 }
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gvalkov/golang-evdev"
+	"github.com/marcsauter/buzzer/pkg/metrics"
 )
 
 const (
@@ -26,18 +29,31 @@ const (
 
 //
 type Keypad struct {
-	name string
-	dev  *evdev.InputDevice
-	stop bool
-	code chan string
+	name   string
+	logger *slog.Logger
+	dev    *evdev.InputDevice
+	code   chan string
+	mutex  sync.Mutex
+	err    error
 }
 
 //
-func NewKeypad(name string) (*Keypad, error) {
+func NewKeypad(name string, logger *slog.Logger) (*Keypad, error) {
 	k := &Keypad{
-		name: name,
-		code: make(chan string),
+		name:   name,
+		logger: logger.With("keypad", name),
+		code:   make(chan string),
 	}
+	dev, err := k.open()
+	if err != nil {
+		return nil, err
+	}
+	k.dev = dev
+	return k, nil
+}
+
+// open opens the input device with the name of the keypad
+func (k *Keypad) open() (*evdev.InputDevice, error) {
 	devs, err := evdev.ListInputDevicePaths("/dev/input/event*")
 	if err != nil {
 		return nil, err
@@ -48,70 +64,133 @@ func NewKeypad(name string) (*Keypad, error) {
 			return nil, err
 		}
 		if strings.Contains(dev.Name, k.name) {
-			k.dev = dev
-			break
+			return dev, nil
 		}
+		dev.File.Close()
 	}
-	if k.dev == nil {
-		return nil, errors.New("no appropriate device found")
-	}
-	return k, nil
+	return nil, errors.New("no appropriate device found")
 }
 
-//
-func (k *Keypad) Start() <-chan string {
-	go func() {
-		var c string
-		ticker := time.NewTicker(time.Millisecond * 50)
-		for !k.stop {
-			ev, err := k.dev.ReadOne()
-			if err != nil {
-				log.Fatal(err)
-			}
-			// proceed only with key events
-			if ev.Type != evdev.EV_KEY {
-				continue
-			}
-			kev := evdev.NewKeyEvent(ev)
-			// proceed only with key down events
-			if kev.State != evdev.KeyDown {
-				continue
-			}
-			// evaluate scan code
-			switch kev.Scancode {
-			case KEY_ENTER:
-				k.code <- c
-				c = ""
-			case KEY_1:
-				c = fmt.Sprintf("%s1", c)
-			case KEY_2:
-				c = fmt.Sprintf("%s2", c)
-			case KEY_3:
-				c = fmt.Sprintf("%s3", c)
-			case KEY_4:
-				c = fmt.Sprintf("%s4", c)
-			case KEY_5:
-				c = fmt.Sprintf("%s5", c)
-			case KEY_6:
-				c = fmt.Sprintf("%s6", c)
-			case KEY_7:
-				c = fmt.Sprintf("%s7", c)
-			case KEY_8:
-				c = fmt.Sprintf("%s8", c)
-			case KEY_9:
-				c = fmt.Sprintf("%s9", c)
-			case KEY_0:
-				c = fmt.Sprintf("%s0", c)
-			}
-			<-ticker.C
+// reconnect reopens the keypad after a read error e.g. if it was unplugged, every second until ctx is done
+func (k *Keypad) reconnect(ctx context.Context) error {
+	k.dev.File.Close()
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
 		}
-	}()
+		dev, err := k.open()
+		if err != nil {
+			continue
+		}
+		k.dev = dev
+		k.setErr(nil)
+		metrics.KeypadReconnects.Inc()
+		k.logger.Info("keypad reconnected")
+		return nil
+	}
+}
+
+// Check returns the read error while the keypad is reconnecting, nil if it is connected
+func (k *Keypad) Check() error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+	if k.err != nil {
+		return fmt.Errorf("%s: %w", k.name, k.err)
+	}
+	return nil
+}
+
+func (k *Keypad) setErr(err error) {
+	k.mutex.Lock()
+	k.err = err
+	k.mutex.Unlock()
+}
+
+// Codes returns the codes entered on the keypad
+func (k *Keypad) Codes() <-chan string {
 	return k.code
 }
 
-//
-func (k *Keypad) Stop() {
-	k.stop = true
-	// TODO: wait
-	return
+// Run reads the keypad until ctx is done, a code is sent to Codes on enter
+// the keypad is reopened after a read error
+func (k *Keypad) Run(ctx context.Context) error {
+	for {
+		err := k.read(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		k.logger.Error("reading keypad failed - reconnecting", "error", err)
+		k.setErr(err)
+		if err := k.reconnect(ctx); err != nil {
+			return nil
+		}
+	}
+}
+
+// read reads the keypad until ctx is done or a read error occurs
+func (k *Keypad) read(ctx context.Context) error {
+	// closing the device unblocks ReadOne
+	stopped := make(chan struct{})
+	defer close(stopped)
+	dev := k.dev
+	go func() {
+		select {
+		case <-ctx.Done():
+			dev.File.Close()
+		case <-stopped:
+		}
+	}()
+	var c string
+	for {
+		ev, err := dev.ReadOne()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		// proceed only with key events
+		if ev.Type != evdev.EV_KEY {
+			continue
+		}
+		kev := evdev.NewKeyEvent(ev)
+		// proceed only with key down events
+		if kev.State != evdev.KeyDown {
+			continue
+		}
+		// evaluate scan code
+		switch kev.Scancode {
+		case KEY_ENTER:
+			select {
+			case k.code <- c:
+			case <-ctx.Done():
+				return nil
+			}
+			c = ""
+		case KEY_1:
+			c = fmt.Sprintf("%s1", c)
+		case KEY_2:
+			c = fmt.Sprintf("%s2", c)
+		case KEY_3:
+			c = fmt.Sprintf("%s3", c)
+		case KEY_4:
+			c = fmt.Sprintf("%s4", c)
+		case KEY_5:
+			c = fmt.Sprintf("%s5", c)
+		case KEY_6:
+			c = fmt.Sprintf("%s6", c)
+		case KEY_7:
+			c = fmt.Sprintf("%s7", c)
+		case KEY_8:
+			c = fmt.Sprintf("%s8", c)
+		case KEY_9:
+			c = fmt.Sprintf("%s9", c)
+		case KEY_0:
+			c = fmt.Sprintf("%s0", c)
+		}
+	}
 }
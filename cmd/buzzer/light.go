@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"time"
 
 	"github.com/luismesas/goPi/piface"
@@ -13,41 +14,52 @@ const (
 
 //
 type Light struct {
-	pfd     *piface.PiFaceDigital
-	unwatch bool
+	pfd   *piface.PiFaceDigital
+	timer relayTimer
+	off   chan struct{}
 }
 
 //
 func NewLight(pfd *piface.PiFaceDigital) *Light {
 	return &Light{
-		pfd: pfd,
+		pfd:   pfd,
+		timer: relayTimer{relay: "light"},
+		off:   make(chan struct{}, 1),
 	}
 }
 
 //
 func (l *Light) On() {
 	l.pfd.Relays[LightRelay].AllOn()
+	l.timer.on()
 }
 
-//
-func (l *Light) Off() {
+// Off switches the light off, it returns true if it was on
+func (l *Light) Off() bool {
 	l.pfd.Relays[LightRelay].AllOff()
+	return l.timer.off()
 }
 
-//
-func (l *Light) WatchButton() {
-	go func() {
-		ticker := time.NewTicker(time.Millisecond * 50)
-		for !l.unwatch {
-			if l.pfd.Switches[LightButton].Value() == byte(0) {
-				l.Off()
-			}
-			<-ticker.C
-		}
-	}()
+// SwitchedOff returns a channel receiving when the light was switched off by the button i.e. the time is up
+func (l *Light) SwitchedOff() <-chan struct{} {
+	return l.off
 }
 
-//
-func (l *Light) UnwatchButton() {
-	l.unwatch = true
+// WatchButton switches off if the button is pressed until ctx is done
+func (l *Light) WatchButton(ctx context.Context) error {
+	ticker := time.NewTicker(time.Millisecond * 50)
+	defer ticker.Stop()
+	for {
+		if l.pfd.Switches[LightButton].Value() == byte(0) && l.Off() {
+			select {
+			case l.off <- struct{}{}:
+			default:
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
 }
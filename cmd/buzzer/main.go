@@ -1,91 +1,277 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"log"
-	"net/url"
+	"log/slog"
+	"net/http"
 	"os"
-	"os/signal"
-	"strconv"
-	"syscall"
+	"sync/atomic"
+	"time"
 
+	"github.com/marcsauter/buzzer/pkg/client"
+	"github.com/marcsauter/buzzer/pkg/config"
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/health"
+	"github.com/marcsauter/buzzer/pkg/lifecycle"
+	"github.com/marcsauter/buzzer/pkg/logging"
+	"github.com/marcsauter/buzzer/pkg/metrics"
+	"github.com/marcsauter/buzzer/pkg/mqtt"
 	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/marcsauter/buzzer/pkg/ticker"
 
 	"github.com/luismesas/goPi/piface"
 	"github.com/luismesas/goPi/spi"
 )
 
 func main() {
-	pin := os.Getenv("BUZZER_PIN")
-	if len(pin) == 0 {
-		pin = "1982"
-		log.Fatal("BUZZER_PIN missing using default")
+	cfg, loader := newSettings()
+	flag.Parse()
+	if ok, err := loader.Command(flag.Args(), os.Stdout); ok {
+		lifecycle.Exit(logging.Default(), lifecycle.WithCode(lifecycle.ExitConfig, err))
 	}
-	device := os.Getenv("BUZZER_KEYPAD_DEVICE")
-	if len(device) == 0 {
-		log.Fatal("BUZZER_KEYPAD_DEVICE missing or not valid")
+	if err := loader.Load(cfg); err != nil {
+		lifecycle.Exit(logging.Default(), lifecycle.WithCode(lifecycle.ExitConfig, err))
 	}
-	url, err := url.Parse(os.Getenv("BUZZER_PITCH_URL"))
-	if err != nil || !url.IsAbs() {
-		log.Fatal("BUZZER_PITCH_URL missing or not valid")
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		lifecycle.Exit(logging.Default(), lifecycle.WithCode(lifecycle.ExitConfig, err))
+	}
+	// the device name is attached to every entry
+	logger = logger.With("component", "buzzer", "device", cfg.Name)
+	lifecycle.Exit(logger, run(cfg, loader, logger))
+}
+
+// run sets up the components and runs them until a signal is received or a component fails
+func run(cfg *settings, loader *config.Loader, logger *slog.Logger) error {
+	// PINs are managed on the server, the local PIN is the fallback if the server is unreachable
+	var pin atomic.Value
+	pin.Store(cfg.PIN)
+	interval := cfg.CheckInterval
+	name := cfg.Name
+	api, err := client.New(cfg.PitchURL, client.WithDevice(name), client.WithTimeout(time.Duration(interval)*time.Second))
+	if err != nil {
+		return lifecycle.WithCode(lifecycle.ExitConfig, err)
 	}
-	interval, err := strconv.Atoi(os.Getenv("BUZZER_PITCH_CHECK_INTERVAL"))
+	display, err := cfg.display()
 	if err != nil {
-		log.Fatal("BUZZER_PITCH_CHECK_INTERVAL missing or not valid")
+		return lifecycle.WithCode(lifecycle.ExitConfig, err)
+	}
+	locale := display.Locale()
+	// the next pitch, the events and the heartbeats are received and sent through MQTT or the API,
+	// PINs and commands always use the API
+	var src pitch.Source = api
+	var events eventReporter = api
+	var m *mqtt.Device
+	if cfg.Transport == mqtt.Transport {
+		if m, err = mqtt.NewDevice(cfg.MQTT, cfg.MQTTTopic, name, cfg.Venue, logger); err != nil {
+			return lifecycle.WithCode(lifecycle.ExitConfig, err)
+		}
+		src, events = m, m
 	}
 
 	// creates a new pifacedigital instance
 	pfd := piface.NewPiFaceDigital(spi.DEFAULT_HARDWARE_ADDR, spi.DEFAULT_BUS, spi.DEFAULT_CHIP)
 
 	// initializes pifacedigital board
-	err = pfd.InitBoard()
-	if err != nil {
-		fmt.Printf("Error on init board: %s", err)
-		return
+	if err := pfd.InitBoard(); err != nil {
+		return fmt.Errorf("init board: %s", err)
 	}
 	b := NewBuzzer(pfd)
 	h := NewHorn(pfd)
-	h.WatchButton()
 	l := NewLight(pfd)
-	l.WatchButton()
-	k, err := NewKeypad(device)
+	k, err := NewKeypad(cfg.KeypadDevice, logger)
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 	//
-	s := NewScreen()
-	s.Init("buzzer", "Pitch Info", "Pitch Info")
-	s.Main()
-	s.StartTicker()
-	//
-	p := pitch.NewPitch(url)
-	p.StartCheckNext(interval, s)
+	p := pitch.NewPoller(src, time.Duration(interval)*time.Second, cfg.Cache, logger)
 	//
-	code := k.Start()
-	cancel := make(chan os.Signal, 1)
-	signal.Notify(cancel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
-	for {
-		select {
-		case c := <-code:
-			if c == pin {
-				s.Keypad(fmt.Sprintf(DefaultKeypadText, "ERROR: invalid PIN"))
-			} else {
-				s.Keypad(fmt.Sprintf("PIN valid - Please press the Buzzer to release the Pitch ...\n"))
-				b.Watch()
+	s := NewScreen(locale, logger)
+	s.Init("buzzer", "Pitch Info", "Pitch Info")
+	d := pitch.NewDispatcher(display, logger)
+	d.Add("screen", s)
+
+	lc := lifecycle.New(lifecycle.DefaultTimeout, logger)
+	// health of the components, a wedged component stops the keep-alives of the systemd watchdog
+	hc := health.New()
+	hc.Live("board", h.Check)
+	hc.Live("keypad", k.Check)
+	hc.Live("screen", s.Check)
+	hc.Ready("pitch", p.Check)
+	// optional ticker attached to the buzzer
+	if len(cfg.TickerDevice) > 0 {
+		t, err := ticker.NewTicker(cfg.TickerDevice, logger)
+		if err != nil {
+			return err
+		}
+		d.Add("ticker", t)
+		hc.Live("ticker", t.Check)
+		lc.Go("ticker", t.Run)
+		lc.OnStop("ticker", func(ctx context.Context) error {
+			if err := t.Stop(); err != nil {
+				return err
+			}
+			return t.Close()
+		})
+	}
+	lc.Go("screen", s.Run)
+	lc.Go("horn", h.WatchButton)
+	lc.Go("light", l.WatchButton)
+	lc.Go("keypad", k.Run)
+	lc.Go("pitch", func(ctx context.Context) error {
+		return p.Run(ctx, d)
+	})
+	if m != nil {
+		lc.Go("mqtt", func(ctx context.Context) error {
+			return m.Run(ctx, time.Duration(interval)*time.Second)
+		})
+	}
+	lc.Go("systemd", func(ctx context.Context) error {
+		return hc.Systemd(ctx, logger)
+	})
+	// optional local health endpoints
+	if len(cfg.Health) > 0 {
+		lc.Go("health", func(ctx context.Context) error {
+			return health.Serve(ctx, cfg.Health, hc)
+		})
+	}
+	// optional local metrics endpoint
+	if len(cfg.Metrics) > 0 {
+		metrics.Poller(p)
+		lc.Go("metrics", func(ctx context.Context) error {
+			return metrics.Serve(ctx, cfg.Metrics)
+		})
+	}
+	commands := make(chan device.Command)
+	lc.Go("commands", func(ctx context.Context) error {
+		// the heartbeats register the device with the transport mqtt
+		if m == nil {
+			if err := device.Register(ctx, api, name, cfg.Venue); err != nil {
+				logger.Error("registering device failed", "error", err)
+			}
+		}
+		return pollCommands(ctx, logger, api, name, interval, commands)
+	})
+	lc.Go("config", func(ctx context.Context) error {
+		return loader.Watch(ctx, logger, func(c interface{}, changed []string) {
+			pin.Store(c.(*settings).PIN)
+		})
+	})
+	lc.Go("main", func(ctx context.Context) error {
+		for {
+			select {
+			case c := <-k.Codes():
+				// the correlation id follows the release from the keypad to the verification on the server
+				id := logging.NewID()
+				log := logger.With(logging.Key, id)
+				if !validPIN(logging.WithID(ctx, id), log, api, pin.Load().(string), c) {
+					log.Warn("invalid PIN entered")
+					metrics.InvalidPINs.Inc()
+					s.Keypad(s.KeypadText(locale.T("keypad.invalid")))
+					continue
+				}
+				log.Info("PIN valid - waiting for the buzzer")
+				s.Keypad(locale.T("keypad.valid"))
+				if err := b.Watch(ctx); err != nil {
+					return nil
+				}
+				log.Info("pitch released", "by", "buzzer", "pitch", p.Next().ID)
+				go reportEvent(logging.WithID(ctx, id), log, events, name, device.EventReleased)
+				metrics.Releases.Inc()
 				l.On() // light on
 				h.On() // horn on
+			case c := <-commands:
+				switch c.Name {
+				case device.CommandRelease:
+					logger.Info("pitch released", "by", "command", "pitch", p.Next().ID)
+					go reportEvent(ctx, logger, events, name, device.EventReleased)
+					metrics.Releases.Inc()
+					l.On()
+					h.On()
+				case device.CommandOff:
+					if l.Off() {
+						go reportEvent(ctx, logger, events, name, device.EventTimeUp)
+					}
+					h.Off()
+				}
+			case <-l.SwitchedOff():
+				go reportEvent(ctx, logger, events, name, device.EventTimeUp)
+			case <-ctx.Done():
+				return nil
+			}
+		}
+	})
+	// reset the outputs on exit
+	lc.OnStop("screen", func(ctx context.Context) error {
+		return s.Stop()
+	})
+	lc.OnStop("outputs", func(ctx context.Context) error {
+		l.Off()
+		h.Off()
+		return nil
+	})
+	return lc.Run(context.Background())
+}
+
+// eventReporter reports the events of a device to the server e.g. *client.Client or *mqtt.Device
+type eventReporter interface {
+	ReportEvent(ctx context.Context, name string, e device.Event) (pitch.Pitch, error)
+}
+
+// reportEvent reports a release or time-up to the server for the history, a failure is logged only
+func reportEvent(ctx context.Context, logger *slog.Logger, events eventReporter, name, event string) {
+	p, err := events.ReportEvent(ctx, name, device.Event{Name: event, Time: time.Now()})
+	if err != nil {
+		logger.Error("reporting event failed", "event", event, "error", err)
+		return
+	}
+	logger.Info("event reported", "event", event, "pitch", p.ID)
+}
+
+// validPIN verifies the code with the server, a code rejected by the server is not valid,
+// the local PIN is only accepted if the server cannot be reached
+func validPIN(ctx context.Context, logger *slog.Logger, api *client.Client, pin, code string) bool {
+	if len(code) == 0 {
+		return false
+	}
+	_, err := api.VerifyPIN(ctx, code)
+	if err == nil {
+		return true
+	}
+	if client.StatusCode(err) == http.StatusForbidden {
+		return false
+	}
+	logger.Error("verifying PIN failed", "error", err)
+	return client.StatusCode(err) == 0 && len(pin) > 0 && code == pin
+}
+
+// pollCommands polls the commands queued on the server for the device until ctx is done
+func pollCommands(ctx context.Context, logger *slog.Logger, api *client.Client, name string, interval int, commands chan<- device.Command) error {
+	ticker := time.NewTicker(time.Second * time.Duration(interval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		id := logging.NewID()
+		cmds, err := api.Commands(logging.WithID(ctx, id), name)
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("polling commands failed", logging.Key, id, "error", err)
+			}
+			continue
+		}
+		for _, c := range cmds {
+			logger.Info("command received", logging.Key, id, "command", c.Name)
+			select {
+			case commands <- c:
+			case <-ctx.Done():
+				return nil
 			}
-		case <-cancel:
-			p.StopCheckNext()
-			b.Unwatch()
-			l.UnwatchButton()
-			l.Off()
-			h.UnwatchButton()
-			h.Off()
-			k.Stop()
-			s.StopCountdown()
-			s.Destroy()
-			log.Fatalln("signal received - exiting")
 		}
 	}
 }
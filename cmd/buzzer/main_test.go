@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/marcsauter/buzzer/pkg/client"
+)
+
+func TestValidPIN(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	tests := []struct {
+		name   string
+		status int
+		code   string
+		want   bool
+	}{
+		{"verified", http.StatusOK, "4711", true},
+		{"rejected", http.StatusForbidden, "4711", false},
+		{"rejected local PIN", http.StatusForbidden, "1234", false},
+		{"server error", http.StatusInternalServerError, "1234", false},
+		{"unreachable", 0, "1234", true},
+		{"unreachable wrong PIN", 0, "4711", false},
+		{"empty", http.StatusOK, "", false},
+	}
+	for _, tt := range tests {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(tt.status)
+			io.WriteString(w, `{"name": "organizer"}`)
+		}))
+		if tt.status == 0 {
+			ts.Close()
+		}
+		api, err := client.New(ts.URL, client.WithRetries(0, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok := validPIN(context.Background(), logger, api, "1234", tt.code); ok != tt.want {
+			t.Errorf("%s: %v, want %v", tt.name, ok, tt.want)
+		}
+		ts.Close()
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/metrics"
+)
+
+// relayTimer accumulates the time a relay is switched on in the metrics
+type relayTimer struct {
+	sync.Mutex
+	relay string
+	since time.Time
+}
+
+// on starts the timer if the relay was off
+func (t *relayTimer) on() {
+	t.Lock()
+	defer t.Unlock()
+	if t.since.IsZero() {
+		t.since = time.Now()
+	}
+}
+
+// off adds the time since the relay was switched on, it returns true if the relay was on
+func (t *relayTimer) off() bool {
+	t.Lock()
+	defer t.Unlock()
+	if t.since.IsZero() {
+		return false
+	}
+	metrics.RelayOn.WithLabelValues(t.relay).Add(time.Since(t.since).Seconds())
+	t.since = time.Time{}
+	return true
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
 	"net"
 	"strings"
 	"time"
 
+	"github.com/marcsauter/buzzer/pkg/health"
+	"github.com/marcsauter/buzzer/pkg/i18n"
 	"github.com/marcsauter/buzzer/pkg/pitch"
 
 	"github.com/mattn/go-gtk/gdk"
@@ -23,28 +27,32 @@ const (
 	DefaultFontExtraSmall          = "Sans 20"
 	DefaultFontSmall               = "Sans 40"
 	DefaultFontLarge               = "Sans 50"
-	DefaultKeypadText              = "%s\nEnter a valid PIN to release the Buzzer ... "
 )
 
 // Screen represents the display
 type Screen struct {
 	Ticker        string
-	Status        string
 	PitchCode     string
+	locale        *i18n.Locale
+	logger        *slog.Logger
+	heartbeat     *health.Heartbeat
 	ticker        *gtk.Label
 	title         *gtk.Label
 	speaker       *gtk.Label
 	countdown     *gtk.Label
 	keypad        *gtk.Label
-	stopTicker    bool
-	stopCountdown bool
+	statusbar     *gtk.Statusbar
+	contextID     uint
+	stopCountdown chan struct{}
 }
 
-// NewScreen returns a new instance of Screen
-func NewScreen() *Screen {
+// NewScreen returns a new instance of Screen showing the texts in locale
+func NewScreen(locale *i18n.Locale, logger *slog.Logger) *Screen {
 	return &Screen{
-		Ticker: "NEXT",
-		Status: "IP: %s",
+		Ticker:    "NEXT",
+		locale:    locale,
+		logger:    logger,
+		heartbeat: health.NewHeartbeat(10 * time.Second),
 	}
 }
 
@@ -58,7 +66,7 @@ func (s *Screen) Init(name, winTitle, iconName string) {
 	window.SetIconName(iconName)
 	window.Fullscreen()
 	window.Connect("destroy", func(ctx *glib.CallbackContext) {
-		log.Println("got destroy", ctx.Data().(string))
+		s.logger.Info("got destroy", "window", ctx.Data().(string))
 		gtk.MainQuit()
 	}, name)
 
@@ -95,35 +103,50 @@ func (s *Screen) Init(name, winTitle, iconName string) {
 
 	// keypad
 	keypadFrame := gtk.NewFrame("")
-	s.keypad = gtk.NewLabel(fmt.Sprintf(DefaultKeypadText, "   "))
+	s.keypad = gtk.NewLabel(s.KeypadText("   "))
 	s.keypad.ModifyFontEasy(DefaultMonospaceFontExtraSmall)
 	keypadFrame.Add(s.keypad)
 	box.Add(keypadFrame)
 
 	// statusbar
-	statusbar := gtk.NewStatusbar()
-	contextID := statusbar.GetContextId("go-gtk")
-	statusbar.Push(contextID, s.statusText())
-	box.PackStart(statusbar, false, false, 0)
+	s.statusbar = gtk.NewStatusbar()
+	s.contextID = s.statusbar.GetContextId("go-gtk")
+	s.statusbar.Push(s.contextID, s.statusText())
+	box.PackStart(s.statusbar, false, false, 0)
 
 	// window
 	window.Add(box)
 	window.SetSizeRequest(640, 480)
 	window.ShowAll()
+
+	// the heartbeat is beaten from the main loop, it stops if the loop is stuck
+	glib.TimeoutAdd(1000, func() bool {
+		s.heartbeat.Beat()
+		return true
+	})
 }
 
-// Main thread
-func (s *Screen) Main() {
-	go func() {
-		gdk.ThreadsEnter()
-		gtk.Main()
-		gdk.ThreadsLeave()
-	}()
+// Check returns an error if the main loop did not run for 10 seconds
+func (s *Screen) Check() error {
+	return s.heartbeat.Check()
 }
 
-// Destroy the screen ... not really
-func (s *Screen) Destroy() {
-	gtk.MainQuit()
+// Run runs the main loop and the ticker until ctx is done or the window is closed
+func (s *Screen) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.runTicker(ctx)
+	go func() {
+		<-ctx.Done()
+		gtk.MainQuit()
+	}()
+	gdk.ThreadsEnter()
+	gtk.Main()
+	gdk.ThreadsLeave()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return errors.New("window closed")
 }
 
 //
@@ -133,62 +156,108 @@ func (s *Screen) setLabel(label *gtk.Label, text string) {
 	gdk.ThreadsLeave()
 }
 
-// StartTicker does what it says
-func (s *Screen) StartTicker() {
-	go func() {
-		text := s.Ticker
-		// enough text for a ticker illusion
-		for i := 0; i < 25; i++ {
-			text = fmt.Sprintf("%s - %s", text, s.Ticker)
+// runTicker does what it says until ctx is done
+func (s *Screen) runTicker(ctx context.Context) {
+	text := s.Ticker
+	// enough text for a ticker illusion
+	for i := 0; i < 25; i++ {
+		text = fmt.Sprintf("%s - %s", text, s.Ticker)
+	}
+	count := len(s.Ticker) + 3 // three character for text separation
+	i := 0
+	ticker := time.NewTicker(time.Millisecond * 1000)
+	defer ticker.Stop()
+	for {
+		if i == count {
+			i = 0
 		}
-		count := len(s.Ticker) + 3 // three character for text separation
-		i := 0
-		ticker := time.NewTicker(time.Millisecond * 1000)
-		for !s.stopTicker {
-			if i == count {
-				i = 0
-			}
-			s.setLabel(s.ticker, text[i:])
-			i = i + 1
-			<-ticker.C
+		s.setLabel(s.ticker, text[i:])
+		i = i + 1
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
 		}
-		s.stopTicker = false
-	}()
-}
-
-// StopTicker does what it says
-func (s *Screen) StopTicker() {
-	s.stopTicker = true
+	}
 }
 
 // Update the information on the screen
 func (s *Screen) Update(data fmt.Stringer) error {
-	p, _ := data.(*pitch.Pitch)
+	var p pitch.Pitch
+	switch d := data.(type) {
+	case *pitch.Message:
+		p = d.Pitch
+		// idle message and open slot
+		if d.Phase() == pitch.PhaseIdle || d.Open() {
+			s.Stop()
+			s.setLabel(s.title, d.String())
+			return nil
+		}
+	case *pitch.Pitch:
+		p = *d
+	default:
+		return fmt.Errorf("screen: %T not supported", data)
+	}
 	s.setLabel(s.speaker, p.Speaker)
 	s.setLabel(s.title, p.Title)
-	s.stopCountdown = false
+	date := p.Date
+	// only one countdown at a time
+	s.StopCountdown()
+	stop := make(chan struct{})
+	s.stopCountdown = stop
 	go func() {
 		ticker := time.NewTicker(time.Millisecond * 250)
-		for !s.stopCountdown {
-			r := time.Now().Sub(p.Date)
+		defer ticker.Stop()
+		for {
+			r := time.Now().Sub(date)
 			sign := ""
 			if r < 0 {
 				sign = "-"
 			}
-			hrs := int(math.Abs(r.Hours()))
-			min := int(math.Abs(r.Minutes())) - hrs*60
-			sec := int(math.Abs(r.Seconds())) - hrs*3600 - min*60
-			s.setLabel(s.countdown, fmt.Sprintf("%s %02dh %02dm %02ds", sign, hrs, min, sec))
-			<-ticker.C
+			sec := int(math.Abs(r.Seconds())) % 60
+			text := s.locale.Seconds(sec)
+			if math.Abs(r.Minutes()) >= 1 {
+				text = fmt.Sprintf("%s %s", s.locale.Duration(r), text)
+			}
+			s.setLabel(s.countdown, fmt.Sprintf("%s %s", sign, text))
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
 		}
-		s.stopCountdown = false
 	}()
 	return nil
 }
 
+// Stop clears the information on the screen
+func (s *Screen) Stop() error {
+	s.StopCountdown()
+	s.setLabel(s.speaker, "")
+	s.setLabel(s.title, "")
+	s.setLabel(s.countdown, "")
+	return nil
+}
+
 // StopCountdown does what it says
 func (s *Screen) StopCountdown() {
-	s.stopCountdown = true
+	if s.stopCountdown != nil {
+		close(s.stopCountdown)
+		s.stopCountdown = nil
+	}
+}
+
+// UpdateStatus shows the connection to the server in the status line
+func (s *Screen) UpdateStatus(status pitch.Status) error {
+	text := s.statusText()
+	if status.Health != pitch.HealthOK {
+		text = s.locale.T("status.offline", text, s.locale.Time(status.Since))
+	}
+	gdk.ThreadsEnter()
+	s.statusbar.Pop(s.contextID)
+	s.statusbar.Push(s.contextID, text)
+	gdk.ThreadsLeave()
+	return nil
 }
 
 // Keypad set new keypad information
@@ -196,6 +265,11 @@ func (s *Screen) Keypad(text string) {
 	s.setLabel(s.keypad, text)
 }
 
+// KeypadText returns the prompt to enter the PIN with a message
+func (s *Screen) KeypadText(msg string) string {
+	return s.locale.T("keypad.prompt", msg)
+}
+
 // statusText prepares the text for the status line
 func (s *Screen) statusText() string {
 	var ipAddrs []string
@@ -210,5 +284,5 @@ func (s *Screen) statusText() string {
 			}
 		}
 	}
-	return fmt.Sprintf(s.Status, strings.Join(ipAddrs, ", "))
+	return s.locale.T("status.ip", strings.Join(ipAddrs, ", "))
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// auditCommand dispatches the audit sub commands
+func auditCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("audit: sub command missing")
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("audit list", flag.ExitOnError)
+		actor := fs.String("actor", "", "user")
+		action := fs.String("action", "", "action e.g. pitch.put or kind of the actions e.g. pitch")
+		target := fs.String("target", "", "target e.g. pitch/42")
+		from := fs.String("from", "", "first day e.g. 2026-01-01 or time in RFC 3339")
+		to := fs.String("to", "", "day after the last day e.g. 2027-01-01 or time in RFC 3339")
+		limit := fs.Int("limit", 100, "maximal number of entries, the last entries are returned (0: all)")
+		fs.Parse(args[1:])
+		q := url.Values{"limit": {strconv.Itoa(*limit)}}
+		for k, v := range map[string]string{"actor": *actor, "action": *action, "target": *target, "from": *from, "to": *to} {
+			if len(v) > 0 {
+				q.Set(k, v)
+			}
+		}
+		entries, err := api.Audit(ctx, q)
+		if err != nil {
+			return err
+		}
+		table := [][]string{{"seq", "time", "actor", "ip", "action", "target", "status", "changed"}}
+		for _, e := range entries {
+			changed := make([]string, 0, len(e.Diff))
+			for field := range e.Diff {
+				changed = append(changed, field)
+			}
+			sort.Strings(changed)
+			table = append(table, []string{strconv.FormatUint(e.Seq, 10), formatTime(e.Time), e.Actor, e.IP, e.Action, e.Target, strconv.Itoa(e.Status), strings.Join(changed, ", ")})
+		}
+		return output(entries, table)
+	case "verify":
+		v, err := api.VerifyAudit(ctx)
+		if err != nil {
+			return err
+		}
+		if err := output(v, [][]string{{"valid", "entries", "error"}, {strconv.FormatBool(v.Valid), strconv.Itoa(v.Entries), v.Error}}); err != nil {
+			return err
+		}
+		if !v.Valid {
+			return errors.New("audit log chain broken")
+		}
+		return nil
+	}
+	return fmt.Errorf("audit: no such sub command: %s", args[0])
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+// deviceCommand dispatches the device sub commands
+func deviceCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("device: sub command missing")
+	}
+	switch args[0] {
+	case "list":
+		fs := flag.NewFlagSet("device list", flag.ExitOnError)
+		venue := fs.String("venue", "", "venue id (default: all venues)")
+		fs.Parse(args[1:])
+		devices, err := api.Devices(ctx, *venue)
+		if err != nil {
+			return err
+		}
+		table := [][]string{{"name", "ip", "venue", "last seen"}}
+		for _, d := range devices {
+			table = append(table, []string{d.Name, d.IP, d.Venue, formatTime(d.LastSeen)})
+		}
+		return output(devices, table)
+	case "send":
+		if len(args) != 3 {
+			return errors.New("device send: name and command required")
+		}
+		return api.SendCommand(ctx, args[1], args[2])
+	}
+	return fmt.Errorf("device: no such sub command: %s", args[0])
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/client"
+	"gopkg.in/yaml.v2"
+)
+
+// config represents the config file
+type config struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	Output   string `yaml:"output"`
+}
+
+var (
+	configFile, serverURL, username, password, outputFormat string
+	timeout                                                 time.Duration
+	api                                                     *client.Client
+	ctx                                                     context.Context
+)
+
+func init() {
+	flag.StringVar(&configFile, "config", os.Getenv("BUZZERCTL_CONFIG"), "config file (default ~/.config/buzzerctl/config.yaml)")
+	flag.StringVar(&serverURL, "url", os.Getenv("BUZZER_URL"), "server URL")
+	flag.StringVar(&username, "username", os.Getenv("BUZZER_USERNAME"), "username")
+	flag.StringVar(&password, "password", os.Getenv("BUZZER_PASSWORD"), "password")
+	flag.StringVar(&outputFormat, "output", "", "output format: table, json or yaml (default table)")
+	flag.DurationVar(&timeout, "timeout", client.DefaultTimeout, "request timeout")
+	flag.Usage = usage
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] <command> [args]\n\n", os.Args[0])
+	fmt.Fprintln(os.Stderr, "commands:")
+	fmt.Fprintln(os.Stderr, "  next [-venue <id>]")
+	fmt.Fprintln(os.Stderr, "  pitch list [-venue <id>] [-status pending|approved|rejected|offered]")
+	fmt.Fprintln(os.Stderr, "  pitch slots [-venue <id>]")
+	fmt.Fprintln(os.Stderr, "  pitch approve <id>")
+	fmt.Fprintln(os.Stderr, "  pitch reject [-reason <reason>] <id>")
+	fmt.Fprintln(os.Stderr, "  pitch cancel [-reason <reason>] <id>")
+	fmt.Fprintln(os.Stderr, "  pitch history <id>")
+	fmt.Fprintln(os.Stderr, "  pitch get <id>")
+	fmt.Fprintln(os.Stderr, "  pitch create -id <id> -speaker <speaker> -title <title> -date <RFC 3339> [-timezone <IANA name>] [-venue <id>]")
+	fmt.Fprintln(os.Stderr, "  pitch edit [-speaker <speaker>] [-title <title>] [-date <RFC 3339>] [-timezone <IANA name>] [-venue <id>] <id>")
+	fmt.Fprintln(os.Stderr, "  pitch delete <id>")
+	fmt.Fprintln(os.Stderr, "  pitch import [-format csv|json] [-dry-run] [-upsert] <file>")
+	fmt.Fprintln(os.Stderr, "  pitch export [-format csv|json] [-o file] [-venue <id>]")
+	fmt.Fprintln(os.Stderr, "  series list")
+	fmt.Fprintln(os.Stderr, "  series set [-title <title>] [-venue <id>] [-timezone <IANA name>] [-start <RFC 3339>] [-rrule <RRULE>] [-except <dates>] <id>")
+	fmt.Fprintln(os.Stderr, "  series delete <id>")
+	fmt.Fprintln(os.Stderr, "  venue list")
+	fmt.Fprintln(os.Stderr, "  venue set [-name <name>] [-timezone <IANA name>] <id>")
+	fmt.Fprintln(os.Stderr, "  venue delete <id>")
+	fmt.Fprintln(os.Stderr, "  device list [-venue <id>]")
+	fmt.Fprintln(os.Stderr, "  device send <name> release|off")
+	fmt.Fprintln(os.Stderr, "  report months|delays|speakers|noshows|events [-venue <id>] [-from <date>] [-to <date>] [-limit <n>] [-o file]")
+	fmt.Fprintln(os.Stderr, "  audit list [-actor <user>] [-action <action>] [-target <kind/id>] [-from <date>] [-to <date>] [-limit <n>]")
+	fmt.Fprintln(os.Stderr, "  audit verify")
+	fmt.Fprintln(os.Stderr, "  user list")
+	fmt.Fprintln(os.Stderr, "  user set <username>")
+	fmt.Fprintln(os.Stderr, "  user delete <username>")
+	fmt.Fprintln(os.Stderr, "  pin list")
+	fmt.Fprintln(os.Stderr, "  pin set <name>")
+	fmt.Fprintln(os.Stderr, "  pin delete <name>")
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+// loadConfig fills the settings not given by flag or environment from the config file
+func loadConfig() error {
+	name := configFile
+	if len(name) == 0 {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		name = filepath.Join(home, ".config", "buzzerctl", "config.yaml")
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return nil
+		}
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	c := config{}
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return fmt.Errorf("%s: %s", name, err)
+	}
+	for _, s := range []struct {
+		value    *string
+		fromFile string
+	}{
+		{&serverURL, c.URL},
+		{&username, c.Username},
+		{&password, c.Password},
+		{&outputFormat, c.Output},
+	} {
+		if len(*s.value) == 0 {
+			*s.value = s.fromFile
+		}
+	}
+	return nil
+}
+
+func main() {
+	log.SetFlags(0)
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+	if err := loadConfig(); err != nil {
+		log.Fatal("ERROR: ", err)
+	}
+	var err error
+	if api, err = client.New(serverURL, client.WithCredentials(username, password), client.WithTimeout(timeout)); err != nil {
+		log.Fatal("ERROR: ", err)
+	}
+	var cancel context.CancelFunc
+	ctx, cancel = signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	switch args[0] {
+	case "next":
+		err = nextCommand(args[1:])
+	case "pitch":
+		err = pitchCommand(args[1:])
+	case "series":
+		err = seriesCommand(args[1:])
+	case "venue":
+		err = venueCommand(args[1:])
+	case "device":
+		err = deviceCommand(args[1:])
+	case "report":
+		err = reportCommand(args[1:])
+	case "audit":
+		err = auditCommand(args[1:])
+	case "user":
+		err = userCommand(args[1:])
+	case "pin":
+		err = pinCommand(args[1:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		cancel()
+		log.Fatal("ERROR: ", err)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	configFile = filepath.Join(t.TempDir(), "config.yaml")
+	content := "url: https://buzzer.example.com/\nusername: marc\npassword: s3cr3t\noutput: json\n"
+	if err := ioutil.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// given by flag or environment
+	serverURL, username, password, outputFormat = "", "jane", "", ""
+	if err := loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if serverURL != "https://buzzer.example.com/" || username != "jane" || password != "s3cr3t" || outputFormat != "json" {
+		t.Errorf("settings %s %s %s %s, want the file except the username", serverURL, username, password, outputFormat)
+	}
+
+	if err := ioutil.WriteFile(configFile, []byte("url: [\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfig(); err == nil {
+		t.Error("config not valid: no error")
+	}
+	configFile = filepath.Join(t.TempDir(), "missing.yaml")
+	if err := loadConfig(); err == nil {
+		t.Error("config missing: no error")
+	}
+}
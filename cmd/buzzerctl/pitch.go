@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// csvFields are the columns written on export, the names of the pitch.Pitch FieldMap
+var csvFields = []string{"id", "speaker", "title", "date", "timezone", "venue", "abstract"}
+
+// row is a record of an import file, position is the line of a CSV file or the item of a JSON array
+type row struct {
+	position string
+	values   url.Values
+}
+
+// pitchCommand dispatches the pitch sub commands
+func pitchCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("pitch: sub command missing")
+	}
+	switch args[0] {
+	case "list":
+		return pitchList(args[1:])
+	case "get":
+		return pitchGet(args[1:])
+	case "create":
+		return pitchCreate(args[1:])
+	case "edit":
+		return pitchEdit(args[1:])
+	case "delete":
+		return pitchDelete(args[1:])
+	case "slots":
+		return pitchSlots(args[1:])
+	case "approve":
+		if len(args) != 2 {
+			return errors.New("pitch approve: id missing")
+		}
+		return api.ApprovePitch(ctx, args[1])
+	case "reject":
+		fs := flag.NewFlagSet("pitch reject", flag.ExitOnError)
+		reason := fs.String("reason", "", "reason sent to the speaker")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			return errors.New("pitch reject: id missing")
+		}
+		return api.RejectPitch(ctx, fs.Arg(0), *reason)
+	case "cancel":
+		fs := flag.NewFlagSet("pitch cancel", flag.ExitOnError)
+		reason := fs.String("reason", "", "reason sent to the speaker")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			return errors.New("pitch cancel: id missing")
+		}
+		p, err := api.CancelPitch(ctx, fs.Arg(0), *reason)
+		if err != nil {
+			return err
+		}
+		return output(p, pitchTable(pitch.Pitches{p}))
+	case "history":
+		return pitchHistory(args[1:])
+	case "import":
+		return pitchImport(args[1:])
+	case "export":
+		return pitchExport(args[1:])
+	}
+	return fmt.Errorf("pitch: no such sub command: %s", args[0])
+}
+
+// nextCommand shows the next pitch
+func nextCommand(args []string) error {
+	fs := flag.NewFlagSet("next", flag.ExitOnError)
+	venue := fs.String("venue", "", "venue id (default: all venues)")
+	fs.Parse(args)
+	p, err := api.Next(ctx, *venue)
+	if err != nil {
+		return err
+	}
+	if len(p.ID) == 0 {
+		return output(nil, [][]string{{"no pitch scheduled"}})
+	}
+	return output(p, pitchTable(pitch.Pitches{p}))
+}
+
+// pitchTable returns the table rows for pitches
+func pitchTable(pitches pitch.Pitches) [][]string {
+	table := [][]string{{"id", "date", "venue", "speaker", "title", "status", "released"}}
+	for _, p := range pitches {
+		released := ""
+		if p.Released {
+			released = formatTime(p.ReleasedAt)
+		}
+		table = append(table, []string{p.ID, pitchDate(p), p.VenueName, p.Speaker, p.Title, p.Status, released})
+	}
+	return table
+}
+
+// pitchDate returns the date of the pitch in its timezone
+func pitchDate(p pitch.Pitch) string {
+	loc := p.Location(time.Local)
+	return p.Date.In(loc).Format("02.01.2006 15:04 MST")
+}
+
+// pitchList lists all pitches or the pitches in a venue or with a status
+func pitchList(args []string) error {
+	fs := flag.NewFlagSet("pitch list", flag.ExitOnError)
+	venue := fs.String("venue", "", "venue id (default: all venues)")
+	status := fs.String("status", "", "pending, approved, rejected or offered (default: all)")
+	fs.Parse(args)
+	pitches, err := api.Pitches(ctx, *venue)
+	if err != nil {
+		return err
+	}
+	if len(*status) > 0 {
+		selected := pitch.Pitches{}
+		for _, p := range pitches {
+			if p.Status == *status || (*status == pitch.StatusApproved && p.Approved()) {
+				selected = append(selected, p)
+			}
+		}
+		pitches = selected
+	}
+	return output(pitches, pitchTable(pitches))
+}
+
+// pitchSlots lists the open slots
+func pitchSlots(args []string) error {
+	fs := flag.NewFlagSet("pitch slots", flag.ExitOnError)
+	venue := fs.String("venue", "", "venue id (default: all venues)")
+	fs.Parse(args)
+	slots, err := api.Slots(ctx, *venue)
+	if err != nil {
+		return err
+	}
+	return output(slots, pitchTable(slots))
+}
+
+// pitchHistory shows the history, the current offer and the waitlist of a pitch
+func pitchHistory(args []string) error {
+	if len(args) != 1 {
+		return errors.New("pitch history: id missing")
+	}
+	slot, err := api.PitchSlot(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	table := [][]string{{"time", "event", "speaker", "title", "reason"}}
+	for _, h := range slot.History {
+		table = append(table, []string{formatTime(h.Time), h.Event, h.Speaker, h.Title, h.Reason})
+	}
+	if slot.Offer != nil {
+		table = append(table, []string{formatTime(slot.Offer.Deadline), "offer until", slot.Offer.Speaker, slot.Offer.Title, slot.Offer.Contact})
+	}
+	for _, c := range slot.Waitlist {
+		table = append(table, []string{formatTime(c.Added), "waitlist", c.Speaker, c.Title, c.Contact})
+	}
+	return output(slot, table)
+}
+
+// pitchGet shows a pitch
+func pitchGet(args []string) error {
+	if len(args) != 1 {
+		return errors.New("pitch get: id missing")
+	}
+	p, err := api.Pitch(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return output(p, pitchTable(pitch.Pitches{p}))
+}
+
+// pitchFlags returns a FlagSet with the fields of the pitch.Pitch FieldMap
+func pitchFlags(name string, v url.Values) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	for _, field := range csvFields {
+		field := field
+		fs.Func(field, field, func(s string) error {
+			v.Set(field, s)
+			return nil
+		})
+	}
+	return fs
+}
+
+// pitchCreate adds a new pitch
+func pitchCreate(args []string) error {
+	v := url.Values{}
+	pitchFlags("pitch create", v).Parse(args)
+	p, err := pitch.Bind(v)
+	if err != nil {
+		return err
+	}
+	return api.CreatePitch(ctx, p)
+}
+
+// pitchEdit changes the given fields of an existing pitch
+func pitchEdit(args []string) error {
+	v := url.Values{}
+	fs := pitchFlags("pitch edit", v)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("pitch edit: id missing")
+	}
+	current, err := api.Pitch(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	for field, value := range map[string]string{
+		"speaker":  current.Speaker,
+		"title":    current.Title,
+		"date":     current.Date.UTC().Format(time.RFC3339),
+		"timezone": current.Timezone,
+		"venue":    current.Venue,
+	} {
+		if _, ok := v[field]; !ok {
+			v.Set(field, value)
+		}
+	}
+	v.Set("id", current.ID)
+	p, err := pitch.Bind(v)
+	if err != nil {
+		return err
+	}
+	return api.PutPitch(ctx, p)
+}
+
+// pitchDelete removes a pitch
+func pitchDelete(args []string) error {
+	if len(args) != 1 {
+		return errors.New("pitch delete: id missing")
+	}
+	return api.DeletePitch(ctx, args[0])
+}
+
+// pitchImport imports pitches from a CSV or JSON file
+func pitchImport(args []string) error {
+	fs := flag.NewFlagSet("pitch import", flag.ExitOnError)
+	format := fs.String("format", "", "csv or json (default: file extension)")
+	dryRun := fs.Bool("dry-run", false, "validate and report only")
+	upsert := fs.Bool("upsert", false, "update existing pitches with the same id")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("pitch import: file missing")
+	}
+	name := fs.Arg(0)
+	f := os.Stdin
+	if name != "-" {
+		var err error
+		if f, err = os.Open(name); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	rows, err := readRows(f, fileFormat(*format, name))
+	if err != nil {
+		return err
+	}
+	// existing pitches
+	existing := make(map[string]bool)
+	current, err := api.Pitches(ctx, "")
+	if err != nil {
+		return err
+	}
+	for _, p := range current {
+		existing[p.ID] = true
+	}
+	var created, updated, failed int
+	for _, r := range rows {
+		p, err := pitch.Bind(r.values)
+		if err != nil {
+			fmt.Printf("%s: ERROR: %s\n", r.position, err)
+			failed++
+			continue
+		}
+		action := "create"
+		if existing[p.ID] {
+			if !*upsert {
+				fmt.Printf("%s: ERROR: pitch %s already exists\n", r.position, p.ID)
+				failed++
+				continue
+			}
+			action = "update"
+		}
+		if *dryRun {
+			fmt.Printf("%s: %s pitch %s\n", r.position, action, p.ID)
+		} else {
+			if action == "update" {
+				err = api.PutPitch(ctx, p)
+			} else {
+				err = api.CreatePitch(ctx, p)
+			}
+			if err != nil {
+				fmt.Printf("%s: ERROR: %s\n", r.position, err)
+				failed++
+				continue
+			}
+		}
+		existing[p.ID] = true
+		if action == "update" {
+			updated++
+		} else {
+			created++
+		}
+	}
+	fmt.Printf("%d created, %d updated, %d failed\n", created, updated, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d of %d rows failed", failed, len(rows))
+	}
+	return nil
+}
+
+// pitchExport exports all pitches to a CSV or JSON file
+func pitchExport(args []string) error {
+	fs := flag.NewFlagSet("pitch export", flag.ExitOnError)
+	format := fs.String("format", "", "csv or json (default: file extension or csv)")
+	file := fs.String("o", "-", "output file")
+	venue := fs.String("venue", "", "venue id (default: all venues)")
+	fs.Parse(args)
+	pitches, err := api.Pitches(ctx, *venue)
+	if err != nil {
+		return err
+	}
+	f := os.Stdout
+	if *file != "-" {
+		if f, err = os.Create(*file); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	switch fileFormat(*format, *file) {
+	case "json":
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		return enc.Encode(pitches)
+	case "csv":
+		w := csv.NewWriter(f)
+		w.Write(csvFields)
+		for _, p := range pitches {
+			w.Write([]string{p.ID, p.Speaker, p.Title, p.Date.In(p.Location(time.UTC)).Format(time.RFC3339), p.Timezone, p.Venue, p.Abstract})
+		}
+		w.Flush()
+		return w.Error()
+	}
+	return fmt.Errorf("no such format: %s", *format)
+}
+
+// fileFormat returns the format or if empty the format derived from the file name
+func fileFormat(format, name string) string {
+	if len(format) > 0 {
+		return strings.ToLower(format)
+	}
+	if strings.ToLower(filepath.Ext(name)) == ".json" {
+		return "json"
+	}
+	return "csv"
+}
+
+// readRows reads the records of a CSV file with header or of a JSON array
+func readRows(r io.Reader, format string) ([]row, error) {
+	rows := []row{}
+	switch format {
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("csv header: %s", err)
+		}
+		for i := range header {
+			header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+		}
+		for line := 2; ; line++ {
+			rec, err := cr.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			v := url.Values{}
+			for i, field := range rec {
+				if i < len(header) {
+					v.Set(header[i], strings.TrimSpace(field))
+				}
+			}
+			rows = append(rows, row{position: fmt.Sprintf("line %d", line), values: v})
+		}
+	case "json":
+		records := []map[string]interface{}{}
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, err
+		}
+		for i, rec := range records {
+			v := url.Values{}
+			for key, value := range rec {
+				if s, ok := value.(string); ok {
+					v.Set(strings.ToLower(key), s)
+				} else if value != nil {
+					v.Set(strings.ToLower(key), fmt.Sprint(value))
+				}
+			}
+			rows = append(rows, row{position: fmt.Sprintf("item %d", i+1), values: v})
+		}
+	default:
+		return nil, fmt.Errorf("no such format: %s", format)
+	}
+	return rows, nil
+}
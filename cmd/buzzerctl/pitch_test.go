@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/marcsauter/buzzer/pkg/client"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// server is a fake server API keeping the pitches
+type server struct {
+	sync.Mutex
+	pitches map[string]pitch.Pitch
+	calls   []string
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.calls = append(s.calls, r.Method+" "+r.URL.Path)
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/pitches":
+		pitches := pitch.Pitches{}
+		for _, id := range []string{"41", "42", "43"} {
+			if p, ok := s.pitches[id]; ok {
+				pitches = append(pitches, p)
+			}
+		}
+		json.NewEncoder(w).Encode(pitches)
+	case r.Method == http.MethodPost || r.Method == http.MethodPut:
+		p := pitch.Pitch{}
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.pitches[p.ID] = p
+		w.WriteHeader(http.StatusCreated)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// testAPI points the commands to a fake server with the pitches
+func testAPI(t *testing.T, pitches ...pitch.Pitch) *server {
+	t.Helper()
+	s := &server{pitches: make(map[string]pitch.Pitch)}
+	for _, p := range pitches {
+		s.pitches[p.ID] = p
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	var err error
+	if api, err = client.New(ts.URL, client.WithRetries(0, 0)); err != nil {
+		t.Fatal(err)
+	}
+	ctx = context.Background()
+	return s
+}
+
+func TestReadRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		content string
+		want    []row
+	}{
+		{
+			name:    "csv",
+			format:  "csv",
+			content: "ID, Speaker ,title\n42,Jane , Go\n43,John\n",
+			want: []row{
+				{position: "line 2", values: map[string][]string{"id": {"42"}, "speaker": {"Jane"}, "title": {"Go"}}},
+				{position: "line 3", values: map[string][]string{"id": {"43"}, "speaker": {"John"}}},
+			},
+		},
+		{
+			name:    "json",
+			format:  "json",
+			content: `[{"ID": "42", "speaker": "Jane", "abstract": null}, {"id": 43}]`,
+			want: []row{
+				{position: "item 1", values: map[string][]string{"id": {"42"}, "speaker": {"Jane"}}},
+				{position: "item 2", values: map[string][]string{"id": {"43"}}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		rows, err := readRows(strings.NewReader(tt.content), tt.format)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(rows, tt.want) {
+			t.Errorf("%s: rows %+v, want %+v", tt.name, rows, tt.want)
+		}
+	}
+	for _, tt := range []struct{ format, content string }{{"csv", ""}, {"json", "{"}, {"xml", "<pitches/>"}} {
+		if _, err := readRows(strings.NewReader(tt.content), tt.format); err == nil {
+			t.Errorf("%s %q: no error", tt.format, tt.content)
+		}
+	}
+	for _, tt := range []struct{ format, name, want string }{{"", "pitches.JSON", "json"}, {"", "pitches.txt", "csv"}, {"JSON", "-", "json"}} {
+		if format := fileFormat(tt.format, tt.name); format != tt.want {
+			t.Errorf("%q %s: %s, want %s", tt.format, tt.name, format, tt.want)
+		}
+	}
+}
+
+func TestImportExport(t *testing.T) {
+	s := testAPI(t, pitch.Pitch{ID: "42", Speaker: "Marc", Title: "C"})
+	dir := t.TempDir()
+	file := filepath.Join(dir, "pitches.csv")
+	content := "id,speaker,title,date,timezone\n" +
+		"41,Jane,Go,2030-03-30T17:30:00+01:00,Europe/Zurich\n" +
+		"42,John,Rust,2030-04-06T17:30:00+02:00,Europe/Zurich\n" +
+		"43,Joe,Zig,not a date,Europe/Zurich\n"
+	if err := ioutil.WriteFile(file, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing is changed on a dry run, an existing pitch fails without upsert
+	if err := pitchImport([]string{"-dry-run", file}); err == nil || err.Error() != "2 of 3 rows failed" {
+		t.Errorf("error %v, want 2 failed rows", err)
+	}
+	if want := []string{"GET /pitches"}; !reflect.DeepEqual(s.calls, want) {
+		t.Errorf("calls %q, want %q", s.calls, want)
+	}
+	s.calls = nil
+	if err := pitchImport([]string{"-upsert", file}); err == nil || err.Error() != "1 of 3 rows failed" {
+		t.Errorf("error %v, want 1 failed row", err)
+	}
+	if want := []string{"GET /pitches", "POST /pitches", "PUT /pitches/42"}; !reflect.DeepEqual(s.calls, want) {
+		t.Errorf("calls %q, want %q", s.calls, want)
+	}
+	if p := s.pitches["42"]; p.Speaker != "John" || p.Date.Format("2006-01-02T15:04") != "2030-04-06T15:30" {
+		t.Errorf("pitch %+v, want updated in UTC", p)
+	}
+
+	// exported with the dates in their timezone
+	exported := filepath.Join(dir, "export.csv")
+	if err := pitchExport([]string{"-o", exported}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "id,speaker,title,date,timezone,venue,abstract\n" +
+		"41,Jane,Go,2030-03-30T17:30:00+01:00,Europe/Zurich,,\n" +
+		"42,John,Rust,2030-04-06T17:30:00+02:00,Europe/Zurich,,\n"
+	if string(data) != want {
+		t.Errorf("exported %q, want %q", data, want)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+// reportCommand writes a report of the server as CSV
+func reportCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("report: name missing (months, delays, speakers, noshows or events)")
+	}
+	fs := flag.NewFlagSet("report "+args[0], flag.ExitOnError)
+	venue := fs.String("venue", "", "venue id (default: all venues)")
+	from := fs.String("from", "", "first day e.g. 2026-01-01")
+	to := fs.String("to", "", "day after the last day e.g. 2027-01-01")
+	limit := fs.Int("limit", 0, "maximal number of speakers (default: all)")
+	out := fs.String("o", "", "output file (default: stdout)")
+	fs.Parse(args[1:])
+	q := url.Values{}
+	for k, v := range map[string]string{"venue": *venue, "from": *from, "to": *to} {
+		if len(v) > 0 {
+			q.Set(k, v)
+		}
+	}
+	if *limit > 0 {
+		q.Set("limit", strconv.Itoa(*limit))
+	}
+	csv, err := api.Report(ctx, args[0], q)
+	if err != nil {
+		return err
+	}
+	if len(*out) > 0 {
+		return ioutil.WriteFile(*out, csv, 0644)
+	}
+	_, err = os.Stdout.Write(csv)
+	return err
+}
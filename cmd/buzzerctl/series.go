@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// seriesCommand dispatches the series sub commands
+func seriesCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("series: sub command missing")
+	}
+	switch args[0] {
+	case "list":
+		series, err := api.Series(ctx)
+		if err != nil {
+			return err
+		}
+		table := [][]string{{"id", "title", "venue", "start", "rrule", "except"}}
+		for _, s := range series {
+			start := s.Start.In(s.Location()).Format("02.01.2006 15:04 MST")
+			table = append(table, []string{s.ID, s.Title, s.Venue, start, s.RRule, strings.Join(s.Except, ", ")})
+		}
+		return output(series, table)
+	case "set":
+		return seriesSet(args[1:])
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("series delete: id missing")
+		}
+		return api.DeleteSeries(ctx, args[1])
+	}
+	return fmt.Errorf("series: no such sub command: %s", args[0])
+}
+
+// seriesSet adds a series or changes the given fields of an existing series
+func seriesSet(args []string) error {
+	fs := flag.NewFlagSet("series set", flag.ExitOnError)
+	title := fs.String("title", "", "title of the occurrences")
+	venue := fs.String("venue", "", "venue id")
+	timezone := fs.String("timezone", "", "timezone of the time of day (IANA name, default: timezone of the venue or the server)")
+	start := fs.String("start", "", "first occurrence (RFC 3339)")
+	rrule := fs.String("rrule", "", "recurrence e.g. FREQ=WEEKLY;BYDAY=TH")
+	except := fs.String("except", "", "comma separated dates without occurrence (YYYY-MM-DD)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("series set: id missing")
+	}
+	s := pitch.Series{ID: fs.Arg(0)}
+	current, err := api.Series(ctx)
+	if err != nil {
+		return err
+	}
+	for _, c := range current {
+		if c.ID == s.ID {
+			s = c
+		}
+	}
+	var errs []string
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "title":
+			s.Title = *title
+		case "venue":
+			s.Venue = *venue
+		case "timezone":
+			s.Timezone = *timezone
+		case "start":
+			t, err := time.Parse(time.RFC3339, *start)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("start: %s", err))
+			}
+			s.Start = t
+		case "rrule":
+			s.RRule = *rrule
+		case "except":
+			s.Except = nil
+			for _, d := range strings.Split(*except, ",") {
+				if d = strings.TrimSpace(d); len(d) > 0 {
+					s.Except = append(s.Except, d)
+				}
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, ", "))
+	}
+	return api.PutSeries(ctx, s)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+// userCommand dispatches the user sub commands
+func userCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("user: sub command missing")
+	}
+	switch args[0] {
+	case "list":
+		users, err := api.Users(ctx)
+		if err != nil {
+			return err
+		}
+		return output(users, nameTable("username", users))
+	case "set":
+		if len(args) != 2 {
+			return errors.New("user set: username missing")
+		}
+		password, err := readSecret("password: ")
+		if err != nil {
+			return err
+		}
+		return api.SetUser(ctx, args[1], password)
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("user delete: username missing")
+		}
+		return api.DeleteUser(ctx, args[1])
+	}
+	return fmt.Errorf("user: no such sub command: %s", args[0])
+}
+
+// pinCommand dispatches the pin sub commands
+func pinCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("pin: sub command missing")
+	}
+	switch args[0] {
+	case "list":
+		pins, err := api.PINs(ctx)
+		if err != nil {
+			return err
+		}
+		return output(pins, nameTable("name", pins))
+	case "set":
+		if len(args) != 2 {
+			return errors.New("pin set: name missing")
+		}
+		pin, err := readSecret("PIN: ")
+		if err != nil {
+			return err
+		}
+		return api.SetPIN(ctx, args[1], pin)
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("pin delete: name missing")
+		}
+		return api.DeletePIN(ctx, args[1])
+	}
+	return fmt.Errorf("pin: no such sub command: %s", args[0])
+}
+
+// nameTable returns a table with a single column
+func nameTable(header string, names []string) [][]string {
+	table := [][]string{{header}}
+	for _, n := range names {
+		table = append(table, []string{n})
+	}
+	return table
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// venueCommand dispatches the venue sub commands
+func venueCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New("venue: sub command missing")
+	}
+	switch args[0] {
+	case "list":
+		venues, err := api.Venues(ctx)
+		if err != nil {
+			return err
+		}
+		table := [][]string{{"id", "name", "timezone"}}
+		for _, v := range venues {
+			table = append(table, []string{v.ID, v.Name, v.Timezone})
+		}
+		return output(venues, table)
+	case "set":
+		fs := flag.NewFlagSet("venue set", flag.ExitOnError)
+		name := fs.String("name", "", "name shown on the devices (default: id)")
+		timezone := fs.String("timezone", "", "timezone of the pitches (IANA name, default: timezone of the server)")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			return errors.New("venue set: id missing")
+		}
+		return api.PutVenue(ctx, pitch.Venue{ID: fs.Arg(0), Name: *name, Timezone: *timezone})
+	case "delete":
+		if len(args) != 2 {
+			return errors.New("venue delete: id missing")
+		}
+		return api.DeleteVenue(ctx, args[1])
+	}
+	return fmt.Errorf("venue: no such sub command: %s", args[0])
+}
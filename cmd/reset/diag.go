@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gvalkov/golang-evdev"
+	"github.com/luismesas/goPi/piface"
+	"github.com/luismesas/goPi/spi"
+	"github.com/marcsauter/buzzer/pkg/logging"
+	"github.com/marcsauter/buzzer/pkg/ticker"
+)
+
+// results of a check
+const (
+	resultPass = "pass"
+	resultFail = "fail"
+	resultSkip = "skip"
+)
+
+// names of the relays and switches as wired in the buzzer
+var (
+	relayNames  = []string{"light", "horn"}
+	switchNames = []string{"buzzer", "switch 1", "light button", "horn button"}
+)
+
+// output is a relay or LED of the board
+type output interface {
+	AllOn()
+	AllOff()
+	Value() byte
+}
+
+// testPattern is shown on the ticker
+type testPattern string
+
+func (p testPattern) String() string {
+	return string(p)
+}
+
+// check is the result of a step of the self-test
+type check struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// report is the result of the self-test
+type report struct {
+	Passed bool    `json:"passed"`
+	Checks []check `json:"checks"`
+}
+
+// diagnosis runs the self-test, interactive with confirmation prompts or unattended
+type diagnosis struct {
+	interactive bool
+	wait        time.Duration
+	in          *bufio.Reader
+	out         io.Writer
+	report      report
+}
+
+// diag runs the self-test of the hardware and returns the exit code, 1 if a check failed
+func diag(args []string) int {
+	fs := flag.NewFlagSet("diag", flag.ExitOnError)
+	keypad := fs.String("keypad", os.Getenv("BUZZER_KEYPAD_DEVICE"), "name of the keypad input device (empty: skipped)")
+	tickerDevice := fs.String("ticker", os.Getenv("BUZZER_TICKER_DEVICE"), "serial device of the ticker (empty: skipped)")
+	wait := fs.Duration("wait", 10*time.Second, "time the switches and the keys are shown")
+	jsonReport := fs.Bool("json", false, "run unattended and print the report as JSON e.g. for provisioning")
+	fs.Parse(args)
+
+	d := &diagnosis{
+		interactive: !*jsonReport,
+		wait:        *wait,
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stdout,
+		report:      report{Passed: true},
+	}
+	if !d.interactive {
+		d.out = io.Discard
+	}
+	d.board()
+	d.keypad(*keypad)
+	d.ticker(*tickerDevice)
+
+	if d.interactive {
+		fmt.Fprintln(d.out)
+		for _, c := range d.report.Checks {
+			fmt.Fprintf(d.out, "%-4s  %-20s %s\n", strings.ToUpper(c.Result), c.Name, c.Detail)
+		}
+	} else {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(d.report)
+	}
+	if !d.report.Passed {
+		return 1
+	}
+	return 0
+}
+
+// add records the result of a check, err fails it
+func (d *diagnosis) add(name string, err error, detail string) {
+	c := check{Name: name, Result: resultPass, Detail: detail}
+	if err != nil {
+		c.Result, c.Detail = resultFail, err.Error()
+		d.report.Passed = false
+	}
+	d.report.Checks = append(d.report.Checks, c)
+}
+
+// skip records a check not run
+func (d *diagnosis) skip(name, reason string) {
+	d.report.Checks = append(d.report.Checks, check{Name: name, Result: resultSkip, Detail: reason})
+}
+
+// confirm asks the question, unattended it is always confirmed: the check relies on what can be read back
+// (see switches for a check that can only be confirmed interactively)
+func (d *diagnosis) confirm(question string) error {
+	if !d.interactive {
+		return nil
+	}
+	fmt.Fprintf(d.out, "%s [y/n] ", question)
+	answer, _ := d.in.ReadString('\n')
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(answer)), "y") {
+		return nil
+	}
+	return errors.New("not confirmed")
+}
+
+// board initializes the PiFace board and cycles the relays and LEDs, the switch states are shown live
+func (d *diagnosis) board() {
+	pfd := piface.NewPiFaceDigital(spi.DEFAULT_HARDWARE_ADDR, spi.DEFAULT_BUS, spi.DEFAULT_CHIP)
+	if err := pfd.InitBoard(); err != nil {
+		d.add("board", err, "")
+		for _, name := range relayNames {
+			d.skip("relay "+name, "board not initialized")
+		}
+		d.skip("leds", "board not initialized")
+		d.skip("switches", "board not initialized")
+		return
+	}
+	d.add("board", nil, "initialized")
+	defer off(pfd)
+
+	for i, name := range relayNames {
+		d.add("relay "+name, d.output(pfd.Relays[i], fmt.Sprintf("Is the %s (relay %d) on?", name, i)), "")
+	}
+	var failed []string
+	for i := 0; i < 8; i++ {
+		if err := d.output(pfd.Leds[i], fmt.Sprintf("Is LED %d on?", i)); err != nil {
+			failed = append(failed, fmt.Sprintf("%d: %s", i, err))
+		}
+	}
+	if len(failed) > 0 {
+		d.add("leds", errors.New(strings.Join(failed, ", ")), "")
+	} else {
+		d.add("leds", nil, "8 LEDs")
+	}
+	d.switches(pfd)
+}
+
+// output switches a relay or LED on, reads it back and asks for confirmation
+func (d *diagnosis) output(o output, question string) error {
+	o.AllOn()
+	defer o.AllOff()
+	if o.Value() != 1 {
+		return errors.New("read back off after switching on")
+	}
+	return d.confirm(question)
+}
+
+// switches shows the states of the switches, interactive they are shown live for the wait time,
+// unattended nobody presses them and the check is skipped with the current states
+func (d *diagnosis) switches(pfd *piface.PiFaceDigital) {
+	states := func() string {
+		s := make([]string, len(switchNames))
+		for i, name := range switchNames {
+			state := "released"
+			// the switches are pulled down if pressed
+			if pfd.Switches[i].Value() == byte(0) {
+				state = "pressed"
+			}
+			s[i] = fmt.Sprintf("%s: %s", name, state)
+		}
+		return strings.Join(s, ", ")
+	}
+	if d.interactive {
+		fmt.Fprintf(d.out, "Press the switches, their states are shown for %s\n", d.wait)
+		for deadline := time.Now().Add(d.wait); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+			fmt.Fprintf(d.out, "\r%s   ", states())
+		}
+		fmt.Fprintln(d.out)
+	}
+	if !d.interactive {
+		d.skip("switches", "unattended, "+states())
+		return
+	}
+	d.add("switches", d.confirm("Did the states follow the switches?"), states())
+}
+
+// keypad checks that the keypad device is found, interactive the keys pressed are echoed for the wait time
+func (d *diagnosis) keypad(name string) {
+	if len(name) == 0 {
+		d.skip("keypad", "no device given")
+		return
+	}
+	dev, err := findInputDevice(name)
+	if err != nil {
+		d.add("keypad", err, "")
+		return
+	}
+	// closed by the timer or on return, whichever comes first
+	var once sync.Once
+	closeDevice := func() {
+		once.Do(func() { dev.File.Close() })
+	}
+	defer closeDevice()
+	if !d.interactive {
+		d.add("keypad", nil, dev.Fn)
+		return
+	}
+	fmt.Fprintf(d.out, "Press keys on the keypad, they are echoed for %s\n", d.wait)
+	// closing the device unblocks ReadOne
+	timer := time.AfterFunc(d.wait, closeDevice)
+	defer timer.Stop()
+	for {
+		ev, err := dev.ReadOne()
+		if err != nil {
+			break
+		}
+		if ev.Type != evdev.EV_KEY {
+			continue
+		}
+		if kev := evdev.NewKeyEvent(ev); kev.State == evdev.KeyDown {
+			fmt.Fprintf(d.out, "key %d (scancode %d)\n", kev.Keycode, kev.Scancode)
+		}
+	}
+	d.add("keypad", d.confirm("Were the keys echoed?"), dev.Fn)
+}
+
+// findInputDevice returns the input device with name in its name,
+// devices that cannot be opened (e.g. permissions) are skipped and reported if none is found
+func findInputDevice(name string) (*evdev.InputDevice, error) {
+	paths, err := evdev.ListInputDevicePaths("/dev/input/event*")
+	if err != nil {
+		return nil, err
+	}
+	var skipped []string
+	for _, p := range paths {
+		dev, err := evdev.Open(p)
+		if err != nil {
+			skipped = append(skipped, err.Error())
+			continue
+		}
+		if strings.Contains(dev.Name, name) {
+			return dev, nil
+		}
+		dev.File.Close()
+	}
+	if len(skipped) > 0 {
+		return nil, fmt.Errorf("no input device %q found, not opened: %s", name, strings.Join(skipped, ", "))
+	}
+	return nil, fmt.Errorf("no input device %q found", name)
+}
+
+// ticker opens the serial port of the ticker and shows a test pattern
+func (d *diagnosis) ticker(device string) {
+	if len(device) == 0 {
+		d.skip("ticker", "no device given")
+		return
+	}
+	t, err := ticker.NewTicker(device, logging.Discard())
+	if err != nil {
+		d.add("ticker", err, "")
+		return
+	}
+	defer t.Close()
+	defer t.Stop()
+	if err := t.Update(testPattern("0123456789 ABCDEFGHIJKLMNOPQRSTUVWXYZ")); err != nil {
+		d.add("ticker", err, "")
+		return
+	}
+	d.add("ticker", d.confirm("Does the ticker show the test pattern?"), device)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// relay is an output reading back stuck if it does not switch
+type relay struct {
+	value byte
+	stuck bool
+}
+
+func (r *relay) AllOn() {
+	if !r.stuck {
+		r.value = 1
+	}
+}
+
+func (r *relay) AllOff()     { r.value = 0 }
+func (r *relay) Value() byte { return r.value }
+
+// testDiagnosis returns an interactive diagnosis answering with answers or an unattended one if answers is empty
+func testDiagnosis(answers ...string) *diagnosis {
+	return &diagnosis{
+		interactive: len(answers) > 0,
+		in:          bufio.NewReader(strings.NewReader(strings.Join(answers, "\n"))),
+		out:         io.Discard,
+		report:      report{Passed: true},
+	}
+}
+
+func TestOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		d       *diagnosis
+		stuck   bool
+		wantErr string
+	}{
+		{"unattended", testDiagnosis(), false, ""},
+		{"confirmed", testDiagnosis("y"), false, ""},
+		{"confirmed in words", testDiagnosis(" Yes "), false, ""},
+		{"not confirmed", testDiagnosis("n"), false, "not confirmed"},
+		{"no answer", testDiagnosis(""), false, "not confirmed"},
+		{"stuck", testDiagnosis("y"), true, "read back off after switching on"},
+	}
+	for _, tt := range tests {
+		r := &relay{stuck: tt.stuck}
+		err := tt.d.output(r, "Is the light on?")
+		if (err == nil && len(tt.wantErr) > 0) || (err != nil && err.Error() != tt.wantErr) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.wantErr)
+		}
+		if r.value != 0 {
+			t.Errorf("%s: output left on", tt.name)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	d := testDiagnosis()
+	d.add("board", nil, "initialized")
+	d.keypad("")
+	d.ticker("")
+	if !d.report.Passed {
+		t.Error("skipped checks failed the report")
+	}
+	d.add("relay light", errors.New("not confirmed"), "")
+	d.ticker(filepath.Join(t.TempDir(), "ttyUSB0"))
+	if d.report.Passed {
+		t.Error("failed check passed")
+	}
+	results := []string{}
+	for _, c := range d.report.Checks {
+		results = append(results, c.Name+" "+c.Result)
+	}
+	want := []string{"board pass", "keypad skip", "ticker skip", "relay light fail", "ticker fail"}
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("checks %q, want %q", results, want)
+	}
+	if c := d.report.Checks[3]; c.Detail != "not confirmed" {
+		t.Errorf("detail %q, want the error", c.Detail)
+	}
+}
@@ -1,13 +1,29 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"os"
 
 	"github.com/luismesas/goPi/piface"
 	"github.com/luismesas/goPi/spi"
 )
 
 func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [diag [flags]]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "without command all LEDs and relays are switched off")
+		fmt.Fprintln(os.Stderr, "diag runs the self-test of the hardware (see diag -h)")
+	}
+	flag.Parse()
+	switch flag.Arg(0) {
+	case "":
+	case "diag":
+		os.Exit(diag(flag.Args()[1:]))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 
 	// creates a new pifacedigital instance
 	pfd := piface.NewPiFaceDigital(spi.DEFAULT_HARDWARE_ADDR, spi.DEFAULT_BUS, spi.DEFAULT_CHIP)
@@ -19,6 +35,11 @@ func main() {
 		return
 	}
 
+	off(pfd)
+}
+
+// off switches all LEDs and relays off
+func off(pfd *piface.PiFaceDigital) {
 	for i := 0; i < 8; i++ {
 		pfd.Leds[i].AllOff()
 	}
@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/audit"
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/inbound"
+	"github.com/marcsauter/buzzer/pkg/logging"
+	"github.com/pressly/chi/render"
+)
+
+// actorAnonymous is the actor of the requests without authentication e.g. the sign-up
+const actorAnonymous = "anonymous"
+
+// maxAuditBody is the maximal size of a request body read to find the target of the request
+const maxAuditBody = 1 << 20
+
+// kinds of the targets, a path segment of the API maps to a kind
+var auditKinds = map[string]string{
+	"next":    "pitch",
+	"pitches": "pitch",
+	"signup":  "pitch",
+	"offers":  "pitch",
+	"inbound": "pitch",
+	"venues":  "venue",
+	"series":  "series",
+	"devices": "device",
+	"users":   "user",
+	"pins":    "pin",
+}
+
+// auditInfo is attached to the context of a request by audited, the authentication and the handlers fill it in
+type auditInfo struct {
+	actor   string
+	failed  string
+	details []string
+}
+
+type auditKey struct{}
+
+// auditRequest returns the audit info of the request, nil if the request is not audited
+func auditRequest(r *http.Request) *auditInfo {
+	a, _ := r.Context().Value(auditKey{}).(*auditInfo)
+	return a
+}
+
+// auditActor sets the authenticated user as actor of the request
+func auditActor(r *http.Request, username string) {
+	if a := auditRequest(r); a != nil {
+		a.actor = username
+	}
+}
+
+// auditLoginFailure records the username of a failed authentication
+func auditLoginFailure(r *http.Request, username string) {
+	if a := auditRequest(r); a != nil {
+		a.failed = username
+	}
+}
+
+// auditDetail adds a detail to the audit entry of the request e.g. the PIN used
+func auditDetail(r *http.Request, detail string) {
+	if a := auditRequest(r); a != nil {
+		a.details = append(a.details, detail)
+	}
+}
+
+// auditor records the authenticated mutating requests and the login failures in the audit log
+type auditor struct {
+	// serializes the snapshots of the targets and the appends, the handlers run concurrently
+	sync.Mutex
+	s   *store
+	log *audit.Log
+	// inbound are the mappings of the inbound endpoints by name to find the target pitch of a payload
+	inbound map[string]*inbound.Mapping
+}
+
+// audited records every authenticated request other than GET and HEAD with the changes of its target and every failed login,
+// requests without authentication e.g. the sign-up or an inbound request without valid signature are not recorded
+// so they cannot grow the log, the devices, PINs and releases are authenticated
+func audited(a *auditor) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info := &auditInfo{actor: actorAnonymous}
+			r = r.WithContext(context.WithValue(r.Context(), auditKey{}, info))
+			if r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS" {
+				next.ServeHTTP(w, r)
+				if len(info.failed) > 0 {
+					a.Lock()
+					a.record(r, info, "", http.StatusUnauthorized, nil)
+					a.Unlock()
+				}
+				return
+			}
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAuditBody))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			target, resolve := a.target(r, body)
+			a.Lock()
+			before := resolve()
+			a.Unlock()
+			rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(rec, r)
+			if len(info.failed) == 0 && info.actor == actorAnonymous {
+				return
+			}
+			a.Lock()
+			defer a.Unlock()
+			var diff map[string]audit.Change
+			if len(info.failed) == 0 {
+				if diff, err = audit.Diff(before, resolve()); err != nil {
+					a.s.requestLogger(r).Error("audit diff failed", "target", target, "error", err)
+				}
+			}
+			a.record(r, info, target, rec.code, diff)
+		})
+	}
+}
+
+// record appends the entry of the request to the audit log
+func (a *auditor) record(r *http.Request, info *auditInfo, target string, status int, diff map[string]audit.Change) {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	e := audit.Entry{
+		Actor:         info.actor,
+		IP:            ip,
+		Forwarded:     r.Header.Get("X-Forwarded-For"),
+		Device:        r.Header.Get(device.Header),
+		CorrelationID: logging.ID(r.Context()),
+		Action:        auditAction(r.Method, r.URL.Path),
+		Method:        r.Method,
+		Path:          r.URL.Path,
+		Target:        target,
+		Status:        status,
+		Detail:        strings.Join(info.details, ", "),
+		Diff:          diff,
+	}
+	if len(info.failed) > 0 {
+		e.Actor, e.Action, e.Target, e.Diff = info.failed, audit.ActionLoginFailure, "", nil
+	}
+	if _, err := a.log.Append(e); err != nil {
+		a.s.requestLogger(r).Error("writing audit log failed", "action", e.Action, "error", err)
+	}
+}
+
+// segments returns the segments of the path
+func segments(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+// auditAction returns the action of a request as <kind>.<verb>:
+// the verb is the last segment of a sub resource e.g. pitch.approve, device.events or pin.verify,
+// delete for DELETE and put for POST and PUT, a device is enrolled
+func auditAction(method, path string) string {
+	segs := segments(path)
+	kind, ok := auditKinds[segs[0]]
+	if !ok {
+		kind = segs[0]
+	}
+	if len(kind) == 0 {
+		kind = "root"
+	}
+	switch {
+	case segs[0] == "signup":
+		return "pitch.signup"
+	case segs[0] == "offers" && len(segs) > 2:
+		return "offer." + segs[2]
+	case len(segs) > 2:
+		return kind + "." + segs[2]
+	case segs[0] == "pins" && len(segs) == 2 && segs[1] == "verify":
+		return "pin.verify"
+	case method == "DELETE":
+		return kind + ".delete"
+	case kind == "device":
+		return "device.enroll"
+	}
+	return kind + ".put"
+}
+
+// target returns the target of a request (see auditTarget), the target of an inbound request is the pitch
+// its payload is mapped to, the request is recorded before its signature is verified
+func (a *auditor) target(r *http.Request, body []byte) (string, func() json.RawMessage) {
+	segs := segments(r.URL.Path)
+	if segs[0] != "inbound" {
+		return a.s.auditTarget(r, body)
+	}
+	none := func() json.RawMessage { return nil }
+	if len(segs) != 2 || a.inbound[segs[1]] == nil {
+		return "", none
+	}
+	id, err := a.inbound[segs[1]].ID(body)
+	if err != nil {
+		return "", none
+	}
+	return "pitch/" + id, func() json.RawMessage { return a.s.auditState("pitch", id) }
+}
+
+// auditTarget returns the target of a request as <kind>/<id> and a function returning its state as JSON,
+// the id is taken from the path or from the body, the target of an event reported by a device are the pitches of its venue
+func (s *store) auditTarget(r *http.Request, body []byte) (string, func() json.RawMessage) {
+	none := func() json.RawMessage { return nil }
+	segs := segments(r.URL.Path)
+	kind, ok := auditKinds[segs[0]]
+	if !ok {
+		return "", none
+	}
+	id := ""
+	if len(segs) > 1 {
+		id = segs[1]
+	}
+	switch {
+	case kind == "pin" && id == "verify":
+		return "", none
+	case segs[0] == "offers":
+		s.Lock()
+		if rec := s.offered(id); rec != nil {
+			id = rec.ID
+		} else {
+			id = ""
+		}
+		s.Unlock()
+	case kind == "device" && len(segs) > 2 && segs[2] == "events":
+		venue := s.DeviceVenue(id)
+		return "schedule/" + venue, func() json.RawMessage { return s.auditSchedule(venue) }
+	case len(id) == 0:
+		id = bodyID(r, body, kind)
+	}
+	if len(id) == 0 {
+		return "", none
+	}
+	return kind + "/" + id, func() json.RawMessage { return s.auditState(kind, id) }
+}
+
+// bodyID returns the id of the target in the body of the request: id of pitches, venues and series, name of devices,
+// users and PINs and slot of a sign-up
+func bodyID(r *http.Request, body []byte, kind string) string {
+	field := "id"
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/signup"):
+		field = "slot"
+	case kind == "device" || kind == "user" || kind == "pin":
+		field = "name"
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		values, _ := url.ParseQuery(string(body))
+		return values.Get(field)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+	switch id := fields[field].(type) {
+	case string:
+		return id
+	case float64:
+		return strconv.FormatFloat(id, 'f', -1, 64)
+	}
+	return ""
+}
+
+// fingerprint returns a short hash of a password or PIN hash, it shows a change without revealing the hash
+func fingerprint(hash []byte) string {
+	sum := sha256.Sum256(hash)
+	return hex.EncodeToString(sum[:4])
+}
+
+// auditState returns the state of the target as JSON, null if it does not exist,
+// offer tokens and hashes of passwords and PINs are left out
+func (s *store) auditState(kind, id string) json.RawMessage {
+	s.Lock()
+	defer s.Unlock()
+	var v interface{}
+	switch kind {
+	case "pitch":
+		if r, ok := s.records[id]; ok {
+			v = auditRecord(r)
+		}
+	case "venue":
+		if venue, ok := s.venues[id]; ok {
+			v = venue
+		}
+	case "series":
+		if sr, ok := s.series[id]; ok {
+			v = sr
+		}
+	case "device":
+		if d, ok := s.devices[id]; ok {
+			v = struct {
+				device.Device
+				Commands []device.Command `json:"commands,omitempty"`
+			}{*d, s.commands[id]}
+		}
+	case "user":
+		if u, ok := s.users[id]; ok {
+			v = map[string]string{"username": u.Username, "password": fingerprint(u.Hash)}
+		}
+	case "pin":
+		if p, ok := s.pins[id]; ok {
+			v = map[string]string{"name": p.Name, "pin": fingerprint(p.Hash)}
+		}
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// auditSchedule returns the pitches in venue as JSON object by id
+func (s *store) auditSchedule(venue string) json.RawMessage {
+	s.Lock()
+	defer s.Unlock()
+	pitches := make(map[string]*record)
+	for id, r := range s.records {
+		if r.At(venue) {
+			pitches[id] = auditRecord(r)
+		}
+	}
+	data, _ := json.Marshal(pitches)
+	return data
+}
+
+// auditRecord returns a copy of the record without the token of the offer
+func auditRecord(r *record) *record {
+	c := *r
+	if c.Offer != nil {
+		o := *c.Offer
+		o.Token = ""
+		c.Offer = &o
+	}
+	return &c
+}
+
+// auditFilter returns the filter given by ?actor=, ?action=, ?target=, ?from=, ?to= (RFC 3339 or dates e.g. 2026-01-31, to is exclusive)
+// and ?limit= (default: 100)
+func auditFilter(r *http.Request) (audit.Filter, error) {
+	q := r.URL.Query()
+	f := audit.Filter{Actor: q.Get("actor"), Action: q.Get("action"), Target: q.Get("target"), Limit: 100}
+	if v := q.Get("limit"); len(v) > 0 {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return f, fmt.Errorf("limit: %q is not a number", v)
+		}
+		f.Limit = limit
+	}
+	for _, t := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		v := q.Get(t.name)
+		if len(v) == 0 {
+			continue
+		}
+		var err error
+		if *t.t, err = time.Parse(time.RFC3339, v); err != nil {
+			if *t.t, err = time.Parse("2006-01-02", v); err != nil {
+				return f, fmt.Errorf("%s: %q is not a date e.g. 2026-01-31 or a time e.g. 2026-01-31T18:00:00Z", t.name, v)
+			}
+		}
+	}
+	return f, nil
+}
+
+// listAudit returns the entries of the audit log selected by the query (see auditFilter)
+func listAudit(a *auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f, err := auditFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		entries, err := a.log.Entries(f)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, entries)
+	}
+}
+
+// verifyAudit verifies the hash chain of the audit log
+func verifyAudit(a *auditor) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v, err := a.log.Verify()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !v.Valid {
+			a.s.requestLogger(r).Error("audit log chain broken", "error", v.Error)
+		}
+		render.JSON(w, r, v)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/audit"
+	"github.com/marcsauter/buzzer/pkg/inbound"
+	"github.com/marcsauter/buzzer/pkg/webhook"
+	"github.com/pressly/chi"
+)
+
+// bookingMapping is the mapping of the inbound endpoint booking
+const bookingMapping = `
+- name: booking
+  secret: s3cr3t
+  fields:
+    id: $.booking.id
+    speaker: $.booking.customer['full name']
+    title: $.booking.items[0].title
+    date: $.booking.start
+    timezone: Europe/Zurich
+  date-format: "2006-01-02 15:04"
+`
+
+// testMappings returns the mappings of the inbound endpoints defined in content
+func testMappings(t *testing.T, content string) []*inbound.Mapping {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "inbound.yaml")
+	if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mappings, err := inbound.Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mappings
+}
+
+// signed returns a request to the inbound endpoint signed with secret
+func signed(name, secret, body string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/inbound/"+name, strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	ts := time.Now().Unix()
+	r.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(ts, 10))
+	r.Header.Set(webhook.HeaderSignature, webhook.Sign(secret, ts, []byte(body)))
+	return r
+}
+
+func TestAuditInbound(t *testing.T) {
+	s := testStore(t)
+	log, err := audit.Open(filepath.Join(t.TempDir(), "buzzer.audit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mappings := testMappings(t, bookingMapping)
+	a := &auditor{s: s, log: log, inbound: inboundMappings(mappings)}
+	router := chi.NewRouter()
+	router.Use(audited(a))
+	router.Post("/inbound/:name", postInbound(s, mappings, time.UTC))
+
+	body := `{"booking": {"id": 7, "customer": {"full name": "Jane"}, "items": [{"title": "Go"}], "start": "2030-03-30 17:30"}}`
+	for i, title := range []string{"Go", "Rust"} {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, signed("booking", "s3cr3t", strings.Replace(body, `"Go"`, `"`+title+`"`, 1)))
+		if w.Code != http.StatusOK && w.Code != http.StatusCreated {
+			t.Fatalf("push %d: status %d: %s", i, w.Code, w.Body)
+		}
+	}
+	// not signed, not recorded
+	w := httptest.NewRecorder()
+	if router.ServeHTTP(w, signed("booking", "wrong", body)); w.Code != http.StatusUnauthorized {
+		t.Errorf("status %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+
+	entries, err := log.Entries(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(entries))
+	}
+	for _, e := range entries {
+		if e.Action != "pitch.put" || e.Target != "pitch/booking-7" {
+			t.Errorf("entry %+v, want pitch.put of pitch/booking-7", e)
+		}
+	}
+	if e := entries[0]; e.Actor != "inbound:booking" || e.Status != http.StatusCreated || string(e.Diff["speaker"].After) != `"Jane"` {
+		t.Errorf("entry %+v, want the created pitch", e)
+	}
+	if e := entries[1]; string(e.Diff["title"].Before) != `"Go"` || string(e.Diff["title"].After) != `"Rust"` {
+		t.Errorf("diff %v, want the title changed", e.Diff)
+	}
+}
+
+func TestAudited(t *testing.T) {
+	s := testStore(t)
+	log, err := audit.Open(filepath.Join(t.TempDir(), "buzzer.audit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := &auditor{s: s, log: log}
+	entered, release := make(chan struct{}), make(chan struct{})
+	router := chi.NewRouter()
+	router.Use(audited(a))
+	router.Post("/signup", func(w http.ResponseWriter, r *http.Request) {})
+	router.Group(func(r chi.Router) {
+		r.Use(basicAuth("buzzer", func(username, password string) bool { return password == "s3cr3t" }))
+		r.Post("/pitches", createPitch(s))
+		r.Post("/devices", func(w http.ResponseWriter, r *http.Request) {
+			entered <- struct{}{}
+			<-release
+		})
+	})
+	post := func(path, username, password, body string) int {
+		r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if len(username) > 0 {
+			r.SetBasicAuth(username, password)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// a handler blocking does not block the others
+	done := make(chan struct{})
+	go func() {
+		post("/devices", "marc", "s3cr3t", `{"name": "buzzer1"}`)
+		close(done)
+	}()
+	<-entered
+	date := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if code := post("/pitches", "marc", "s3cr3t", `{"id": "42", "speaker": "Jane", "title": "Go", "date": "`+date+`"}`); code != http.StatusCreated {
+		t.Errorf("status %d, want %d", code, http.StatusCreated)
+	}
+	close(release)
+	<-done
+
+	// not authenticated, not recorded
+	post("/signup", "", "", `{"slot": "42"}`)
+	post("/pitches", "", "", `{"id": "43"}`)
+	// failed login
+	post("/pitches", "eve", "guess", `{"id": "43"}`)
+
+	entries, err := log.Entries(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ actor, action, target string }{
+		{"marc", "pitch.put", "pitch/42"},
+		{"marc", "device.enroll", "device/buzzer1"},
+		{"eve", audit.ActionLoginFailure, ""},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("%d entries, want %d: %+v", len(entries), len(want), entries)
+	}
+	for i, w := range want {
+		if e := entries[i]; e.Actor != w.actor || e.Action != w.action || e.Target != w.target {
+			t.Errorf("entry %d: %s %s %s, want %s %s %s", i, e.Actor, e.Action, e.Target, w.actor, w.action, w.target)
+		}
+	}
+	if len(entries[0].Diff) == 0 {
+		t.Errorf("entry %+v without the created pitch", entries[0])
+	}
+}
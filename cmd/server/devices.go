@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+// errDeviceNotFound is returned for an unknown device
+var errDeviceNotFound = errors.New("device not found")
+
+// RegisterDevice adds or updates a device and binds it to its venue
+func (s *store) RegisterDevice(d device.Device) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.venues[d.Venue]; len(d.Venue) > 0 && !ok {
+		return fmt.Errorf("no such venue: %s", d.Venue)
+	}
+	d.LastSeen = time.Now()
+	s.devices[d.Name] = &d
+	s.save()
+	return nil
+}
+
+// Heartbeat updates the last seen time of a device, an unknown device or a device with a changed address or venue
+// is registered like RegisterDevice, it returns true if the device was registered
+func (s *store) Heartbeat(d device.Device) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	if known, ok := s.devices[d.Name]; ok && known.IP == d.IP && known.Venue == d.Venue {
+		known.LastSeen = time.Now()
+		return false, nil
+	}
+	if _, ok := s.venues[d.Venue]; len(d.Venue) > 0 && !ok {
+		return false, fmt.Errorf("no such venue: %s", d.Venue)
+	}
+	d.LastSeen = time.Now()
+	s.devices[d.Name] = &d
+	s.save()
+	return true, nil
+}
+
+// Devices returns all devices bound to venue ordered by name, empty for all devices
+func (s *store) Devices(venue string) []device.Device {
+	s.Lock()
+	defer s.Unlock()
+	devices := make([]device.Device, 0, len(s.devices))
+	for _, d := range s.devices {
+		if len(venue) == 0 || d.Venue == venue {
+			devices = append(devices, *d)
+		}
+	}
+	sort.Slice(devices, func(i, j int) bool { return devices[i].Name < devices[j].Name })
+	return devices
+}
+
+// QueueCommand queues a command for a device
+func (s *store) QueueCommand(name string, c device.Command) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.devices[name]; !ok {
+		return fmt.Errorf("device %s not found", name)
+	}
+	c.Sent = time.Now()
+	s.commands[name] = append(s.commands[name], c)
+	return nil
+}
+
+// Commands returns and removes the queued commands of a device
+func (s *store) Commands(name string) []device.Command {
+	s.Lock()
+	defer s.Unlock()
+	commands := s.commands[name]
+	delete(s.commands, name)
+	if d, ok := s.devices[name]; ok {
+		d.LastSeen = time.Now()
+	}
+	if commands == nil {
+		commands = []device.Command{}
+	}
+	return commands
+}
+
+// registerDevice adds or updates a device
+func registerDevice(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var d device.Device
+		if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(d.Name) == 0 {
+			http.Error(w, "device name missing", http.StatusUnprocessableEntity)
+			return
+		}
+		if err := s.RegisterDevice(d); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		render.JSON(w, r, d)
+	}
+}
+
+// listDevices returns all devices or the devices bound to the venue given by ?venue=
+func listDevices(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, s.Devices(r.URL.Query().Get("venue")))
+	}
+}
+
+// sendCommand queues a command for a device
+func sendCommand(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var c device.Command
+		if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch c.Name {
+		case device.CommandRelease, device.CommandOff:
+		default:
+			http.Error(w, fmt.Sprintf("no such command: %s", c.Name), http.StatusUnprocessableEntity)
+			return
+		}
+		if err := s.QueueCommand(chi.URLParam(r, "name"), c); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// pollCommands returns the queued commands of a device
+func pollCommands(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, s.Commands(chi.URLParam(r, "name")))
+	}
+}
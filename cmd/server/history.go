@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+// releaseWindow is the maximum time between the date of a pitch and a release or time-up reported by a device
+const releaseWindow = 2 * time.Hour
+
+// event is an entry of the history with its pitch
+type event struct {
+	Pitch string `json:"pitch"`
+	pitch.HistoryEntry
+}
+
+// scheduled returns true if the pitch has a speaker and was not rejected or is pending, i.e. it is expected to take place
+func (r *record) scheduled() bool {
+	switch r.Status {
+	case "", pitch.StatusApproved:
+		return !r.Open()
+	}
+	return false
+}
+
+// released returns the pitch in venue a release reported at t belongs to:
+// the scheduled pitch not yet released with the date closest to t within the release window, the caller has to hold the lock
+func (s *store) released(venue string, t time.Time) *record {
+	var found *record
+	var distance time.Duration
+	for _, r := range s.records {
+		if !r.At(venue) || !r.scheduled() || r.Released {
+			continue
+		}
+		d := t.Sub(r.Date)
+		if d < 0 {
+			d = -d
+		}
+		if d <= releaseWindow && (found == nil || d < distance) {
+			found, distance = r, d
+		}
+	}
+	return found
+}
+
+// running returns the pitch in venue a time-up reported at t belongs to:
+// the pitch released last before t within the release window without time-up, the caller has to hold the lock
+func (s *store) running(venue string, t time.Time) *record {
+	var found *record
+	for _, r := range s.records {
+		if !r.At(venue) || !r.Released || r.ReleasedAt.After(t) || t.Sub(r.ReleasedAt) > releaseWindow || r.timeUp() {
+			continue
+		}
+		if found == nil || r.ReleasedAt.After(found.ReleasedAt) {
+			found = r
+		}
+	}
+	return found
+}
+
+// timeUp returns true if a time-up was reported for the pitch
+func (r *record) timeUp() bool {
+	for _, h := range r.History {
+		if h.Event == pitch.HistoryTimeUp {
+			return true
+		}
+	}
+	return false
+}
+
+// Report records an event reported by a device in the history of the pitch it belongs to (see released and running)
+// and returns the pitch, a release sets Released and ReleasedAt
+func (s *store) Report(name string, e device.Event) (pitch.Pitch, error) {
+	s.Lock()
+	defer s.Unlock()
+	d, ok := s.devices[name]
+	if !ok {
+		return pitch.Pitch{}, errDeviceNotFound
+	}
+	d.LastSeen = time.Now()
+	var r *record
+	switch e.Name {
+	case device.EventReleased:
+		if r = s.released(d.Venue, e.Time); r != nil {
+			r.Released, r.ReleasedAt = true, e.Time.UTC()
+		}
+	case device.EventTimeUp:
+		r = s.running(d.Venue, e.Time)
+	default:
+		return pitch.Pitch{}, fmt.Errorf("no such event: %s", e.Name)
+	}
+	if r == nil {
+		return pitch.Pitch{}, errPitchNotFound
+	}
+	s.history(r, pitch.HistoryEntry{Time: e.Time.UTC(), Event: e.Name, Date: r.Date, Speaker: r.Speaker, Title: r.Title, Device: name})
+	s.save()
+	return s.withVenue(r.Pitch), nil
+}
+
+// Events returns the history of the pitches in venue between from and to ordered by time, zero times are not limited
+func (s *store) Events(venue string, from, to time.Time) []event {
+	s.Lock()
+	defer s.Unlock()
+	events := []event{}
+	for _, r := range s.records {
+		if !r.At(venue) {
+			continue
+		}
+		for _, h := range r.History {
+			if (!from.IsZero() && h.Time.Before(from)) || (!to.IsZero() && !h.Time.Before(to)) {
+				continue
+			}
+			events = append(events, event{Pitch: r.ID, HistoryEntry: h})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].Time.Before(events[j].Time) })
+	return events
+}
+
+// reportEvent records an event reported by the device
+func reportEvent(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var e device.Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if e.Time.IsZero() {
+			e.Time = time.Now()
+		}
+		p, err := s.Report(chi.URLParam(r, "name"), e)
+		switch {
+		case err == errPitchNotFound || err == errDeviceNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		s.requestLogger(r).Info("event reported", "event", e.Name, "pitch", p.ID)
+		auditDetail(r, fmt.Sprintf("%s pitch %s", e.Name, p.ID))
+		render.JSON(w, r, p)
+	}
+}
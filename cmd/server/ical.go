@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/i18n"
+	"github.com/marcsauter/buzzer/pkg/ical"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// calendar imports pitches from an iCalendar file or URL
+type calendar struct {
+	source   string
+	speaker  string
+	venue    string
+	location *time.Location
+	horizon  time.Duration
+	client   *http.Client
+	mutex    sync.Mutex
+	synced   time.Time
+	err      error
+}
+
+// newCalendar returns a new calendar, speaker is the name of the property mapped to Pitch.Speaker,
+// the pitches take place in venue, times without timezone are in loc, the instances of recurring events
+// are imported for the horizon
+func newCalendar(source, speaker, venue string, loc *time.Location, horizon time.Duration) *calendar {
+	return &calendar{
+		source:   source,
+		speaker:  speaker,
+		venue:    venue,
+		location: loc,
+		horizon:  horizon,
+		client:   &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// open returns a reader for the calendar file or URL
+func (c *calendar) open() (io.ReadCloser, error) {
+	u, err := url.Parse(c.source)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return os.Open(c.source)
+	}
+	resp, err := c.client.Get(c.source)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %s", c.source, resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// read returns the pitches of the calendar, cancelled events are omitted
+// a recurring event is a pitch per instance from now until the horizon (see ical.Event.ID),
+// recurring events not supported are logged to logger and skipped
+func (c *calendar) read(now time.Time, logger *slog.Logger) ([]*record, error) {
+	r, err := c.open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	events, err := ical.Parse(r, c.location)
+	if err != nil {
+		return nil, err
+	}
+	events, err = ical.Expand(events, now, now.Add(c.horizon))
+	if err != nil {
+		logger.Warn("calendar events skipped", "source", c.source, "error", err)
+	}
+	records := []*record{}
+	for _, e := range events {
+		if len(e.UID) == 0 || e.Status == "CANCELLED" {
+			continue
+		}
+		// the timezone of the event (TZID) or the calendar
+		timezone := e.Properties["DTSTART"].Params["TZID"]
+		if len(timezone) == 0 {
+			timezone = c.location.String()
+		}
+		records = append(records, &record{
+			Pitch: pitch.Pitch{
+				ID:       e.ID(),
+				Speaker:  e.Field(c.speaker),
+				Title:    e.Summary,
+				Date:     e.Start.UTC(),
+				Timezone: timezone,
+				Venue:    c.venue,
+			},
+			Source:   sourceICal,
+			Sequence: e.Sequence,
+			Modified: e.Modified(),
+		})
+	}
+	return records, nil
+}
+
+// Sync imports the calendar into the schedule every interval until ctx is done,
+// fn is called for every offer of a slot cancelled in the calendar
+func (c *calendar) Sync(ctx context.Context, s *store, interval time.Duration, fn func(pitch.Pitch, *pitch.Offer)) error {
+	update := func() {
+		now := time.Now()
+		records, err := c.read(now, s.logger)
+		c.mutex.Lock()
+		c.err = err
+		c.mutex.Unlock()
+		if err != nil {
+			s.logger.Error("reading calendar failed", "source", c.source, "error", err)
+			return
+		}
+		s.Sync(records, now, fn)
+		c.mutex.Lock()
+		c.synced = time.Now()
+		c.mutex.Unlock()
+	}
+	update()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			update()
+		}
+	}
+}
+
+// Check returns the error of the last import, the calendar is not ready before it was imported once
+func (c *calendar) Check() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	switch {
+	case c.err != nil:
+		return c.err
+	case c.synced.IsZero():
+		return errors.New("not imported yet")
+	}
+	return nil
+}
+
+// Revision returns the sequence and the time of the last modification of the pitch with the given id
+// e.g. for calendar clients to pick up a rescheduled pitch
+func (s *store) Revision(id string) (int, time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return 0, time.Time{}
+	}
+	return r.Sequence, r.Modified
+}
+
+// icalHandler serves the schedule or the pitches in the venue given by ?venue= as iCalendar for subscriptions
+func icalHandler(s *store, locale *i18n.Locale) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cal := ical.Calendar{
+			ProdID: "-//marcsauter//buzzer//EN",
+			Name:   locale.T("calendar.name"),
+		}
+		now := time.Now()
+		for _, p := range s.PublicPitches(r.URL.Query().Get("venue")) {
+			sequence, modified := s.Revision(p.ID)
+			cal.Events = append(cal.Events, ical.Event{
+				UID:          p.ID,
+				Summary:      p.Title,
+				Description:  p.Speaker,
+				Location:     p.VenueName,
+				Start:        p.Date,
+				Sequence:     sequence,
+				Stamp:        now,
+				LastModified: modified,
+			})
+		}
+		w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+		if _, err := cal.WriteTo(w); err != nil {
+			s.requestLogger(r).Error("writing calendar failed", "error", err)
+		}
+	}
+}
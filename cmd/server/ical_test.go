@@ -0,0 +1,182 @@
+package main
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/i18n"
+	"github.com/marcsauter/buzzer/pkg/ical"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/marcsauter/buzzer/pkg/webhook"
+)
+
+// imported returns a pitch imported from the calendar
+func imported(id, title string, date time.Time, sequence int, modified time.Time) *record {
+	return &record{
+		Pitch:    pitch.Pitch{ID: id, Speaker: "Marc", Title: title, Date: date.UTC(), Timezone: "Europe/Zurich"},
+		Source:   sourceICal,
+		Sequence: sequence,
+		Modified: modified,
+	}
+}
+
+func TestCalendarRead(t *testing.T) {
+	c := newCalendar("../../pkg/ical/testdata/schedule.ics", "DESCRIPTION", "pflab", time.UTC, 8*7*24*time.Hour)
+	records, err := c.read(time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	pitches := make(map[string]pitch.Pitch)
+	for _, r := range records {
+		ids = append(ids, r.ID)
+		pitches[r.ID] = r.Pitch
+	}
+	want := []string{
+		"201701@pflab.ch",
+		"weekly@pflab.ch-20170105T173000Z",
+		"weekly@pflab.ch-20170112T173000Z",
+		"weekly@pflab.ch-20170202T173000Z",
+		"weekly@pflab.ch-20170209T173000Z",
+		"weekly@pflab.ch-20170126T173000Z",
+		"floating@pflab.ch",
+	}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("pitches %q, want %q", ids, want)
+	}
+	p := pitches["weekly@pflab.ch-20170126T173000Z"]
+	if p.Speaker != "Jane" || p.Title != "Thursday pitch (late)" || !p.Date.Equal(time.Date(2017, 1, 26, 18, 0, 0, 0, time.UTC)) {
+		t.Errorf("overridden instance %+v", p)
+	}
+	if p.Timezone != "Europe/Zurich" || p.Venue != "pflab" {
+		t.Errorf("timezone %s, venue %s", p.Timezone, p.Venue)
+	}
+	if p := pitches["floating@pflab.ch"]; p.Timezone != "UTC" {
+		t.Errorf("timezone %s of floating time, want the calendar's", p.Timezone)
+	}
+}
+
+func TestSyncConflicts(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	date := now.Add(48 * time.Hour)
+	s.Sync([]*record{imported("1", "first", date, 1, now.Add(-time.Hour))}, now, nil)
+
+	tests := []struct {
+		name      string
+		title     string
+		date      time.Time
+		sequence  int
+		modified  time.Time
+		wantTitle string
+	}{
+		{"not modified since", "older", date, 1, now.Add(-2 * time.Hour), "first"},
+		{"lower sequence", "lower", date, 0, now, "first"},
+		{"modified", "second", date.Add(time.Hour), 2, now, "second"},
+		{"modified locally since", "third", date, 2, now.Add(-time.Minute), "second"},
+	}
+	for _, tt := range tests {
+		s.Sync([]*record{imported("1", tt.title, tt.date, tt.sequence, tt.modified)}, now, nil)
+		if p, _ := s.Pitch("1"); p.Title != tt.wantTitle {
+			t.Errorf("%s: title %q, want %q", tt.name, p.Title, tt.wantTitle)
+		}
+	}
+	if want := []string{pitch.HistoryCreated, pitch.HistoryRescheduled}; !reflect.DeepEqual(events(s, "1"), want) {
+		t.Errorf("history %q, want %q", events(s, "1"), want)
+	}
+}
+
+func TestSyncRemoved(t *testing.T) {
+	s := testStore(t)
+	published := []string{}
+	s.Observe(func(p pitch.Pitch, h pitch.HistoryEntry) {
+		if event, ok := webhookEvent(p, h); ok && p.ID == "future" {
+			published = append(published, event)
+		}
+	})
+	now := time.Now()
+	modified := now.Add(-time.Hour)
+	s.Sync([]*record{
+		imported("past", "past", now.Add(-time.Hour), 0, modified),
+		imported("future", "future", now.Add(time.Hour), 0, modified),
+		imported("waitlist", "waitlist", now.Add(2*time.Hour), 0, modified),
+	}, now, nil)
+	s.Put(pitch.Pitch{ID: "api", Speaker: "Anna", Title: "api", Date: now.Add(3 * time.Hour).UTC(), Timezone: "Europe/Zurich"})
+	if _, waitlisted, err := s.SignUp(signUp{Slot: "waitlist", Speaker: "Jane", Title: "Go", Contact: "jane@example.com"}, now); err != nil || !waitlisted {
+		t.Fatalf("sign-up: %v", err)
+	}
+
+	offers := []*pitch.Offer{}
+	offer := func(p pitch.Pitch, o *pitch.Offer) { offers = append(offers, o) }
+	s.Sync(nil, now, offer)
+	// nothing changes the second time
+	s.Sync(nil, now, offer)
+
+	if p, _ := s.Pitch("past"); p.Status == pitch.StatusCancelled || len(events(s, "past")) != 1 {
+		t.Errorf("past pitch %+v changed", p)
+	}
+	if p, _ := s.Pitch("api"); p.Status == pitch.StatusCancelled {
+		t.Errorf("pitch %+v of the API cancelled", p)
+	}
+	p, ok := s.Pitch("future")
+	if !ok || p.Status != pitch.StatusCancelled || p.Speaker != "Marc" {
+		t.Errorf("future pitch %+v, want kept as cancelled", p)
+	}
+	if want := []string{pitch.HistoryCreated, pitch.HistoryCancelled}; !reflect.DeepEqual(events(s, "future"), want) {
+		t.Errorf("history %q, want %q", events(s, "future"), want)
+	}
+	if want := []string{webhook.EventScheduled, webhook.EventCancelled}; !reflect.DeepEqual(published, want) {
+		t.Errorf("events %q, want %q", published, want)
+	}
+	if len(offers) != 1 || offers[0].Speaker != "Jane" {
+		t.Errorf("offers %+v, want one to Jane", offers)
+	}
+	if p, _ := s.Pitch("waitlist"); p.Status != pitch.StatusOffered {
+		t.Errorf("status %q of the slot with a waitlist, want offered", p.Status)
+	}
+}
+
+func TestICalHandler(t *testing.T) {
+	s := testStore(t)
+	date := time.Now().Add(48 * time.Hour).UTC().Truncate(time.Second)
+	addPitch(t, s, "42", "Marc", date)
+	locale, err := i18n.New(i18n.DefaultLanguage, i18n.DefaultTimezone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func() ical.Event {
+		t.Helper()
+		w := httptest.NewRecorder()
+		icalHandler(s, locale)(w, httptest.NewRequest(http.MethodGet, "/pitches.ics", nil))
+		events, err := ical.Parse(strings.NewReader(w.Body.String()), time.UTC)
+		if err != nil || len(events) != 1 {
+			t.Fatalf("events %+v, %v, want 42", events, err)
+		}
+		return events[0]
+	}
+
+	e := get()
+	_, modified := s.Revision("42")
+	if e.UID != "42" || e.Sequence != 0 || !e.LastModified.Equal(modified.UTC().Truncate(time.Second)) {
+		t.Errorf("event %s sequence %d modified %s, want 42 modified %s", e.UID, e.Sequence, e.LastModified, modified)
+	}
+	// rescheduled
+	p, _ := s.Pitch("42")
+	p.Date = date.Add(time.Hour)
+	s.Put(p)
+	if e := get(); e.Sequence != 1 || !e.Start.Equal(p.Date) || e.LastModified.Before(modified.Truncate(time.Second)) {
+		t.Errorf("event sequence %d start %s modified %s, want the rescheduled pitch", e.Sequence, e.Start, e.LastModified)
+	}
+	// changed otherwise
+	p.Title = "Go"
+	s.Put(p)
+	if e := get(); e.Sequence != 1 || e.Summary != "Go" {
+		t.Errorf("event sequence %d summary %s, want 1 Go", e.Sequence, e.Summary)
+	}
+}
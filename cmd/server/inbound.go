@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/inbound"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/marcsauter/buzzer/pkg/webhook"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+// inboundTolerance is the maximal age of the timestamp of a signed inbound request
+const inboundTolerance = 5 * time.Minute
+
+// inboundMappings returns the mappings by name
+func inboundMappings(mappings []*inbound.Mapping) map[string]*inbound.Mapping {
+	byName := make(map[string]*inbound.Mapping)
+	for _, m := range mappings {
+		byName[m.Name] = m
+	}
+	return byName
+}
+
+// postInbound maps the payload pushed to the inbound endpoint to a pitch, validates it like a pitch posted to the API
+// and adds or updates it by its external id unless it was changed otherwise since the last push (409, see store.Push),
+// the request has to be signed with the secret of the mapping (see webhook.Verify)
+func postInbound(s *store, mappings []*inbound.Mapping, fallback *time.Location) http.HandlerFunc {
+	byName := inboundMappings(mappings)
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		name := chi.URLParam(r, "name")
+		m, ok := byName[name]
+		if !ok {
+			http.Error(w, "no such inbound endpoint: "+name, http.StatusNotFound)
+			return
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxAuditBody))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := webhook.Verify(m.Secret, r, body, inboundTolerance); err != nil {
+			s.requestLogger(r).Warn("inbound request rejected", "inbound", name, "error", err)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		auditActor(r, "inbound:"+name)
+		values, err := m.Values(body, fallback)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		p, err := pitch.Bind(values)
+		if err == nil {
+			err = s.Validate(&p)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		auditDetail(r, "pitch "+p.ID)
+		added, err := s.Push(p, sourceInbound)
+		if err != nil {
+			s.requestLogger(r).Warn("inbound pitch rejected", "inbound", name, "pitch", p.ID, "error", err)
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if added {
+			render.Status(r, http.StatusCreated)
+		}
+		p, _ = s.Pitch(p.ID)
+		s.requestLogger(r).Info("inbound pitch", "inbound", name, "pitch", p.ID)
+		render.JSON(w, r, p)
+	}
+}
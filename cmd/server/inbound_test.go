@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/marcsauter/buzzer/pkg/webhook"
+	"github.com/pressly/chi"
+)
+
+// booking returns the payload of the booking tool
+func booking(title string) string {
+	return `{"booking": {"id": 7, "customer": {"full name": "Jane"}, "items": [{"title": "` + title + `"}], "start": "2030-03-30 17:30"}}`
+}
+
+func TestPostInbound(t *testing.T) {
+	s := testStore(t)
+	router := chi.NewRouter()
+	router.Post("/inbound/:name", postInbound(s, testMappings(t, bookingMapping), time.UTC))
+	push := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := push(signed("booking", "s3cr3t", booking("Go"))); w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	p, ok := s.Pitch("booking-7")
+	if !ok {
+		t.Fatal("pitch booking-7 not added")
+	}
+	zurich, _ := time.LoadLocation("Europe/Zurich")
+	if p.Speaker != "Jane" || p.Title != "Go" || !p.Date.Equal(time.Date(2030, 3, 30, 17, 30, 0, 0, zurich)) {
+		t.Errorf("pitch %+v, want Jane on Go at 17:30 in Zurich", p)
+	}
+	if w := push(signed("booking", "s3cr3t", booking("Rust"))); w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	if p, _ := s.Pitch("booking-7"); p.Title != "Rust" {
+		t.Errorf("title %s, want Rust", p.Title)
+	}
+
+	// changed through the API, the push is rejected until the booking tool pushes the same pitch
+	p, _ = s.Pitch("booking-7")
+	p.Title = "Zig"
+	s.Put(p)
+	if w := push(signed("booking", "s3cr3t", booking("Rust"))); w.Code != http.StatusConflict {
+		t.Errorf("status %d, want %d", w.Code, http.StatusConflict)
+	}
+	if p, _ := s.Pitch("booking-7"); p.Title != "Zig" {
+		t.Errorf("title %s, want the local change Zig", p.Title)
+	}
+	for _, title := range []string{"Zig", "Go"} {
+		if w := push(signed("booking", "s3cr3t", booking(title))); w.Code != http.StatusOK {
+			t.Fatalf("%s: status %d: %s", title, w.Code, w.Body)
+		}
+	}
+	if p, _ := s.Pitch("booking-7"); p.Title != "Go" {
+		t.Errorf("title %s, want Go", p.Title)
+	}
+
+	// not signed
+	old := signed("booking", "s3cr3t", booking("Go"))
+	ts := time.Now().Add(-2 * inboundTolerance).Unix()
+	old.Header.Set(webhook.HeaderTimestamp, strconv.FormatInt(ts, 10))
+	old.Header.Set(webhook.HeaderSignature, webhook.Sign("s3cr3t", ts, []byte(booking("Go"))))
+	unsigned := signed("booking", "s3cr3t", booking("Go"))
+	unsigned.Header.Del(webhook.HeaderSignature)
+	tampered := signed("booking", "s3cr3t", booking("Go"))
+	tampered.Body = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(booking("Rust"))).Body
+	tests := []struct {
+		name string
+		r    *http.Request
+		want int
+	}{
+		{"wrong secret", signed("booking", "wrong", booking("Rust")), http.StatusUnauthorized},
+		{"timestamp too old", old, http.StatusUnauthorized},
+		{"signature missing", unsigned, http.StatusUnauthorized},
+		{"body tampered", tampered, http.StatusUnauthorized},
+		{"unknown endpoint", signed("shop", "s3cr3t", booking("Rust")), http.StatusNotFound},
+		{"not valid", signed("booking", "s3cr3t", `{"booking": {"id": 7, "start": "30.3.2030"}}`), http.StatusUnprocessableEntity},
+	}
+	for _, tt := range tests {
+		if w := push(tt.r); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	if p, _ := s.Pitch("booking-7"); p.Title != "Go" {
+		t.Errorf("title %s, want Go", p.Title)
+	}
+}
+
+func TestPushSignedUp(t *testing.T) {
+	s := testStore(t)
+	date := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	slot := pitch.Pitch{ID: "booking-7", Title: "open", Date: date, Timezone: "Europe/Zurich"}
+	if _, err := s.Push(slot, sourceInbound); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.SignUp(signUp{Slot: "booking-7", Speaker: "Jane", Title: "Go", Contact: "jane@example.com"}, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	slot.Venue = "pflab"
+	if _, err := s.Push(slot, sourceInbound); err != errConflict {
+		t.Errorf("push of a slot signed up for: %v, want %v", err, errConflict)
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/logging"
+)
+
+// requestLogger returns the logger of the request with its correlation id and device (see logRequests)
+func (s *store) requestLogger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context(), s.logger)
+}
+
+// logRequests attaches a logger with the correlation id and the device of the request to its context and logs the request,
+// the correlation id is taken from the request (e.g. of a poll) or created and returned in the response
+func logRequests(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			id := r.Header.Get(logging.Header)
+			if len(id) == 0 || len(id) > 64 {
+				id = logging.NewID()
+			}
+			w.Header().Set(logging.Header, id)
+			l := logger.With(logging.Key, id)
+			if name := r.Header.Get(device.Header); len(name) > 0 {
+				l = l.With("device", name)
+			}
+			ctx := logging.WithID(logging.NewContext(r.Context(), l), id)
+			rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(ctx))
+			level := slog.LevelDebug
+			if rec.code >= 500 {
+				level = slog.LevelError
+			}
+			l.Log(ctx, level, "request", "method", r.Method, "path", r.URL.Path, "status", rec.code, "duration", time.Since(start))
+		})
+	}
+}
@@ -1,123 +1,264 @@
 package main
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
 	"net/http"
 	"os"
-	"path/filepath"
-	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/marcsauter/buzzer/pkg/audit"
+	"github.com/marcsauter/buzzer/pkg/health"
+	"github.com/marcsauter/buzzer/pkg/i18n"
+	"github.com/marcsauter/buzzer/pkg/inbound"
+	"github.com/marcsauter/buzzer/pkg/lifecycle"
+	"github.com/marcsauter/buzzer/pkg/logging"
+	"github.com/marcsauter/buzzer/pkg/notify"
 	"github.com/marcsauter/buzzer/pkg/pitch"
-	"github.com/mholt/binding"
+	"github.com/marcsauter/buzzer/pkg/webhook"
 	"github.com/pressly/chi"
-	"github.com/pressly/chi/render"
 )
 
-var (
-	address, port, cache string
-	mutex                = new(sync.Mutex)
-	nextPitch            = pitch.Pitch{}
-)
-
-func init() {
-	const (
-		defaultAddress = "127.0.0.1"
-		defaultPort    = "8080"
-	)
-	flag.StringVar(&address, "address", defaultAddress, "address")
-	flag.StringVar(&port, "port", defaultPort, "port")
-	flag.StringVar(&cache, "cache", fmt.Sprintf("/tmp/%s.cache", filepath.Base(os.Args[0])), "cache file")
-}
-
 func main() {
+	cfg, loader := newSettings()
 	flag.Parse()
+	if ok, err := loader.Command(flag.Args(), os.Stdout); ok {
+		lifecycle.Exit(logging.Default(), lifecycle.WithCode(lifecycle.ExitConfig, err))
+	}
+	if err := loader.Load(cfg); err != nil {
+		lifecycle.Exit(logging.Default(), lifecycle.WithCode(lifecycle.ExitConfig, err))
+	}
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		lifecycle.Exit(logging.Default(), lifecycle.WithCode(lifecycle.ExitConfig, err))
+	}
+	logger = logger.With("component", "server")
+	locale, err := i18n.New(cfg.Locale, cfg.Timezone)
+	if err != nil {
+		lifecycle.Exit(logger, lifecycle.WithCode(lifecycle.ExitConfig, err))
+	}
+	notifier, err := notify.New(cfg.Notify, logger)
+	if err != nil {
+		lifecycle.Exit(logger, lifecycle.WithCode(lifecycle.ExitConfig, err))
+	}
+	lc := lifecycle.New(lifecycle.DefaultTimeout, logger)
+
+	// read server state from cache
+	s := newStore(cfg.Cache, cfg.Timezone, cfg.SeriesHorizon, cfg.OfferDeadline, logger)
+
+	// inbound endpoints of external systems
+	mappings := []*inbound.Mapping{}
+	if len(cfg.Inbound) > 0 {
+		if mappings, err = inbound.Load(cfg.Inbound); err != nil {
+			lifecycle.Exit(logger, lifecycle.WithCode(lifecycle.ExitConfig, err))
+		}
+	}
+
+	// audit log of the mutating requests and the failed logins
+	if len(cfg.Audit) == 0 {
+		cfg.Audit = cfg.Cache + ".audit"
+	}
+	auditLog, err := audit.Open(cfg.Audit)
+	if auditLog == nil {
+		lifecycle.Exit(logger, lifecycle.WithCode(lifecycle.ExitConfig, err))
+	}
+	var truncated *audit.Truncated
+	switch {
+	case errors.As(err, &truncated):
+		logger.Warn("partial entry removed from the audit log", "error", err)
+	case err != nil:
+		logger.Error("audit log chain broken", "error", err)
+	}
+	a := &auditor{s: s, log: auditLog, inbound: inboundMappings(mappings)}
 
 	// setup basic authentication
-	credentials := make(map[string][]string)
-	username := os.Getenv("BUZZER_USERNAME")
-	password := os.Getenv("BUZZER_PASSWORD")
-	if len(username) != 0 {
-		credentials[username] = []string{password}
-	}
-
-	// read next pitch from cache
-	if _, err := os.Stat(cache); err == nil {
-		if c, err := ioutil.ReadFile(cache); err == nil {
-			if err := json.Unmarshal(c, &nextPitch); err != nil {
-				log.Println("ERROR:", err)
-			}
-		} else {
-			log.Println("ERROR:", err)
+	// the configured user is always valid, further users are managed through the API
+	var user atomic.Value
+	user.Store([2]string{cfg.Username, cfg.Password})
+	authenticate := func(u, p string) bool {
+		if c := user.Load().([2]string); len(c[0]) != 0 && u == c[0] && p == c[1] {
+			return true
 		}
+		return s.Authenticate(u, p)
 	}
+	lc.Go("config", func(ctx context.Context) error {
+		return loader.Watch(ctx, logger, func(c interface{}, changed []string) {
+			cfg := c.(*settings)
+			user.Store([2]string{cfg.Username, cfg.Password})
+		})
+	})
 
-	api := chi.NewRouter()
-	api.Use(basicAuth("buzzer", credentials))
-	api.Post("/next", func(w http.ResponseWriter, r *http.Request) {
-		p := pitch.Pitch{}
-		if errs := binding.Bind(r, &p); errs.Handle(w) {
-			return
+	// outgoing webhooks on the lifecycle events of the pitches
+	hooks := []*webhook.Hook{}
+	if len(cfg.Webhooks) > 0 {
+		if hooks, err = webhook.Load(cfg.Webhooks); err != nil {
+			lifecycle.Exit(logger, lifecycle.WithCode(lifecycle.ExitConfig, err))
 		}
-		// update next pitch if the pitch id changed
-		if p.ID != nextPitch.ID {
-			mutex.Lock()
-			if p.ID != nextPitch.ID {
-				nextPitch = p
-				// write cache
-				if data, err := json.Marshal(nextPitch); err == nil {
-					if err := ioutil.WriteFile(cache, data, 0600); err != nil {
-						log.Println("ERROR:", err)
-					}
-				} else {
-					log.Println("ERROR:", err)
-				}
-			}
-			mutex.Unlock()
+	}
+	if len(cfg.WebhookLog) == 0 {
+		cfg.WebhookLog = cfg.Cache + ".webhooks"
+	}
+	dispatcher := webhook.New(hooks, cfg.WebhookLog, logger)
+	s.Observe(publishHistory(dispatcher))
+	lc.Go("webhooks", dispatcher.Run)
+	if len(hooks) > 0 {
+		lc.Go("starting", func(ctx context.Context) error {
+			return s.RunStarting(ctx, 30*time.Second, cfg.WebhookLead, dispatcher)
+		})
+	}
+
+	// create the occurrences of the series
+	lc.Go("series", func(ctx context.Context) error {
+		return s.RunSeries(ctx, time.Hour)
+	})
+
+	// withdraw the offers of the waitlist not accepted until the deadline
+	lc.Go("waitlist", func(ctx context.Context) error {
+		return s.RunWaitlist(ctx, time.Minute, func(p pitch.Pitch, o *pitch.Offer) {
+			notifyOffer(logger, notifier, p, o, cfg.PublicURL)
+		})
+	})
+
+	// import pitches from calendar
+	var cal *calendar
+	if len(cfg.ICalSource) > 0 {
+		cal = newCalendar(cfg.ICalSource, cfg.ICalSpeaker, cfg.ICalVenue, locale.Location, cfg.SeriesHorizon)
+		lc.Go("calendar", func(ctx context.Context) error {
+			return cal.Sync(ctx, s, cfg.ICalInterval, func(p pitch.Pitch, o *pitch.Offer) {
+				notifyOffer(logger, notifier, p, o, cfg.PublicURL)
+			})
+		})
+	}
+
+	// health of the server, a deadlocked store stops the keep-alives of the systemd watchdog
+	hc := health.New()
+	hc.Live("store", s.Check)
+	hc.Ready("cache", s.CheckCache)
+	hc.Ready("audit", auditLog.Check)
+	if cal != nil {
+		hc.Ready("calendar", cal.Check)
+	}
+
+	// optional MQTT transport of the devices
+	if len(cfg.MQTT) > 0 {
+		broker, err := newMQTTBroker(cfg.MQTT, cfg.MQTTTopic, a, logger)
+		if err != nil {
+			lifecycle.Exit(logger, lifecycle.WithCode(lifecycle.ExitConfig, err))
 		}
-		//log.Printf("next pitch: \"%s\" talks about \"%s\" on \"%s\"", nextPitch.Speaker, nextPitch.Title, nextPitch.Date)
+		hc.Ready("mqtt", broker.Check)
+		lc.Go("mqtt", broker.Run)
+	}
+	lc.Go("systemd", func(ctx context.Context) error {
+		return hc.Systemd(ctx, logger)
 	})
-	api.Get("/next", func(w http.ResponseWriter, r *http.Request) {
-		mutex.Lock()
-		p := nextPitch
-		mutex.Unlock()
-		render.JSON(w, r, p)
+
+	api := chi.NewRouter()
+	api.Use(logRequests(logger))
+	api.Use(instrument)
+	api.Use(audited(a))
+	api.Get("/healthz", hc.Healthz)
+	api.Get("/readyz", hc.Readyz)
+	// calendar subscriptions and schedule
+	api.Get("/pitches.ics", icalHandler(s, locale))
+	api.Get("/schedule", scheduleHandler(s, cfg.Locale, cfg.Timezone))
+	// sign-up of speakers
+	api.Get("/slots", listSlots(s))
+	api.Get("/signup", signUpForm(s, cfg.Locale, cfg.Timezone))
+	api.Post("/signup", postSignUp(s, notifier, cfg.Locale, cfg.Timezone))
+	// offers of the waitlist, the token is the authorization
+	api.Get("/offers/:token", getOffer(s, cfg.Locale, cfg.Timezone))
+	api.Post("/offers/:token/accept", respondOffer(s, notifier, true, cfg.Locale, cfg.Timezone, cfg.PublicURL))
+	api.Post("/offers/:token/decline", respondOffer(s, notifier, false, cfg.Locale, cfg.Timezone, cfg.PublicURL))
+	// pitches pushed by external systems, the signature is the authorization
+	api.Post("/inbound/:name", postInbound(s, mappings, locale.Location))
+	api.Group(func(api chi.Router) {
+		api.Use(basicAuth("buzzer", authenticate))
+		api.Handle("/metrics", metricsHandler(s))
+		api.Get("/next", getNext(s))
+		api.Post("/next", postNext(s))
+		api.Get("/pitches", listPitches(s))
+		api.Post("/pitches", createPitch(s))
+		api.Get("/pitches/:id", getPitch(s))
+		api.Put("/pitches/:id", putPitch(s))
+		api.Delete("/pitches/:id", deletePitch(s))
+		api.Post("/pitches/:id/approve", decidePitch(s, notifier, true, cfg.PublicURL))
+		api.Post("/pitches/:id/reject", decidePitch(s, notifier, false, cfg.PublicURL))
+		api.Post("/pitches/:id/cancel", cancelPitch(s, notifier, cfg.PublicURL))
+		api.Get("/pitches/:id/slot", getSlot(s))
+		api.Get("/venues", listVenues(s))
+		api.Post("/venues", putVenue(s))
+		api.Put("/venues/:id", putVenue(s))
+		api.Delete("/venues/:id", deleteVenue(s))
+		api.Get("/series", listSeries(s))
+		api.Post("/series", putSeries(s))
+		api.Put("/series/:id", putSeries(s))
+		api.Delete("/series/:id", deleteSeries(s))
+		api.Get("/devices", listDevices(s))
+		api.Post("/devices", registerDevice(s))
+		api.Get("/devices/:name/commands", pollCommands(s))
+		api.Post("/devices/:name/commands", sendCommand(s))
+		api.Post("/devices/:name/events", reportEvent(s))
+		api.Get("/reports/:name", getReport(s))
+		api.Get("/users", listUsers(s))
+		api.Post("/users", setUser(s))
+		api.Put("/users/:name", setUser(s))
+		api.Delete("/users/:name", deleteUser(s))
+		api.Get("/pins", listPINs(s))
+		api.Post("/pins", setPIN(s))
+		api.Put("/pins/:name", setPIN(s))
+		api.Delete("/pins/:name", deletePIN(s))
+		api.Post("/pins/verify", verifyPIN(s))
+		api.Get("/webhooks", listWebhooks(dispatcher))
+		api.Get("/webhooks/deliveries", listDeliveries(dispatcher))
+		api.Get("/audit", listAudit(a))
+		api.Get("/audit/verify", verifyAudit(a))
+
+		// migration endpoints
+		// have to exist but do nothing
+		api.Get("/", func(w http.ResponseWriter, r *http.Request) {})
 	})
 
-	// migration endpoints
-	// have to exist but do nothing
-	api.Get("/", func(w http.ResponseWriter, r *http.Request) {})
+	srv := &http.Server{Addr: fmt.Sprintf("%s:%s", cfg.Address, cfg.Port), Handler: api}
+	lc.Go("http", func(ctx context.Context) error {
+		return serve(ctx, srv)
+	})
+	logger.Info("server is listening", "address", cfg.Address, "port", cfg.Port)
+	lifecycle.Exit(logger, lc.Run(context.Background()))
+}
 
-	log.Printf("server is listening on %s:%s", address, port)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf("%s:%s", address, port), api))
+// serve runs srv until ctx is done, open requests are completed within the shutdown deadline
+func serve(ctx context.Context, srv *http.Server) error {
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	sctx, cancel := context.WithTimeout(context.Background(), lifecycle.DefaultTimeout)
+	defer cancel()
+	return srv.Shutdown(sctx)
 }
 
-func basicAuth(realm string, credentials map[string][]string) func(http.Handler) http.Handler {
+func basicAuth(realm string, authenticate func(username, password string) bool) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			username, password, ok := r.BasicAuth()
-			if !ok {
-				unauthorized(w, realm)
-				return
-			}
-
-			validPasswords, userFound := credentials[username]
-			if !userFound {
+			if !ok || !authenticate(username, password) {
+				if ok {
+					authFailures.Inc()
+					auditLoginFailure(r, username)
+				}
 				unauthorized(w, realm)
 				return
 			}
-
-			for _, validPassword := range validPasswords {
-				if password == validPassword {
-					next.ServeHTTP(w, r)
-					return
-				}
-			}
-
-			unauthorized(w, realm)
+			auditActor(r, username)
+			next.ServeHTTP(w, r)
 		})
 	}
 }
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics of the HTTP API
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "buzzer",
+		Subsystem: "http",
+		Name:      "requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "buzzer",
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Latency of the HTTP requests by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+	authFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "buzzer",
+		Name:      "auth_failures_total",
+		Help:      "Requests rejected by the basic authentication.",
+	})
+)
+
+// descriptions of the metrics collected from the store
+var (
+	pitchesDesc  = prometheus.NewDesc("buzzer_pitches", "Pitches by venue and status.", []string{"venue", "status"}, nil)
+	upcomingDesc = prometheus.NewDesc("buzzer_pitches_upcoming", "Pitches not yet started by venue.", []string{"venue"}, nil)
+	lastSeenDesc = prometheus.NewDesc("buzzer_device_last_seen_age_seconds", "Time since a device was last seen.", []string{"device", "venue"}, nil)
+)
+
+// storeCollector collects the pitch counts and the last-seen ages of the devices at scrape time
+type storeCollector struct {
+	s *store
+}
+
+// Describe implements prometheus.Collector
+func (c storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pitchesDesc
+	ch <- upcomingDesc
+	ch <- lastSeenDesc
+}
+
+// Collect implements prometheus.Collector
+func (c storeCollector) Collect(ch chan<- prometheus.Metric) {
+	now := time.Now()
+	type key struct{ venue, status string }
+	pitches := make(map[key]int)
+	upcoming := make(map[string]int)
+	for _, p := range c.s.Pitches("") {
+		pitches[key{p.Venue, pitchStatus(p)}]++
+		if p.Date.After(now) {
+			upcoming[p.Venue]++
+		}
+	}
+	for k, n := range pitches {
+		ch <- prometheus.MustNewConstMetric(pitchesDesc, prometheus.GaugeValue, float64(n), k.venue, k.status)
+	}
+	for venue, n := range upcoming {
+		ch <- prometheus.MustNewConstMetric(upcomingDesc, prometheus.GaugeValue, float64(n), venue)
+	}
+	for _, d := range c.s.Devices("") {
+		ch <- prometheus.MustNewConstMetric(lastSeenDesc, prometheus.GaugeValue, now.Sub(d.LastSeen).Seconds(), d.Name, d.Venue)
+	}
+}
+
+// pitchStatus returns the status label of a pitch, a slot without speaker is open
+func pitchStatus(p pitch.Pitch) string {
+	switch {
+	case len(p.Status) > 0:
+		return p.Status
+	case p.Open():
+		return "open"
+	}
+	return pitch.StatusApproved
+}
+
+// methods are the HTTP methods used as label, any other method is counted as other
+var methods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// methodLabel returns the label of the method, arbitrary methods sent by clients would create unlimited series
+func methodLabel(method string) string {
+	if methods[method] {
+		return method
+	}
+	return "other"
+}
+
+// metricsHandler returns the handler of /metrics with the metrics of the API and the store
+func metricsHandler(s *store) http.Handler {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(httpRequests, httpDuration, authFailures, storeCollector{s})
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{})
+}
+
+// statusRecorder records the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// instrument counts the requests and measures their latency,
+// the route is the first segment of the path e.g. /pitches, requests not found are counted as unmatched
+// and methods not known as other (see methodLabel)
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		route := "/" + strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+		if rec.code == http.StatusNotFound || rec.code == http.StatusMethodNotAllowed {
+			route = "unmatched"
+		}
+		method := methodLabel(r.Method)
+		httpRequests.WithLabelValues(route, method, strconv.Itoa(rec.code)).Inc()
+		httpDuration.WithLabelValues(route, method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestInstrumentMethod(t *testing.T) {
+	h := instrument(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for _, method := range []string{"GET", "BREW", "PROPFIND", "get"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/slots", nil))
+	}
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues("/slots", http.MethodGet, "200")); n != 1 {
+		t.Errorf("%v GET requests, want 1", n)
+	}
+	if n := testutil.ToFloat64(httpRequests.WithLabelValues("/slots", "other", "200")); n != 3 {
+		t.Errorf("%v other requests, want 3", n)
+	}
+	if n := testutil.CollectAndCount(httpRequests); n != 2 {
+		t.Errorf("%d series, want 2", n)
+	}
+}
+
+func TestStoreCollector(t *testing.T) {
+	s := testStore(t)
+	if _, err := s.PutVenue(pitch.Venue{ID: "pflab"}); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.Put(pitch.Pitch{ID: "1", Speaker: "Jane", Title: "Go", Date: now.Add(time.Hour).UTC(), Timezone: "Europe/Zurich", Venue: "pflab"})
+	s.Put(pitch.Pitch{ID: "2", Title: "open", Date: now.Add(2 * time.Hour).UTC(), Timezone: "Europe/Zurich", Venue: "pflab"})
+	s.Put(pitch.Pitch{ID: "3", Speaker: "Anna", Title: "Rust", Date: now.Add(3 * time.Hour).UTC(), Timezone: "Europe/Zurich", Venue: "pflab"})
+	s.Delete("3", now)
+	addPitch(t, s, "4", "Marc", now.Add(-time.Hour))
+	if err := s.RegisterDevice(device.Device{Name: "buzzer1", Venue: "pflab"}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `
+# HELP buzzer_pitches Pitches by venue and status.
+# TYPE buzzer_pitches gauge
+buzzer_pitches{status="approved",venue=""} 1
+buzzer_pitches{status="approved",venue="pflab"} 1
+buzzer_pitches{status="cancelled",venue="pflab"} 1
+buzzer_pitches{status="open",venue="pflab"} 1
+# HELP buzzer_pitches_upcoming Pitches not yet started by venue.
+# TYPE buzzer_pitches_upcoming gauge
+buzzer_pitches_upcoming{venue="pflab"} 3
+`
+	c := storeCollector{s}
+	if err := testutil.CollectAndCompare(c, strings.NewReader(expected), "buzzer_pitches", "buzzer_pitches_upcoming"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.CollectAndCount(c, "buzzer_device_last_seen_age_seconds"); n != 1 {
+		t.Errorf("%d devices, want 1", n)
+	}
+}
+
+func TestAuthFailures(t *testing.T) {
+	h := basicAuth("buzzer", func(username, password string) bool {
+		return username == "organizer" && password == "s3cr3t"
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	before := testutil.ToFloat64(authFailures)
+	tests := []struct {
+		name     string
+		username string
+		password string
+		want     int
+	}{
+		{"valid", "organizer", "s3cr3t", http.StatusOK},
+		{"wrong password", "organizer", "wrong", http.StatusUnauthorized},
+		{"unknown user", "mallory", "s3cr3t", http.StatusUnauthorized},
+		{"no credentials", "", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/pitches", nil)
+		if len(tt.username) > 0 {
+			r.SetBasicAuth(tt.username, tt.password)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+	// requests without credentials e.g. the first request of a browser are not counted
+	if n := testutil.ToFloat64(authFailures) - before; n != 2 {
+		t.Errorf("%v failures, want 2", n)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/marcsauter/buzzer/pkg/audit"
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/logging"
+	"github.com/marcsauter/buzzer/pkg/mqtt"
+)
+
+// mqttInterval is the interval the next pitches are checked, a changed pitch is published
+const mqttInterval = 5 * time.Second
+
+// mqttBroker publishes the next pitch of every venue to the MQTT broker and receives the events and heartbeats
+// of the devices, a device is identified by its topic only: the ACLs of the broker have to restrict the topics
+// a device may publish to its own (see README)
+type mqttBroker struct {
+	a         *auditor
+	prefix    string
+	logger    *slog.Logger
+	client    paho.Client
+	connected chan struct{}
+}
+
+// newMQTTBroker returns the MQTT transport of the server connecting to broker, the topics start with prefix
+func newMQTTBroker(broker, prefix string, a *auditor, logger *slog.Logger) (*mqttBroker, error) {
+	b := &mqttBroker{a: a, prefix: prefix, logger: logger, connected: make(chan struct{}, 1)}
+	opts, err := mqtt.Options(broker, "buzzer-server", func(c paho.Client) {
+		mqtt.Subscribe(c, mqtt.DeviceTopic(prefix, "+", mqtt.TopicEvents), b.receive, logger)
+		mqtt.Subscribe(c, mqtt.DeviceTopic(prefix, "+", mqtt.TopicHeartbeat), b.receive, logger)
+		select {
+		case b.connected <- struct{}{}:
+		default:
+		}
+	}, logger)
+	if err != nil {
+		return nil, err
+	}
+	b.client = paho.NewClient(opts)
+	return b, nil
+}
+
+// Check returns an error if the server is not connected to the broker
+func (b *mqttBroker) Check() error {
+	if !b.client.IsConnectionOpen() {
+		return mqtt.ErrNotConnected
+	}
+	return nil
+}
+
+// Run connects to the broker and publishes the changed next pitches every mqttInterval until ctx is done,
+// all next pitches are published again on every connection
+func (b *mqttBroker) Run(ctx context.Context) error {
+	b.client.Connect()
+	defer b.client.Disconnect(mqtt.Quiesce)
+	ticker := time.NewTicker(mqttInterval)
+	defer ticker.Stop()
+	published := make(map[string][]byte)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.connected:
+			published = make(map[string][]byte)
+		case <-ticker.C:
+		}
+		if b.client.IsConnectionOpen() {
+			b.publish(ctx, published)
+		}
+	}
+}
+
+// publish publishes the next pitch of all venues and of every venue as retained message if it changed,
+// it is the same JSON as returned by the API, the message of a deleted venue is cleared
+func (b *mqttBroker) publish(ctx context.Context, published map[string][]byte) {
+	now := time.Now()
+	venues := []string{""}
+	for _, v := range b.a.s.Venues() {
+		venues = append(venues, v.ID)
+	}
+	current := make(map[string]bool)
+	for _, venue := range venues {
+		topic := mqtt.NextTopic(b.prefix, venue)
+		current[topic] = true
+		p, _ := b.a.s.Next(venue, now)
+		data, err := json.Marshal(p)
+		if err != nil {
+			b.logger.Error("encoding next pitch failed", "venue", venue, "error", err)
+			continue
+		}
+		if old, ok := published[topic]; ok && bytes.Equal(old, data) {
+			continue
+		}
+		if b.retain(ctx, topic, data) {
+			published[topic] = data
+			b.logger.Debug("next pitch published", "venue", venue, "pitch", p.ID)
+		}
+	}
+	for topic := range published {
+		if !current[topic] && b.retain(ctx, topic, []byte{}) {
+			delete(published, topic)
+		}
+	}
+}
+
+// retain publishes data as retained message of topic and returns true if the broker received it, empty data clears the message
+func (b *mqttBroker) retain(ctx context.Context, topic string, data []byte) bool {
+	tctx, cancel := context.WithTimeout(ctx, mqttInterval)
+	defer cancel()
+	if err := mqtt.Wait(tctx, b.client.Publish(topic, mqtt.QoS, true, data)); err != nil {
+		if ctx.Err() == nil {
+			b.logger.Error("publishing next pitch failed", "topic", topic, "error", err)
+		}
+		return false
+	}
+	return true
+}
+
+// receive handles an event or a heartbeat of a device like a request of the API (see reportEvent and registerDevice),
+// a heartbeat is recorded in the audit log only if it registered the device
+func (b *mqttBroker) receive(c paho.Client, m paho.Message) {
+	name, kind, ok := mqtt.DeviceName(b.prefix, m.Topic())
+	if !ok {
+		return
+	}
+	s := b.a.s
+	msg := deviceMessage{name: name, topic: m.Topic(), id: logging.NewID()}
+	logger := b.logger.With(logging.Key, msg.id, "device", name)
+	switch kind {
+	case mqtt.TopicEvents:
+		var e device.Event
+		if err := json.Unmarshal(m.Payload(), &e); err != nil {
+			logger.Error("event not valid", "error", err)
+			return
+		}
+		if e.Time.IsZero() {
+			e.Time = time.Now()
+		}
+		venue := s.DeviceVenue(name)
+		msg.action, msg.target = "device.events", "schedule/"+venue
+		b.a.recordMessage(logger, msg, func() json.RawMessage { return s.auditSchedule(venue) }, func() (bool, int, string) {
+			p, err := s.Report(name, e)
+			switch {
+			case err == errPitchNotFound || err == errDeviceNotFound:
+				logger.Warn("reporting event failed", "event", e.Name, "error", err)
+				return true, http.StatusNotFound, ""
+			case err != nil:
+				logger.Warn("reporting event failed", "event", e.Name, "error", err)
+				return true, http.StatusUnprocessableEntity, ""
+			}
+			logger.Info("event reported", "event", e.Name, "pitch", p.ID)
+			return true, http.StatusOK, fmt.Sprintf("%s pitch %s", e.Name, p.ID)
+		})
+	case mqtt.TopicHeartbeat:
+		var d device.Device
+		if err := json.Unmarshal(m.Payload(), &d); err != nil {
+			logger.Error("heartbeat not valid", "error", err)
+			return
+		}
+		if len(d.Name) > 0 && d.Name != name {
+			logger.Warn("heartbeat of another device rejected", "name", d.Name)
+			return
+		}
+		d.Name = name
+		msg.action, msg.target = "device.enroll", "device/"+name
+		b.a.recordMessage(logger, msg, func() json.RawMessage { return s.auditState("device", name) }, func() (bool, int, string) {
+			registered, err := s.Heartbeat(d)
+			if err != nil {
+				logger.Error("registering device failed", "error", err)
+				return false, http.StatusUnprocessableEntity, ""
+			}
+			if registered {
+				logger.Info("device registered", "venue", d.Venue, "ip", d.IP)
+			}
+			return registered, http.StatusOK, ""
+		})
+	}
+}
+
+// deviceMessage is a message of a device received through MQTT as it is recorded in the audit log
+type deviceMessage struct {
+	name   string
+	topic  string
+	id     string
+	action string
+	target string
+}
+
+// recordMessage runs handle changing the target of the message and records it in the audit log with the changes
+// if handle returns true, the status and the detail of the entry are returned by handle
+func (a *auditor) recordMessage(logger *slog.Logger, msg deviceMessage, state func() json.RawMessage, handle func() (bool, int, string)) {
+	a.Lock()
+	before := state()
+	a.Unlock()
+	ok, status, detail := handle()
+	if !ok {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	diff, err := audit.Diff(before, state())
+	if err != nil {
+		logger.Error("audit diff failed", "target", msg.target, "error", err)
+	}
+	e := audit.Entry{
+		Actor:         "mqtt:" + msg.name,
+		Device:        msg.name,
+		CorrelationID: msg.id,
+		Action:        msg.action,
+		Method:        "MQTT",
+		Path:          msg.topic,
+		Target:        msg.target,
+		Status:        status,
+		Detail:        detail,
+		Diff:          diff,
+	}
+	if _, err := a.log.Append(e); err != nil {
+		logger.Error("writing audit log failed", "action", e.Action, "error", err)
+	}
+}
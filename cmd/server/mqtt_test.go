@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/marcsauter/buzzer/pkg/audit"
+	"github.com/marcsauter/buzzer/pkg/mqtt"
+	"github.com/marcsauter/buzzer/pkg/mqtt/mqtttest"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// eventually fails the test unless cond is true within 2 seconds
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: timed out", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMQTTBroker(t *testing.T) {
+	broker := mqtttest.NewBroker(map[string]string{"buzzer-server": "s3cr3t", "buzzer1": "s3cr3t"})
+	defer broker.Close()
+	s := testStore(t)
+	for _, v := range []pitch.Venue{{ID: "pflab"}, {ID: "basement"}} {
+		if _, err := s.PutVenue(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	date := time.Now().Add(time.Minute).UTC().Truncate(time.Second)
+	if err := s.Add(pitch.Pitch{ID: "42", Speaker: "Jane", Title: "Go", Date: date, Timezone: "Europe/Zurich", Venue: "pflab"}); err != nil {
+		t.Fatal(err)
+	}
+	log, err := audit.Open(filepath.Join(t.TempDir(), "buzzer.audit"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	b, err := newMQTTBroker(strings.Replace(broker.URL, "tcp://", "tcp://buzzer-server:s3cr3t@", 1), mqtt.DefaultPrefix, &auditor{s: s, log: log}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Check(); err != mqtt.ErrNotConnected {
+		t.Errorf("check before the connection: %v, want %v", err, mqtt.ErrNotConnected)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- b.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// the next pitches are published on the connection
+	for _, topic := range []string{"buzzer/next", "buzzer/next/pflab", "buzzer/next/basement"} {
+		eventually(t, topic+" published", func() bool {
+			_, ok := broker.Retained(topic)
+			return ok
+		})
+	}
+	if err := b.Check(); err != nil {
+		t.Errorf("check: %v", err)
+	}
+	data, _ := broker.Retained("buzzer/next/pflab")
+	next := pitch.Pitch{}
+	if err := json.Unmarshal(data, &next); err != nil {
+		t.Fatal(err)
+	}
+	if next.ID != "42" || next.Speaker != "Jane" || !next.Date.Equal(date) {
+		t.Errorf("next pitch %+v, want 42", next)
+	}
+
+	// the next pitch of a deleted venue is cleared
+	published := make(map[string][]byte)
+	b.publish(ctx, published)
+	if err := s.DeleteVenue("basement"); err != nil {
+		t.Fatal(err)
+	}
+	b.publish(ctx, published)
+	if _, ok := broker.Retained("buzzer/next/basement"); ok {
+		t.Error("next pitch of the deleted venue not cleared")
+	}
+	if _, ok := published["buzzer/next/basement"]; ok {
+		t.Error("deleted venue still published")
+	}
+
+	// heartbeats and events of a device
+	opts, err := mqtt.Options(strings.Replace(broker.URL, "tcp://", "tcp://buzzer1:s3cr3t@", 1), "buzzer-device-buzzer1", func(paho.Client) {}, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := paho.NewClient(opts)
+	if !c.Connect().WaitTimeout(time.Second) {
+		t.Fatal("device not connected")
+	}
+	defer c.Disconnect(0)
+	for _, m := range []struct{ topic, payload string }{
+		{"buzzer/devices/buzzer1/heartbeat", `{"name": "buzzer2", "ip": "10.0.0.2", "venue": "pflab"}`},
+		{"buzzer/devices/buzzer1/heartbeat", `{"ip": "10.0.0.1", "venue": "pflab"}`},
+		{"buzzer/devices/buzzer1/heartbeat", `{"ip": "10.0.0.1", "venue": "pflab"}`},
+		{"buzzer/devices/buzzer1/events", `{"name": "released"}`},
+	} {
+		if tok := c.Publish(m.topic, mqtt.QoS, false, m.payload); !tok.WaitTimeout(time.Second) || tok.Error() != nil {
+			t.Fatalf("publishing to %s failed: %v", m.topic, tok.Error())
+		}
+	}
+	eventually(t, "pitch released", func() bool {
+		p, _ := s.Pitch("42")
+		return p.Released
+	})
+	if devices := s.Devices(""); len(devices) != 1 || devices[0].Name != "buzzer1" || devices[0].IP != "10.0.0.1" {
+		t.Errorf("devices %+v, want buzzer1 only", devices)
+	}
+
+	entries, err := log.Entries(audit.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("%d entries, want the registration and the release: %+v", len(entries), entries)
+	}
+	if e := entries[0]; e.Actor != "mqtt:buzzer1" || e.Action != "device.enroll" || e.Target != "device/buzzer1" || e.Method != "MQTT" || len(e.Diff) == 0 {
+		t.Errorf("entry %+v, want the registration of buzzer1", e)
+	}
+	if e := entries[1]; e.Action != "device.events" || e.Target != "schedule/pflab" || e.Detail != "released pitch 42" {
+		t.Errorf("entry %+v, want the release of pitch 42", e)
+	}
+}
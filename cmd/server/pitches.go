@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/mholt/binding"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+// sources of a pitch
+const (
+	sourceAPI     = "api"
+	sourceICal    = "ical"
+	sourceSeries  = "series"
+	sourceInbound = "inbound"
+)
+
+// errPitchNotFound is returned for an unknown pitch
+var errPitchNotFound = errors.New("pitch not found")
+
+// errConflict is returned if a pitch pushed by an external system was changed otherwise since the last push
+var errConflict = errors.New("pitch was changed since the last push")
+
+// record represents a pitch as it is kept by the server
+type record struct {
+	pitch.Pitch
+	// Source is where the pitch came from
+	Source string `json:"source,omitempty"`
+	// Sequence is the SEQUENCE of the calendar event, it is incremented if the pitch is rescheduled
+	Sequence int `json:"sequence,omitempty"`
+	// Modified is the time of the last modification, used to resolve conflicts
+	Modified time.Time `json:"modified"`
+	// Pushed is the time of the last modification pushed by an external system (see Push)
+	Pushed time.Time `json:"pushed,omitempty"`
+	// Waitlist and Offer of the sign-up (see waitlist.go)
+	Waitlist []pitch.Candidate `json:"waitlist,omitempty"`
+	Offer    *pitch.Offer      `json:"offer,omitempty"`
+	// History of the pitch: sign-up, schedule and releases (see history.go)
+	History []pitch.HistoryEntry `json:"history,omitempty"`
+}
+
+// Next returns the first pitch in venue not yet started and the time it became the next pitch
+// i.e. the last modification of the schedule or the start of the previous pitch
+// rejected and cancelled pitches are skipped, a pending pitch is an open slot (see public)
+func (s *store) Next(venue string, now time.Time) (pitch.Pitch, time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	next := pitch.Pitch{}
+	modified := s.modified
+	for _, r := range s.records {
+		if !r.At(venue) || r.Status == pitch.StatusRejected || r.Status == pitch.StatusCancelled {
+			continue
+		}
+		if r.Date.After(now) {
+			if len(next.ID) == 0 || r.Date.Before(next.Date) {
+				next = r.Pitch
+			}
+		} else if r.Date.After(modified) {
+			modified = r.Date
+		}
+	}
+	if len(next.ID) > 0 {
+		next = s.public(s.withVenue(next))
+	}
+	return next, modified
+}
+
+// Pitches returns all pitches in venue ordered by date
+func (s *store) Pitches(venue string) pitch.Pitches {
+	s.Lock()
+	defer s.Unlock()
+	pitches := make(pitch.Pitches, 0, len(s.records))
+	for _, r := range s.records {
+		if r.At(venue) {
+			pitches = append(pitches, s.withVenue(r.Pitch))
+		}
+	}
+	sort.Sort(pitches)
+	return pitches
+}
+
+// Pitch returns the pitch with the given id
+func (s *store) Pitch(id string) (pitch.Pitch, bool) {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return pitch.Pitch{}, false
+	}
+	return s.withVenue(r.Pitch), true
+}
+
+// Add adds a new pitch received through the API
+func (s *store) Add(p pitch.Pitch) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.records[p.ID]; ok {
+		return fmt.Errorf("pitch %s already exists", p.ID)
+	}
+	p.RegisteredAt = time.Now()
+	r := &record{Pitch: p, Source: sourceAPI, Modified: p.RegisteredAt}
+	s.addHistory(r, r.Modified, pitch.HistoryCreated, r.Speaker, r.Title, "")
+	s.records[p.ID] = r
+	s.changed()
+	return nil
+}
+
+// Put adds or updates a pitch received through the API
+func (s *store) Put(p pitch.Pitch) {
+	s.Upsert(p, sourceAPI)
+}
+
+// Upsert adds or updates a pitch received from source and returns true if it was added
+func (s *store) Upsert(p pitch.Pitch, source string) bool {
+	s.Lock()
+	defer s.Unlock()
+	return s.upsert(p, source)
+}
+
+// Push adds or updates a pitch pushed by an external system from source and returns true if it was added,
+// a pitch changed otherwise (e.g. through the API or by a sign-up) since the last push is not overwritten
+// but errConflict is returned unless the pushed pitch is the same
+func (s *store) Push(p pitch.Pitch, source string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+	if r, ok := s.records[p.ID]; ok && !r.same(p) {
+		pushed := r.Pushed
+		if pushed.IsZero() && r.Source == source {
+			// pushed before the time of the last push was recorded
+			pushed = r.Modified
+		}
+		if r.Modified.After(pushed) {
+			return false, errConflict
+		}
+	}
+	added := s.upsert(p, source)
+	r := s.records[p.ID]
+	r.Pushed = r.Modified
+	return added, nil
+}
+
+// same returns true if the pitch has the same fields as p
+func (r *record) same(p pitch.Pitch) bool {
+	return r.Speaker == p.Speaker && r.Title == p.Title && r.Date.Equal(p.Date) && r.Timezone == p.Timezone && r.Venue == p.Venue
+}
+
+// upsert adds or updates a pitch received from source and returns true if it was added, the caller has to hold the lock
+func (s *store) upsert(p pitch.Pitch, source string) bool {
+	if r, ok := s.records[p.ID]; ok {
+		if r.same(p) {
+			return false
+		}
+		previous := r.Date
+		r.Speaker, r.Title, r.Date, r.Timezone, r.Venue = p.Speaker, p.Title, p.Date, p.Timezone, p.Venue
+		r.Source = source
+		r.Modified = time.Now()
+		if !previous.Equal(r.Date) {
+			r.Sequence++
+			s.addHistory(r, r.Modified, pitch.HistoryRescheduled, r.Speaker, r.Title, "from "+previous.Format(time.RFC3339))
+		}
+		s.changed()
+		return false
+	}
+	p.RegisteredAt = time.Now()
+	r := &record{Pitch: p, Source: source, Modified: p.RegisteredAt}
+	s.addHistory(r, r.Modified, pitch.HistoryCreated, r.Speaker, r.Title, "")
+	s.records[p.ID] = r
+	s.changed()
+	return true
+}
+
+// Delete cancels the pitch with the given id outright and keeps it for the history and the reports (see tombstone),
+// an occurrence of a series is skipped, the slot is not offered to the waitlist
+func (s *store) Delete(id string, now time.Time) bool {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return false
+	}
+	if r.Status == pitch.StatusCancelled {
+		return true
+	}
+	if len(r.Series) > 0 {
+		s.skip(r)
+	}
+	s.tombstone(r, "deleted", now)
+	s.changed()
+	return true
+}
+
+// Sync merges the pitches of a calendar into the schedule
+// a pitch is only overwritten if the calendar event was modified after the pitch,
+// future pitches imported earlier but no longer found in the calendar are cancelled like a cancellation
+// through the API (see cancel), fn is called for every offer of a cancelled slot
+func (s *store) Sync(records []*record, now time.Time, fn func(pitch.Pitch, *pitch.Offer)) {
+	s.Lock()
+	defer s.Unlock()
+	seen := make(map[string]bool)
+	changed := false
+	for _, n := range records {
+		seen[n.ID] = true
+		r, ok := s.records[n.ID]
+		switch {
+		case !ok:
+			n.RegisteredAt = now
+			s.addHistory(n, n.RegisteredAt, pitch.HistoryCreated, n.Speaker, n.Title, "")
+			s.records[n.ID] = n
+		case n.Sequence < r.Sequence || !n.Modified.After(r.Modified):
+			if r.Source != sourceICal {
+				s.logger.Warn("calendar event is older than the local modification - skipped", "pitch", n.ID)
+			}
+			continue
+		default:
+			n.Pitch.RegisteredAt = r.RegisteredAt
+			n.Pitch.Released = r.Released
+			n.Pitch.ReleasedAt = r.ReleasedAt
+			n.Waitlist, n.Offer, n.History = r.Waitlist, r.Offer, r.History
+			if !n.Date.Equal(r.Date) {
+				s.addHistory(n, now, pitch.HistoryRescheduled, n.Speaker, n.Title, "from "+r.Date.Format(time.RFC3339))
+			}
+			s.records[n.ID] = n
+		}
+		changed = true
+	}
+	for id, r := range s.records {
+		if r.Source != sourceICal || seen[id] || !r.Date.After(now) || r.Open() || r.Status == pitch.StatusCancelled {
+			continue
+		}
+		if offer := s.cancel(r, "removed from the calendar", now); offer != nil {
+			fn(s.withVenue(r.Pitch), offer)
+		}
+		changed = true
+	}
+	if changed {
+		s.changed()
+	}
+}
+
+// bindPitch binds the request to a pitch, the id is taken from the URL if present
+// venue and date are validated and the date converted to UTC (see store.Validate)
+func bindPitch(s *store, w http.ResponseWriter, r *http.Request) (pitch.Pitch, bool) {
+	p := pitch.Pitch{}
+	if errs := binding.Bind(r, &p); errs.Handle(w) {
+		return p, false
+	}
+	if id := chi.URLParam(r, "id"); len(id) > 0 {
+		p.ID = id
+	}
+	if len(p.ID) == 0 {
+		http.Error(w, "pitch id missing", http.StatusUnprocessableEntity)
+		return p, false
+	}
+	if err := s.Validate(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return p, false
+	}
+	return p, true
+}
+
+// getNext returns the next pitch in the venue given by ?venue= or of the calling device
+// the response carries ETag and Last-Modified, conditional requests are answered with 304 Not Modified
+func getNext(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		venue, err := requestVenue(s, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		p, modified := s.Next(venue, time.Now())
+		data, err := json.Marshal(p)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set("ETag", fmt.Sprintf(`"%x"`, sha1.Sum(data)))
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeContent(w, r, "", modified, bytes.NewReader(data))
+	}
+}
+
+// postNext adds or updates a pitch
+func postNext(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := bindPitch(s, w, r)
+		if !ok {
+			return
+		}
+		s.Put(p)
+	}
+}
+
+// listPitches returns all pitches or the pitches in the venue given by ?venue=
+func listPitches(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, s.Pitches(r.URL.Query().Get("venue")))
+	}
+}
+
+// getPitch returns a pitch
+func getPitch(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := s.Pitch(chi.URLParam(r, "id"))
+		if !ok {
+			http.Error(w, "pitch not found", http.StatusNotFound)
+			return
+		}
+		render.JSON(w, r, p)
+	}
+}
+
+// createPitch adds a new pitch
+func createPitch(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := bindPitch(s, w, r)
+		if !ok {
+			return
+		}
+		if err := s.Add(p); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, p)
+	}
+}
+
+// putPitch adds or updates a pitch
+func putPitch(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, ok := bindPitch(s, w, r)
+		if !ok {
+			return
+		}
+		s.Put(p)
+		p, _ = s.Pitch(p.ID)
+		render.JSON(w, r, p)
+	}
+}
+
+// deletePitch removes a pitch
+func deletePitch(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.Delete(chi.URLParam(r, "id"), time.Now()) {
+			http.Error(w, "pitch not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/marcsauter/buzzer/pkg/webhook"
+)
+
+func TestDelete(t *testing.T) {
+	s := testStore(t)
+	published := []string{}
+	s.Observe(func(p pitch.Pitch, h pitch.HistoryEntry) {
+		if event, ok := webhookEvent(p, h); ok {
+			published = append(published, event)
+		}
+	})
+	now := time.Now()
+	addPitch(t, s, "42", "Marc", now.Add(time.Hour))
+	if !s.Delete("42", now) {
+		t.Fatal("pitch not found")
+	}
+	p, ok := s.Pitch("42")
+	if !ok || p.Status != pitch.StatusCancelled || p.Speaker != "Marc" {
+		t.Fatalf("pitch %+v, want kept as cancelled", p)
+	}
+	if want := []string{pitch.HistoryCreated, pitch.HistoryCancelled}; !reflect.DeepEqual(events(s, "42"), want) {
+		t.Errorf("history %q, want %q", events(s, "42"), want)
+	}
+	if want := []string{webhook.EventScheduled, webhook.EventCancelled}; !reflect.DeepEqual(published, want) {
+		t.Errorf("events %q, want %q", published, want)
+	}
+	if next, _ := s.Next("", now); len(next.ID) > 0 {
+		t.Errorf("deleted pitch is next: %+v", next)
+	}
+	// deleted again
+	if !s.Delete("42", now) || len(events(s, "42")) != 2 {
+		t.Error("pitch deleted twice")
+	}
+	if s.Delete("43", now) {
+		t.Error("unknown pitch deleted")
+	}
+}
+
+func TestDeleteOccurrence(t *testing.T) {
+	s := testStore(t)
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	if _, err := s.PutSeries(pitch.Series{ID: "weekly", Title: "Lightning talk", Start: time.Date(2026, 10, 22, 18, 0, 0, 0, time.UTC), RRule: "FREQ=WEEKLY"}); err != nil {
+		t.Fatal(err)
+	}
+	s.Materialize(now)
+	slots := s.OpenSlots("", now)
+	if len(slots) == 0 {
+		t.Fatal("no occurrences")
+	}
+	id := slots[0].ID
+	if !s.Delete(id, now) {
+		t.Fatal("occurrence not found")
+	}
+	s.Materialize(now)
+	p, ok := s.Pitch(id)
+	if !ok || p.Status != pitch.StatusCancelled {
+		t.Errorf("occurrence %+v, want kept as cancelled", p)
+	}
+	if len(s.OpenSlots("", now)) != len(slots)-1 {
+		t.Errorf("%d open slots, want %d", len(s.OpenSlots("", now)), len(slots)-1)
+	}
+}
+
+func TestSeriesChanged(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	y, m, d := now.Date()
+	start := time.Date(y, m, d+3, 12, 0, 0, 0, time.UTC)
+	weekly := pitch.Series{ID: "weekly", Title: "Lightning talk", Start: start, RRule: "FREQ=WEEKLY"}
+	if _, err := s.PutSeries(weekly); err != nil {
+		t.Fatal(err)
+	}
+	s.Materialize(now)
+	id := "weekly-" + start.AddDate(0, 0, 7).Format("20060102")
+	if _, ok := s.Pitch(id); !ok {
+		t.Fatalf("occurrence %s missing", id)
+	}
+
+	// no longer part of the series
+	changed := weekly
+	changed.RRule = "FREQ=WEEKLY;INTERVAL=2"
+	if _, err := s.PutSeries(changed); err != nil {
+		t.Fatal(err)
+	}
+	s.Materialize(now)
+	p, ok := s.Pitch(id)
+	if !ok || p.Status != pitch.StatusCancelled {
+		t.Fatalf("occurrence %+v, want kept as cancelled", p)
+	}
+	slot, _ := s.Slot(id)
+	if h := slot.History[len(slot.History)-1]; h.Event != pitch.HistoryCancelled || h.Reason != reasonRemoved {
+		t.Errorf("history %+v, want cancelled", h)
+	}
+
+	// part of the series again
+	if _, err := s.PutSeries(weekly); err != nil {
+		t.Fatal(err)
+	}
+	s.Materialize(now)
+	if p, _ := s.Pitch(id); len(p.Status) > 0 || !p.Open() {
+		t.Errorf("occurrence %+v, want open slot", p)
+	}
+	if want := []string{pitch.HistoryCreated, pitch.HistoryCancelled, pitch.HistoryCreated}; !reflect.DeepEqual(events(s, id), want) {
+		t.Errorf("history %q, want %q", events(s, id), want)
+	}
+
+	// the series deleted
+	if err := s.DeleteSeries("weekly"); err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := s.Pitch(id); !ok || p.Status != pitch.StatusCancelled {
+		t.Errorf("occurrence %+v, want kept as cancelled", p)
+	}
+}
+
+func TestGetNext(t *testing.T) {
+	s := testStore(t)
+	addPitch(t, s, "42", "Marc", time.Now().Add(time.Hour))
+	get := func(url string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, url, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		getNext(s)(w, r)
+		return w
+	}
+	w := get("/next", nil)
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if w.Code != http.StatusOK || len(etag) == 0 || len(lastModified) == 0 {
+		t.Fatalf("status %d, ETag %q, Last-Modified %q", w.Code, etag, lastModified)
+	}
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   int
+	}{
+		{"same ETag", map[string]string{"If-None-Match": etag}, http.StatusNotModified},
+		{"other ETag", map[string]string{"If-None-Match": `"0"`}, http.StatusOK},
+		{"not modified since", map[string]string{"If-Modified-Since": lastModified}, http.StatusNotModified},
+		{"modified since", map[string]string{"If-Modified-Since": time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if w := get("/next", tt.header); w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.want)
+		}
+	}
+
+	// changed
+	p, _ := s.Pitch("42")
+	p.Title = "Go"
+	s.Put(p)
+	if w := get("/next", map[string]string{"If-None-Match": etag}); w.Code != http.StatusOK || w.Header().Get("ETag") == etag {
+		t.Errorf("status %d, ETag %q, want the changed pitch", w.Code, w.Header().Get("ETag"))
+	}
+	if w := get("/next?venue=basement", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown venue: status %d, want %d", w.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+// noShowAfter is the time after the date a scheduled pitch not released is a no-show
+const noShowAfter = releaseWindow
+
+// monthRow is a row of the report of the pitches per month
+type monthRow struct {
+	Month    string `json:"month"`
+	Pitches  int    `json:"pitches"`
+	Released int    `json:"released"`
+	NoShows  int    `json:"noshows"`
+}
+
+// delayRow is a row of the report of the start delays per month, the delays are in seconds
+type delayRow struct {
+	Month        string `json:"month"`
+	Released     int    `json:"released"`
+	AverageDelay int64  `json:"averagedelay"`
+	MaxDelay     int64  `json:"maxdelay"`
+}
+
+// speakerRow is a row of the report of the speakers
+type speakerRow struct {
+	Speaker  string `json:"speaker"`
+	Pitches  int    `json:"pitches"`
+	Released int    `json:"released"`
+	NoShows  int    `json:"noshows"`
+}
+
+// noShowRow is a row of the report of the no-shows
+type noShowRow struct {
+	ID      string    `json:"id"`
+	Date    time.Time `json:"date"`
+	Speaker string    `json:"speaker"`
+	Title   string    `json:"title"`
+	Venue   string    `json:"venue,omitempty"`
+}
+
+// table is a report as header and rows for the CSV export
+type table struct {
+	header []string
+	rows   [][]string
+}
+
+// period is the filter of a report, zero times are not limited
+// the dates and the months of the report are in the timezone loc
+type period struct {
+	venue    string
+	from, to time.Time
+	loc      *time.Location
+}
+
+// contains returns true if t is within the period
+func (p period) contains(t time.Time) bool {
+	return (p.from.IsZero() || !t.Before(p.from)) && (p.to.IsZero() || t.Before(p.to))
+}
+
+// scheduledPitches returns the scheduled pitches (see record.scheduled) in the venue and the period
+func (s *store) scheduledPitches(p period) pitch.Pitches {
+	s.Lock()
+	defer s.Unlock()
+	pitches := pitch.Pitches{}
+	for _, r := range s.records {
+		if r.At(p.venue) && r.scheduled() && p.contains(r.Date) {
+			pitches = append(pitches, s.withVenue(r.Pitch))
+		}
+	}
+	sort.Sort(pitches)
+	return pitches
+}
+
+// noShow returns true if the pitch was not released within the no-show time after its date
+func noShow(p pitch.Pitch, now time.Time) bool {
+	return !p.Released && now.Sub(p.Date) > noShowAfter
+}
+
+// month returns the month of the pitch in loc e.g. 2026-10, all pitches of a report are grouped
+// in the same timezone as they are ordered by date
+func month(p pitch.Pitch, loc *time.Location) string {
+	return p.Date.In(loc).Format("2006-01")
+}
+
+// monthsReport returns the number of pitches, releases and no-shows per month in loc
+func monthsReport(pitches pitch.Pitches, loc *time.Location, now time.Time) ([]monthRow, table) {
+	rows := []monthRow{}
+	for _, p := range pitches {
+		m := month(p, loc)
+		if len(rows) == 0 || rows[len(rows)-1].Month != m {
+			rows = append(rows, monthRow{Month: m})
+		}
+		row := &rows[len(rows)-1]
+		row.Pitches++
+		if p.Released {
+			row.Released++
+		}
+		if noShow(p, now) {
+			row.NoShows++
+		}
+	}
+	t := table{header: []string{"month", "pitches", "released", "noshows"}}
+	for _, r := range rows {
+		t.rows = append(t.rows, []string{r.Month, strconv.Itoa(r.Pitches), strconv.Itoa(r.Released), strconv.Itoa(r.NoShows)})
+	}
+	return rows, t
+}
+
+// delaysReport returns the average and maximal start delay (release vs. date) per month in loc,
+// the last row "all" covers the whole period
+func delaysReport(pitches pitch.Pitches, loc *time.Location) ([]delayRow, table) {
+	rows := []delayRow{}
+	var total, sum time.Duration
+	all := delayRow{Month: "all"}
+	add := func(row *delayRow, delay time.Duration) {
+		row.Released++
+		if d := int64(delay / time.Second); d > row.MaxDelay || row.Released == 1 {
+			row.MaxDelay = d
+		}
+	}
+	for _, p := range pitches {
+		if !p.Released {
+			continue
+		}
+		m := month(p, loc)
+		if len(rows) == 0 || rows[len(rows)-1].Month != m {
+			rows = append(rows, delayRow{Month: m})
+			sum = 0
+		}
+		row := &rows[len(rows)-1]
+		delay := p.ReleasedAt.Sub(p.Date)
+		add(row, delay)
+		sum += delay
+		row.AverageDelay = int64(sum / time.Duration(row.Released) / time.Second)
+		add(&all, delay)
+		total += delay
+	}
+	if all.Released > 0 {
+		all.AverageDelay = int64(total / time.Duration(all.Released) / time.Second)
+	}
+	rows = append(rows, all)
+	t := table{header: []string{"month", "released", "average_delay_seconds", "max_delay_seconds"}}
+	for _, r := range rows {
+		t.rows = append(t.rows, []string{r.Month, strconv.Itoa(r.Released), strconv.FormatInt(r.AverageDelay, 10), strconv.FormatInt(r.MaxDelay, 10)})
+	}
+	return rows, t
+}
+
+// speakersReport returns the speakers ordered by the number of pitches, at most limit (0: all)
+func speakersReport(pitches pitch.Pitches, now time.Time, limit int) ([]speakerRow, table) {
+	bySpeaker := make(map[string]*speakerRow)
+	for _, p := range pitches {
+		row, ok := bySpeaker[p.Speaker]
+		if !ok {
+			row = &speakerRow{Speaker: p.Speaker}
+			bySpeaker[p.Speaker] = row
+		}
+		row.Pitches++
+		if p.Released {
+			row.Released++
+		}
+		if noShow(p, now) {
+			row.NoShows++
+		}
+	}
+	rows := make([]speakerRow, 0, len(bySpeaker))
+	for _, row := range bySpeaker {
+		rows = append(rows, *row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Pitches != rows[j].Pitches {
+			return rows[i].Pitches > rows[j].Pitches
+		}
+		return rows[i].Speaker < rows[j].Speaker
+	})
+	if limit > 0 && len(rows) > limit {
+		rows = rows[:limit]
+	}
+	t := table{header: []string{"speaker", "pitches", "released", "noshows"}}
+	for _, r := range rows {
+		t.rows = append(t.rows, []string{r.Speaker, strconv.Itoa(r.Pitches), strconv.Itoa(r.Released), strconv.Itoa(r.NoShows)})
+	}
+	return rows, t
+}
+
+// noShowsReport returns the pitches not released within the no-show time after their date
+func noShowsReport(pitches pitch.Pitches, now time.Time) ([]noShowRow, table) {
+	rows := []noShowRow{}
+	t := table{header: []string{"id", "date", "speaker", "title", "venue"}}
+	for _, p := range pitches {
+		if !noShow(p, now) {
+			continue
+		}
+		rows = append(rows, noShowRow{ID: p.ID, Date: p.Date, Speaker: p.Speaker, Title: p.Title, Venue: p.Venue})
+		t.rows = append(t.rows, []string{p.ID, p.Date.Format(time.RFC3339), p.Speaker, p.Title, p.Venue})
+	}
+	return rows, t
+}
+
+// eventsReport returns the history as table
+func eventsReport(events []event) ([]event, table) {
+	t := table{header: []string{"time", "pitch", "event", "date", "speaker", "title", "device", "reason"}}
+	for _, e := range events {
+		t.rows = append(t.rows, []string{e.Time.Format(time.RFC3339), e.Pitch, e.Event, e.Date.Format(time.RFC3339), e.Speaker, e.Title, e.Device, e.Reason})
+	}
+	return events, t
+}
+
+// reportLocation returns the timezone of the venue or of the server if the venue has none
+func (s *store) reportLocation(venue string) *time.Location {
+	s.Lock()
+	defer s.Unlock()
+	p := pitch.Pitch{Timezone: s.timezone}
+	if v, ok := s.venues[venue]; ok && len(v.Timezone) > 0 {
+		p.Timezone = v.Timezone
+	}
+	return p.Location(time.UTC)
+}
+
+// reportPeriod returns the period given by ?venue=, ?from= and ?to= (dates e.g. 2026-01-31, to is exclusive)
+// in the timezone of the venue or of the server (see reportLocation)
+func reportPeriod(s *store, r *http.Request) (period, error) {
+	q := r.URL.Query()
+	p := period{venue: q.Get("venue")}
+	p.loc = s.reportLocation(p.venue)
+	for _, f := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &p.from}, {"to", &p.to}} {
+		v := q.Get(f.name)
+		if len(v) == 0 {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", v, p.loc)
+		if err != nil {
+			return p, fmt.Errorf("%s: %q is not a date e.g. 2026-01-31", f.name, v)
+		}
+		*f.t = t
+	}
+	return p, nil
+}
+
+// getReport returns the report given by the URL: months, delays, speakers (?limit=), noshows or events
+// as JSON or as CSV with ?format=csv or Accept: text/csv
+func getReport(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		p, err := reportPeriod(s, r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		name := chi.URLParam(r, "name")
+		var data interface{}
+		var t table
+		switch name {
+		case "months":
+			data, t = monthsReport(s.scheduledPitches(p), p.loc, now)
+		case "delays":
+			data, t = delaysReport(s.scheduledPitches(p), p.loc)
+		case "speakers":
+			limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+			data, t = speakersReport(s.scheduledPitches(p), now, limit)
+		case "noshows":
+			data, t = noShowsReport(s.scheduledPitches(p), now)
+		case "events":
+			data, t = eventsReport(s.Events(p.venue, p.from, p.to))
+		default:
+			http.Error(w, fmt.Sprintf("no such report: %s", name), http.StatusNotFound)
+			return
+		}
+		if r.URL.Query().Get("format") != "csv" && !strings.Contains(r.Header.Get("Accept"), "text/csv") {
+			render.JSON(w, r, data)
+			return
+		}
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".csv"))
+		cw := csv.NewWriter(w)
+		cw.Write(t.header)
+		cw.WriteAll(t.rows)
+		if err := cw.Error(); err != nil {
+			s.requestLogger(r).Error("writing report failed", "report", name, "error", err)
+		}
+	}
+}
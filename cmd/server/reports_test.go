@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+func TestMonthsReport(t *testing.T) {
+	zurich, err := time.LoadLocation("Europe/Zurich")
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := func(s string) time.Time {
+		d, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+	// ordered by date, the months differ in the timezones of the pitches
+	pitches := pitch.Pitches{
+		{ID: "1", Date: date("2026-01-31T23:30:00Z"), Timezone: "Europe/Zurich", Released: true},
+		{ID: "2", Date: date("2026-01-31T23:45:00Z"), Timezone: "UTC"},
+		{ID: "3", Date: date("2026-02-02T18:00:00Z"), Timezone: "America/New_York", Released: true},
+		{ID: "4", Date: date("2026-03-01T00:30:00Z"), Timezone: "UTC"},
+	}
+	now := date("2026-03-01T01:00:00Z")
+	rows, tbl := monthsReport(pitches, zurich, now)
+	want := []monthRow{
+		{Month: "2026-02", Pitches: 3, Released: 2, NoShows: 1},
+		{Month: "2026-03", Pitches: 1},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows %+v, want %+v", rows, want)
+	}
+	if len(tbl.rows) != len(want) {
+		t.Errorf("%d table rows, want %d", len(tbl.rows), len(want))
+	}
+	rows, _ = monthsReport(pitches, time.UTC, now)
+	if len(rows) != 3 || rows[0].Month != "2026-01" || rows[0].Pitches != 2 {
+		t.Errorf("UTC rows %+v", rows)
+	}
+}
+
+func TestReportLocation(t *testing.T) {
+	s := testStore(t)
+	if _, err := s.PutVenue(pitch.Venue{ID: "nyc", Timezone: "America/New_York"}); err != nil {
+		t.Fatal(err)
+	}
+	for venue, want := range map[string]string{"": "Europe/Zurich", "nyc": "America/New_York", "unknown": "Europe/Zurich"} {
+		if loc := s.reportLocation(venue); loc.String() != want {
+			t.Errorf("venue %q: %s, want %s", venue, loc, want)
+		}
+	}
+}
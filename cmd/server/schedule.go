@@ -0,0 +1,69 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+)
+
+// scheduleTemplate renders the schedule, t is the message catalog of the locale
+var scheduleTemplate = template.Must(template.New("schedule").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale.Language}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Locale.T "schedule.title"}}</title>
+</head>
+<body>
+<h1>{{.Locale.T "schedule.title"}}</h1>
+{{if .Venues}}
+<p><a href="?lang={{.Locale.Language}}">{{.Locale.T "schedule.all"}}</a>{{range .Venues}} | <a href="?lang={{$.Locale.Language}}&amp;venue={{.ID}}">{{.Name}}</a>{{end}}</p>
+{{end}}
+{{if .Pitches}}
+<table>
+<tr><th>{{.Locale.T "schedule.date"}}</th><th>{{.Locale.T "schedule.venue"}}</th><th>{{.Locale.T "schedule.speaker"}}</th><th>{{.Locale.T "schedule.pitch"}}</th></tr>
+{{range .Pitches}}<tr><td>{{.Date}}</td><td>{{.Venue}}</td><td>{{.Speaker}}</td><td>{{.Title}}</td></tr>
+{{end}}</table>
+{{else}}
+<p>{{.Locale.T "schedule.empty"}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+// scheduleRow is a pitch with the date formatted in its timezone
+type scheduleRow struct {
+	ID      string
+	Date    string
+	Venue   string
+	Speaker string
+	Title   string
+}
+
+// scheduleHandler serves the schedule as HTML page in the language of the browser or ?lang=,
+// ?venue= shows the pitches in a venue only
+func scheduleHandler(s *store, language, timezone string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		locale, err := requestLocale(r, language, timezone)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rows := []scheduleRow{}
+		for _, p := range s.PublicPitches(r.URL.Query().Get("venue")) {
+			rows = append(rows, scheduleRow{
+				Date:    locale.In(p.Location(locale.Location)).Date(p.Date),
+				Venue:   p.VenueName,
+				Speaker: p.Speaker,
+				Title:   p.Title,
+			})
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err = scheduleTemplate.Execute(w, map[string]interface{}{
+			"Locale":  locale,
+			"Pitches": rows,
+			"Venues":  s.Venues(),
+		})
+		if err != nil {
+			s.requestLogger(r).Error("rendering schedule failed", "error", err)
+		}
+	}
+}
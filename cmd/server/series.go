@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+// errSeriesNotFound is returned for an unknown series
+var errSeriesNotFound = errors.New("series not found")
+
+// PutSeries adds or updates a series and materializes its occurrences
+func (s *store) PutSeries(sr pitch.Series) (pitch.Series, error) {
+	s.Lock()
+	defer s.Unlock()
+	timezone := s.timezone
+	if len(sr.Venue) > 0 {
+		v, ok := s.venues[sr.Venue]
+		if !ok {
+			return sr, fmt.Errorf("no such venue: %s", sr.Venue)
+		}
+		if len(v.Timezone) > 0 {
+			timezone = v.Timezone
+		}
+	}
+	if err := sr.Validate(timezone); err != nil {
+		return sr, err
+	}
+	s.series[sr.ID] = &sr
+	s.materialize(sr.ID, time.Now())
+	s.changed()
+	return sr, nil
+}
+
+// DeleteSeries removes a series and cancels its future occurrences without speaker
+func (s *store) DeleteSeries(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.series[id]; !ok {
+		return errSeriesNotFound
+	}
+	delete(s.series, id)
+	s.materialize(id, time.Now())
+	s.changed()
+	return nil
+}
+
+// Series returns all series ordered by id
+func (s *store) Series() []pitch.Series {
+	s.Lock()
+	defer s.Unlock()
+	series := make([]pitch.Series, 0, len(s.series))
+	for _, sr := range s.series {
+		series = append(series, *sr)
+	}
+	sort.Slice(series, func(i, j int) bool { return series[i].ID < series[j].ID })
+	return series
+}
+
+// Materialize creates the occurrences of all series within the horizon
+func (s *store) Materialize(now time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	changed := false
+	for id := range s.series {
+		changed = s.materialize(id, now) || changed
+	}
+	if changed {
+		s.changed()
+	}
+}
+
+// reasonRemoved is the reason in the history of an occurrence no longer part of its series
+const reasonRemoved = "removed from the series"
+
+// materialize creates the missing occurrences of the series id from now until the horizon
+// and cancels future occurrences no longer part of the series (see tombstone), the caller has to hold the lock
+// occurrences changed through the API (e.g. a speaker assigned) are kept
+func (s *store) materialize(id string, now time.Time) bool {
+	occurrences := []pitch.Pitch{}
+	if sr, ok := s.series[id]; ok {
+		var err error
+		if occurrences, err = sr.Occurrences(now, now.Add(s.horizon)); err != nil {
+			s.logger.Error("series not valid", "series", id, "error", err)
+			return false
+		}
+	}
+	changed := false
+	wanted := make(map[string]bool)
+	for _, p := range occurrences {
+		wanted[p.ID] = true
+		if r, ok := s.records[p.ID]; ok {
+			// an occurrence removed from the series before is part of it again
+			if r.Source == sourceSeries && r.Status == pitch.StatusCancelled {
+				p.RegisteredAt = r.RegisteredAt
+				r.Pitch, r.Modified = p, now
+				s.addHistory(r, now, pitch.HistoryCreated, r.Speaker, r.Title, "")
+				changed = true
+			}
+			continue
+		}
+		p.RegisteredAt = now
+		r := &record{Pitch: p, Source: sourceSeries, Modified: now}
+		s.addHistory(r, now, pitch.HistoryCreated, r.Speaker, r.Title, "")
+		s.records[p.ID] = r
+		changed = true
+	}
+	for rid, r := range s.records {
+		if r.Series == id && r.Source == sourceSeries && r.Status != pitch.StatusCancelled && r.Date.After(now) && !wanted[rid] {
+			s.tombstone(r, reasonRemoved, now)
+			changed = true
+		}
+	}
+	return changed
+}
+
+// skip adds the occurrence to the excepted dates of its series, the caller has to hold the lock
+func (s *store) skip(r *record) {
+	sr, ok := s.series[r.Series]
+	if !ok {
+		return
+	}
+	if err := sr.Skip(r.ID); err != nil {
+		s.logger.Error("skipping occurrence failed", "pitch", r.ID, "error", err)
+	}
+}
+
+// RunSeries materializes the occurrences of the series every interval until ctx is done
+func (s *store) RunSeries(ctx context.Context, interval time.Duration) error {
+	s.Materialize(time.Now())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.Materialize(time.Now())
+		}
+	}
+}
+
+// listSeries returns all series
+func listSeries(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, s.Series())
+	}
+}
+
+// putSeries adds or updates a series, the id is taken from the URL if present
+func putSeries(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var sr pitch.Series
+		if err := json.NewDecoder(r.Body).Decode(&sr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if id := chi.URLParam(r, "id"); len(id) > 0 {
+			sr.ID = id
+		}
+		sr, err := s.PutSeries(sr)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		render.JSON(w, r, sr)
+	}
+}
+
+// deleteSeries removes a series
+func deleteSeries(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.DeleteSeries(chi.URLParam(r, "id")); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
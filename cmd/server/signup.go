@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/i18n"
+	"github.com/marcsauter/buzzer/pkg/logging"
+	"github.com/marcsauter/buzzer/pkg/notify"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/mholt/binding"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+// maximal length of the fields of a sign-up
+const (
+	maxSpeakerLength  = 100
+	maxTitleLength    = 200
+	maxAbstractLength = 2000
+)
+
+// signUp is the sign-up of a speaker for an open slot
+type signUp struct {
+	Slot     string `json:"slot"`
+	Speaker  string `json:"speaker"`
+	Title    string `json:"title"`
+	Abstract string `json:"abstract"`
+	Contact  string `json:"contact"`
+}
+
+// FieldMap implements the FieldMapper interface for github.com/mholt/binding
+func (f *signUp) FieldMap(r *http.Request) binding.FieldMap {
+	return binding.FieldMap{
+		&f.Slot:     binding.Field{Form: "slot", Required: true},
+		&f.Speaker:  binding.Field{Form: "speaker", Required: true},
+		&f.Title:    binding.Field{Form: "title", Required: true},
+		&f.Abstract: "abstract",
+		&f.Contact:  binding.Field{Form: "contact", Required: true},
+	}
+}
+
+// validate checks the length of the fields and the contact address
+func (f *signUp) validate() error {
+	f.Speaker, f.Title, f.Abstract = strings.TrimSpace(f.Speaker), strings.TrimSpace(f.Title), strings.TrimSpace(f.Abstract)
+	switch {
+	case len(f.Speaker) == 0 || len(f.Speaker) > maxSpeakerLength:
+		return fmt.Errorf("speaker is required and limited to %d characters", maxSpeakerLength)
+	case len(f.Title) == 0 || len(f.Title) > maxTitleLength:
+		return fmt.Errorf("title is required and limited to %d characters", maxTitleLength)
+	case len(f.Abstract) > maxAbstractLength:
+		return fmt.Errorf("abstract is limited to %d characters", maxAbstractLength)
+	}
+	a, err := mail.ParseAddress(f.Contact)
+	if err != nil {
+		return fmt.Errorf("contact %q is not an e-mail address", f.Contact)
+	}
+	f.Contact = a.Address
+	return nil
+}
+
+// errNotPending is returned if a pitch without sign-up is approved or rejected
+var errNotPending = errors.New("pitch is not pending")
+
+// OpenSlots returns the future open slots in venue, slots with a pending sign-up are not open
+func (s *store) OpenSlots(venue string, now time.Time) pitch.Pitches {
+	slots := pitch.Pitches{}
+	for _, p := range s.Pitches(venue) {
+		if p.Open() && len(p.Status) == 0 && p.Date.After(now) {
+			slots = append(slots, p)
+		}
+	}
+	return slots
+}
+
+// SignUp assigns the speaker to the open slot, the pitch is pending until an organizer approves it
+// the speaker of a slot already taken is added to its waitlist, the returned pitch is the sign-up
+func (s *store) SignUp(f signUp, now time.Time) (p pitch.Pitch, waitlisted bool, err error) {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.records[f.Slot]
+	if !ok || r.Status == pitch.StatusRejected || r.Status == pitch.StatusCancelled || !r.Date.After(now) {
+		return pitch.Pitch{}, false, fmt.Errorf("slot %s is not open", f.Slot)
+	}
+	r.Modified = now
+	if !r.Open() || len(r.Status) > 0 {
+		if r.Contact == f.Contact || r.waitlisted(f.Contact) {
+			return pitch.Pitch{}, false, fmt.Errorf("%s is already signed up for slot %s", f.Contact, f.Slot)
+		}
+		r.Waitlist = append(r.Waitlist, pitch.Candidate{Speaker: f.Speaker, Title: f.Title, Abstract: f.Abstract, Contact: f.Contact, Added: now})
+		s.addHistory(r, now, pitch.HistoryWaitlisted, f.Speaker, f.Title, "")
+		s.changed()
+		p = s.withVenue(r.Pitch)
+		p.Speaker, p.Title, p.Abstract, p.Contact, p.Status = f.Speaker, f.Title, f.Abstract, f.Contact, ""
+		return p, true, nil
+	}
+	r.Speaker, r.Title, r.Abstract, r.Contact = f.Speaker, f.Title, f.Abstract, f.Contact
+	r.Status = pitch.StatusPending
+	// changes of the series keep the sign-up
+	r.Source = sourceAPI
+	s.addHistory(r, now, pitch.HistorySignUp, f.Speaker, f.Title, "")
+	s.changed()
+	return s.withVenue(r.Pitch), false, nil
+}
+
+// Decide approves or rejects a pending pitch and returns it as it was signed up
+// a rejected slot is offered to the next speaker of the waitlist or open again
+func (s *store) Decide(id string, approve bool, reason string, now time.Time) (pitch.Pitch, *pitch.Offer, error) {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return pitch.Pitch{}, nil, errPitchNotFound
+	}
+	if r.Status != pitch.StatusPending {
+		return pitch.Pitch{}, nil, errNotPending
+	}
+	r.Modified = now
+	if approve {
+		r.Status = pitch.StatusApproved
+		s.addHistory(r, now, pitch.HistoryApproved, r.Speaker, r.Title, "")
+		s.changed()
+		return s.withVenue(r.Pitch), nil, nil
+	}
+	decided := r.Pitch
+	decided.Status = pitch.StatusRejected
+	s.addHistory(r, now, pitch.HistoryRejected, r.Speaker, r.Title, reason)
+	s.vacate(r)
+	offer := s.offerNext(r, now)
+	s.changed()
+	return s.withVenue(decided), offer, nil
+}
+
+// public returns p as shown on the devices and the public pages
+// the contact is removed, the sign-up of a pending pitch is not shown and the slot stays open
+// (an offered slot has no speaker until the offer is accepted)
+func (s *store) public(p pitch.Pitch) pitch.Pitch {
+	p.Contact = ""
+	if p.Status == pitch.StatusPending {
+		p.Speaker, p.Abstract = "", ""
+		if sr, ok := s.series[p.Series]; ok {
+			p.Title = sr.Title
+		}
+	}
+	return p
+}
+
+// PublicPitches returns the pitches in venue as shown on the public pages, rejected and cancelled pitches are omitted
+func (s *store) PublicPitches(venue string) pitch.Pitches {
+	pitches := s.Pitches(venue)
+	s.Lock()
+	defer s.Unlock()
+	public := make(pitch.Pitches, 0, len(pitches))
+	for _, p := range pitches {
+		if p.Status != pitch.StatusRejected && p.Status != pitch.StatusCancelled {
+			public = append(public, s.public(p))
+		}
+	}
+	return public
+}
+
+// deliver sends the notification in the background, errors are logged to logger
+func deliver(logger *slog.Logger, n notify.Notifier, no notify.Notification) {
+	no.Time = time.Now()
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := n.Notify(logging.NewContext(ctx, logger), no); err != nil {
+			logger.Error("notification failed", "event", no.Event, "pitch", no.Pitch.ID, "error", err)
+		}
+	}()
+}
+
+// signUpTemplate renders the sign-up form and the confirmation
+var signUpTemplate = template.Must(template.New("signup").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale.Language}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Locale.T "signup.title"}}</title>
+</head>
+<body>
+<h1>{{.Locale.T "signup.title"}}</h1>
+{{if .Waitlisted}}
+<p>{{.Locale.T "signup.waitlisted"}}</p>
+{{else if .Done}}
+<p>{{.Locale.T "signup.thanks"}}</p>
+{{else if .Slots}}
+{{with .Error}}<p><strong>{{.}}</strong></p>{{end}}
+<form method="post">
+<p><label>{{.Locale.T "signup.slot"}}<br><select name="slot">{{range .Slots}}<option value="{{.ID}}">{{.Date}}{{with .Venue}} - {{.}}{{end}}{{if .Taken}} ({{$.Locale.T "signup.waitlist"}}){{end}}</option>{{end}}</select></label></p>
+<p><label>{{.Locale.T "signup.speaker"}}<br><input name="speaker" maxlength="100" required></label></p>
+<p><label>{{.Locale.T "signup.pitch"}}<br><input name="title" maxlength="200" required></label></p>
+<p><label>{{.Locale.T "signup.abstract"}}<br><textarea name="abstract" maxlength="2000" rows="6" cols="60"></textarea></label></p>
+<p><label>{{.Locale.T "signup.contact"}}<br><input name="contact" type="email" required></label></p>
+<p><button type="submit">{{.Locale.T "signup.submit"}}</button></p>
+</form>
+{{else}}
+<p>{{.Locale.T "signup.none"}}</p>
+{{end}}
+</body>
+</html>
+`))
+
+// requestLocale returns the locale of ?lang= or of the browser
+func requestLocale(r *http.Request, language, timezone string) (*i18n.Locale, error) {
+	lang := r.URL.Query().Get("lang")
+	if len(lang) == 0 {
+		lang = i18n.Match(r.Header.Get("Accept-Language"), language)
+	}
+	return i18n.New(lang, timezone)
+}
+
+// slotRow is a slot of the sign-up form, a speaker signing up for a taken slot is added to its waitlist
+type slotRow struct {
+	scheduleRow
+	Taken bool
+}
+
+// signUpPage renders the sign-up form with the future slots in the venue given by ?venue=
+func signUpPage(w http.ResponseWriter, r *http.Request, s *store, locale *i18n.Locale, done, waitlisted bool, msg string) {
+	slots := []slotRow{}
+	now := time.Now()
+	for _, p := range s.PublicPitches(r.URL.Query().Get("venue")) {
+		if !p.Date.After(now) {
+			continue
+		}
+		slots = append(slots, slotRow{
+			scheduleRow: scheduleRow{
+				ID:    p.ID,
+				Date:  locale.In(p.Location(locale.Location)).Date(p.Date),
+				Venue: p.VenueName,
+			},
+			Taken: !p.Open() || len(p.Status) > 0,
+		})
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if len(msg) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	err := signUpTemplate.Execute(w, map[string]interface{}{
+		"Locale":     locale,
+		"Slots":      slots,
+		"Done":       done,
+		"Waitlisted": waitlisted,
+		"Error":      msg,
+	})
+	if err != nil {
+		s.requestLogger(r).Error("rendering sign-up failed", "error", err)
+	}
+}
+
+// signUpForm serves the sign-up form in the language of the browser or ?lang=
+func signUpForm(s *store, language, timezone string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		locale, err := requestLocale(r, language, timezone)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		signUpPage(w, r, s, locale, false, false, "")
+	}
+}
+
+// postSignUp signs a speaker up for an open slot or the waitlist of a taken slot and notifies the organizers
+// a form is answered with the confirmation page, JSON with the pending pitch
+func postSignUp(s *store, n notify.Notifier, language, timezone string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		form := strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+		locale, err := requestLocale(r, language, timezone)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f := signUp{}
+		if errs := binding.Bind(r, &f); len(errs) > 0 {
+			if form {
+				signUpPage(w, r, s, locale, false, false, errs.Error())
+				return
+			}
+			errs.Handle(w)
+			return
+		}
+		err = f.validate()
+		var p pitch.Pitch
+		var waitlisted bool
+		if err == nil {
+			p, waitlisted, err = s.SignUp(f, time.Now())
+		}
+		if err != nil {
+			if form {
+				signUpPage(w, r, s, locale, false, false, err.Error())
+				return
+			}
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		if waitlisted {
+			deliver(s.requestLogger(r), n, notify.Notification{Event: notify.EventWaitlisted, Recipient: p.Contact, Pitch: p})
+		} else {
+			deliver(s.requestLogger(r), n, notify.Notification{Event: notify.EventSignUp, Pitch: p})
+		}
+		if form {
+			signUpPage(w, r, s, locale, true, waitlisted, "")
+			return
+		}
+		render.Status(r, http.StatusCreated)
+		render.JSON(w, r, p)
+	}
+}
+
+// listSlots returns the open slots in the venue given by ?venue=
+func listSlots(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, s.OpenSlots(r.URL.Query().Get("venue"), time.Now()))
+	}
+}
+
+// decision is the optional request body to reject or cancel a pitch
+type decision struct {
+	Reason string `json:"reason"`
+}
+
+// decidePitch approves or rejects a pending pitch and notifies the speaker
+// a rejected slot is offered to the next speaker of the waitlist
+func decidePitch(s *store, n notify.Notifier, approve bool, publicURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var d decision
+		if r.Body != nil && r.ContentLength != 0 {
+			defer r.Body.Close()
+			if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		p, offer, err := s.Decide(chi.URLParam(r, "id"), approve, d.Reason, time.Now())
+		switch {
+		case err == errPitchNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		event := notify.EventApproved
+		if !approve {
+			event = notify.EventRejected
+		}
+		deliver(s.requestLogger(r), n, notify.Notification{Event: event, Recipient: p.Contact, Pitch: p, Reason: d.Reason})
+		notifyOffer(s.requestLogger(r), n, p, offer, publicURL)
+		render.JSON(w, r, p)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/notify"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// notifications receives the notifications delivered in the background
+type notifications chan notify.Notification
+
+func (n notifications) Notify(ctx context.Context, no notify.Notification) error {
+	n <- no
+	return nil
+}
+
+// next returns the next notification delivered
+func (n notifications) next(t *testing.T) notify.Notification {
+	t.Helper()
+	select {
+	case no := <-n:
+		return no
+	case <-time.After(time.Second):
+		t.Fatal("no notification")
+	}
+	return notify.Notification{}
+}
+
+// addSlot adds an open slot on date to s
+func addSlot(t *testing.T, s *store, id string, date time.Time) {
+	t.Helper()
+	if err := s.Add(pitch.Pitch{ID: id, Title: "open", Date: date.UTC(), Timezone: "Europe/Zurich"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenSlots(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	addSlot(t, s, "past", now.Add(-time.Hour))
+	addSlot(t, s, "open", now.Add(time.Hour))
+	addSlot(t, s, "pending", now.Add(2*time.Hour))
+	addPitch(t, s, "taken", "Marc", now.Add(3*time.Hour))
+	if _, _, err := s.SignUp(signUp{Slot: "pending", Speaker: "Jane", Title: "Go", Contact: "jane@example.com"}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	listSlots(s)(rec, httptest.NewRequest(http.MethodGet, "/slots", nil))
+	slots := pitch.Pitches{}
+	if err := json.NewDecoder(rec.Body).Decode(&slots); err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 1 || slots[0].ID != "open" {
+		t.Errorf("slots %+v, want the open one", slots)
+	}
+}
+
+func TestSignUpValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		f     signUp
+		valid bool
+	}{
+		{"valid", signUp{Speaker: " Jane ", Title: "Go", Contact: "Jane <jane@example.com>"}, true},
+		{"speaker missing", signUp{Speaker: " ", Title: "Go", Contact: "jane@example.com"}, false},
+		{"title too long", signUp{Speaker: "Jane", Title: strings.Repeat("x", maxTitleLength+1), Contact: "jane@example.com"}, false},
+		{"abstract too long", signUp{Speaker: "Jane", Title: "Go", Abstract: strings.Repeat("x", maxAbstractLength+1), Contact: "jane@example.com"}, false},
+		{"contact not valid", signUp{Speaker: "Jane", Title: "Go", Contact: "jane"}, false},
+	}
+	for _, tt := range tests {
+		err := tt.f.validate()
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+	}
+	f := signUp{Speaker: " Jane ", Title: "Go", Contact: "Jane <jane@example.com>"}
+	if f.validate(); f.Speaker != "Jane" || f.Contact != "jane@example.com" {
+		t.Errorf("sign-up not normalized: %+v", f)
+	}
+}
+
+func TestPostSignUp(t *testing.T) {
+	s := testStore(t)
+	n := make(notifications, 10)
+	h := postSignUp(s, n, "en", "Europe/Zurich")
+	addSlot(t, s, "42", time.Now().Add(time.Hour))
+
+	post := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	// sign-up for the open slot
+	w := post(`{"slot": "42", "speaker": "Jane", "title": "Go", "abstract": "Why Go", "contact": "jane@example.com"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	p := pitch.Pitch{}
+	if err := json.NewDecoder(w.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != "42" || p.Speaker != "Jane" || p.Status != pitch.StatusPending {
+		t.Errorf("pitch %+v, want pending", p)
+	}
+	no := n.next(t)
+	if no.Event != notify.EventSignUp || len(no.Recipient) > 0 || no.Pitch.Speaker != "Jane" || no.Pitch.Title != "Go" ||
+		no.Pitch.Abstract != "Why Go" || no.Pitch.Contact != "jane@example.com" || no.Time.IsZero() {
+		t.Errorf("notification %+v, want the sign-up to the organizers", no)
+	}
+
+	// the slot is taken, the speaker is added to the waitlist
+	if w := post(`{"slot": "42", "speaker": "Anna", "title": "Rust", "contact": "anna@example.com"}`); w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	no = n.next(t)
+	if no.Event != notify.EventWaitlisted || no.Recipient != "anna@example.com" || no.Pitch.Speaker != "Anna" {
+		t.Errorf("notification %+v, want waitlisted to Anna", no)
+	}
+	if p, _ := s.Pitch("42"); p.Speaker != "Jane" {
+		t.Errorf("speaker %s, want Jane", p.Speaker)
+	}
+
+	// not valid
+	for _, body := range []string{
+		`{"slot": "42", "speaker": "Anna", "title": "Rust", "contact": "anna@example.com"}`,
+		`{"slot": "43", "speaker": "Anna", "title": "Rust", "contact": "anna@example.com"}`,
+		`{"slot": "42", "speaker": "Anna", "title": "Rust", "contact": "anna"}`,
+	} {
+		if w := post(body); w.Code != http.StatusUnprocessableEntity {
+			t.Errorf("%s: status %d, want %d", body, w.Code, http.StatusUnprocessableEntity)
+		}
+	}
+	select {
+	case no := <-n:
+		t.Errorf("notification %+v of a sign-up not valid", no)
+	default:
+	}
+}
+
+func TestPostSignUpForm(t *testing.T) {
+	s := testStore(t)
+	n := make(notifications, 10)
+	h := postSignUp(s, n, "en", "Europe/Zurich")
+	addSlot(t, s, "42", time.Now().Add(time.Hour))
+
+	form := url.Values{"slot": {"42"}, "speaker": {"Jane"}, "title": {"Go"}, "contact": {"jane@example.com"}}
+	r := httptest.NewRequest(http.MethodPost, "/signup", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h(w, r)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Thank you!") {
+		t.Errorf("status %d: %s", w.Code, w.Body)
+	}
+	if no := n.next(t); no.Event != notify.EventSignUp {
+		t.Errorf("notification %+v, want the sign-up", no)
+	}
+
+	// the slot is no longer open, the form offers the waitlist
+	w = httptest.NewRecorder()
+	signUpForm(s, "en", "Europe/Zurich")(w, httptest.NewRequest(http.MethodGet, "/signup", nil))
+	if !strings.Contains(w.Body.String(), `<option value="42">`) || !strings.Contains(w.Body.String(), "waitlist") {
+		t.Errorf("slot 42 not offered with the waitlist:\n%s", w.Body)
+	}
+}
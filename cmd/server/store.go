@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// store holds the server state and persists it in the cache file
+type store struct {
+	sync.Mutex
+	logger   *slog.Logger
+	cache    string
+	timezone string
+	horizon  time.Duration
+	deadline time.Duration
+	modified time.Time
+	err      error
+	records  map[string]*record
+	venues   map[string]*pitch.Venue
+	series   map[string]*pitch.Series
+	devices  map[string]*device.Device
+	commands map[string][]device.Command
+	users    map[string]*user
+	pins     map[string]*pin
+	// observe is called for every entry added to the history of a pitch (see Observe)
+	observe func(pitch.Pitch, pitch.HistoryEntry)
+}
+
+// snapshot is the persisted form of the store
+type snapshot struct {
+	Pitches []*record        `json:"pitches"`
+	Venues  []*pitch.Venue   `json:"venues,omitempty"`
+	Series  []*pitch.Series  `json:"series,omitempty"`
+	Devices []*device.Device `json:"devices,omitempty"`
+	Users   []*user          `json:"users,omitempty"`
+	PINs    []*pin           `json:"pins,omitempty"`
+}
+
+// newStore returns a store initialized from the cache file,
+// timezone is the timezone of pitches posted without one, horizon the time the occurrences of a series are created in advance,
+// deadline the time a slot is offered to a speaker of the waitlist
+func newStore(cache, timezone string, horizon, deadline time.Duration, logger *slog.Logger) *store {
+	s := &store{
+		logger:   logger,
+		cache:    cache,
+		timezone: timezone,
+		horizon:  horizon,
+		deadline: deadline,
+		records:  make(map[string]*record),
+		venues:   make(map[string]*pitch.Venue),
+		series:   make(map[string]*pitch.Series),
+		devices:  make(map[string]*device.Device),
+		commands: make(map[string][]device.Command),
+		users:    make(map[string]*user),
+		pins:     make(map[string]*pin),
+	}
+	if _, err := os.Stat(cache); err != nil {
+		s.modified = time.Now()
+		return s
+	}
+	c, err := ioutil.ReadFile(cache)
+	if err != nil {
+		logger.Error("reading cache failed", "cache", cache, "error", err)
+		s.err = err
+		return s
+	}
+	if err := s.load(c); err != nil {
+		logger.Error("loading cache failed", "cache", cache, "error", err)
+		s.err = err
+	}
+	if fi, err := os.Stat(cache); err == nil {
+		s.modified = fi.ModTime()
+	}
+	return s
+}
+
+// Observe sets fn to be called for every entry added to the history of a pitch with the pitch,
+// it is called with the lock held and must not block, it has to be set before the store is used
+func (s *store) Observe(fn func(pitch.Pitch, pitch.HistoryEntry)) {
+	s.observe = fn
+}
+
+// load restores the store from the cache
+func (s *store) load(c []byte) error {
+	var snap snapshot
+	switch {
+	case bytes.HasPrefix(bytes.TrimSpace(c), []byte("[")):
+		// cache written by an older version contains the pitches only
+		if err := json.Unmarshal(c, &snap.Pitches); err != nil {
+			return err
+		}
+	default:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(c, &fields); err != nil {
+			return err
+		}
+		if _, ok := fields["pitches"]; ok {
+			if err := json.Unmarshal(c, &snap); err != nil {
+				return err
+			}
+			break
+		}
+		// ... or the next pitch only
+		var p pitch.Pitch
+		if err := json.Unmarshal(c, &p); err != nil {
+			return err
+		}
+		snap.Pitches = []*record{{Pitch: p, Source: sourceAPI, Modified: p.RegisteredAt}}
+	}
+	for _, r := range snap.Pitches {
+		if len(r.ID) == 0 {
+			continue
+		}
+		// cache written by an older version may contain dates with an offset
+		if err := r.Normalize(""); err != nil {
+			s.logger.Error("pitch not valid", "pitch", r.ID, "error", err)
+		}
+		s.records[r.ID] = r
+	}
+	for _, v := range snap.Venues {
+		s.venues[v.ID] = v
+	}
+	for _, sr := range snap.Series {
+		s.series[sr.ID] = sr
+	}
+	for _, d := range snap.Devices {
+		s.devices[d.Name] = d
+	}
+	for _, u := range snap.Users {
+		s.users[u.Username] = u
+	}
+	for _, p := range snap.PINs {
+		s.pins[p.Name] = p
+	}
+	return nil
+}
+
+// changed marks the schedule as modified and saves the store, the caller has to hold the lock
+func (s *store) changed() {
+	s.modified = time.Now()
+	s.save()
+}
+
+// save writes the store to the cache file, the caller has to hold the lock
+func (s *store) save() {
+	snap := snapshot{
+		Pitches: make([]*record, 0, len(s.records)),
+	}
+	for _, r := range s.records {
+		snap.Pitches = append(snap.Pitches, r)
+	}
+	for _, v := range s.venues {
+		snap.Venues = append(snap.Venues, v)
+	}
+	for _, sr := range s.series {
+		snap.Series = append(snap.Series, sr)
+	}
+	for _, d := range s.devices {
+		snap.Devices = append(snap.Devices, d)
+	}
+	for _, u := range s.users {
+		snap.Users = append(snap.Users, u)
+	}
+	for _, p := range s.pins {
+		snap.PINs = append(snap.PINs, p)
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		s.logger.Error("encoding cache failed", "error", err)
+		s.err = err
+		return
+	}
+	if s.err = writeFile(s.cache, data); s.err != nil {
+		s.logger.Error("writing cache failed", "cache", s.cache, "error", s.err)
+	}
+}
+
+// writeFile replaces the file name atomically with data, a partially written file is removed
+func writeFile(name string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), filepath.Base(name))
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Check returns an error if the store is locked for more than a second e.g. by a deadlock
+func (s *store) Check() error {
+	locked := make(chan struct{})
+	go func() {
+		s.Lock()
+		s.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+		return nil
+	case <-time.After(time.Second):
+		return errors.New("store locked for more than a second")
+	}
+}
+
+// CheckCache returns the error of the last read or write of the cache file
+func (s *store) CheckCache() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.err != nil {
+		return fmt.Errorf("%s: %w", s.cache, s.err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// testStore returns an empty store with the cache in a temporary directory
+func testStore(t *testing.T) *store {
+	return newStore(filepath.Join(t.TempDir(), "buzzer.cache"), "Europe/Zurich", 8*7*24*time.Hour, 24*time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+// addPitch adds a pitch on date to s
+func addPitch(t *testing.T, s *store, id, speaker string, date time.Time) {
+	t.Helper()
+	if err := s.Add(pitch.Pitch{ID: id, Speaker: speaker, Title: "title of " + speaker, Date: date.UTC(), Timezone: "Europe/Zurich"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// events returns the events of the history of the pitch
+func events(s *store, id string) []string {
+	slot, _ := s.Slot(id)
+	e := []string{}
+	for _, h := range slot.History {
+		e = append(e, h.Event)
+	}
+	return e
+}
+
+func TestCache(t *testing.T) {
+	s := testStore(t)
+	addPitch(t, s, "42", "Marc", time.Now().Add(time.Hour))
+	loaded := newStore(s.cache, s.timezone, s.horizon, s.deadline, s.logger)
+	if loaded.err != nil {
+		t.Fatal(loaded.err)
+	}
+	p, ok := loaded.Pitch("42")
+	if !ok || p.Speaker != "Marc" || len(events(loaded, "42")) != 1 {
+		t.Errorf("pitch not loaded from the cache: %+v", p)
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "buzzer.cache")
+	for _, data := range []string{"first", "second"} {
+		if err := writeFile(name, []byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := ioutil.ReadFile(name); err != nil || string(data) != "second" {
+		t.Errorf("cache %q, %v, want second", data, err)
+	}
+	// a directory is not replaced, the temporary file is removed
+	sub := filepath.Join(dir, "sub")
+	if err := os.Mkdir(sub, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(sub, "file"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(sub, []byte("third")); err == nil {
+		t.Error("directory replaced")
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("%d files, want the cache and the directory only", len(files))
+	}
+}
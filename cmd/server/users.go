@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// user represents an API user
+type user struct {
+	Username string `json:"username"`
+	Hash     []byte `json:"hash"`
+}
+
+// pin represents a named PIN to release the buzzer
+type pin struct {
+	Name string `json:"name"`
+	Hash []byte `json:"hash"`
+}
+
+// credentials is the request body to create users and PINs, the secret is never returned
+type credentials struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// SetUser adds a user or changes the password of an existing user
+func (s *store) SetUser(username, password string) error {
+	if len(username) == 0 || len(password) == 0 {
+		return errors.New("username and password are required")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.users[username] = &user{Username: username, Hash: hash}
+	s.save()
+	return nil
+}
+
+// DeleteUser removes a user
+func (s *store) DeleteUser(username string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.users[username]; !ok {
+		return false
+	}
+	delete(s.users, username)
+	s.save()
+	return true
+}
+
+// Users returns the names of all users
+func (s *store) Users() []string {
+	s.Lock()
+	defer s.Unlock()
+	users := []string{}
+	for name := range s.users {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Authenticate checks username and password of a user
+func (s *store) Authenticate(username, password string) bool {
+	s.Lock()
+	u, ok := s.users[username]
+	s.Unlock()
+	return ok && bcrypt.CompareHashAndPassword(u.Hash, []byte(password)) == nil
+}
+
+// SetPIN adds or changes a PIN
+func (s *store) SetPIN(name, secret string) error {
+	if len(name) == 0 || len(secret) == 0 {
+		return errors.New("name and PIN are required")
+	}
+	for _, c := range secret {
+		if c < '0' || c > '9' {
+			return errors.New("PIN must contain digits only")
+		}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.pins[name] = &pin{Name: name, Hash: hash}
+	s.save()
+	return nil
+}
+
+// DeletePIN removes a PIN
+func (s *store) DeletePIN(name string) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.pins[name]; !ok {
+		return false
+	}
+	delete(s.pins, name)
+	s.save()
+	return true
+}
+
+// PINs returns the names of all PINs
+func (s *store) PINs() []string {
+	s.Lock()
+	defer s.Unlock()
+	pins := []string{}
+	for name := range s.pins {
+		pins = append(pins, name)
+	}
+	sort.Strings(pins)
+	return pins
+}
+
+// VerifyPIN returns the name of the matching PIN
+func (s *store) VerifyPIN(secret string) (string, bool) {
+	s.Lock()
+	pins := make([]*pin, 0, len(s.pins))
+	for _, p := range s.pins {
+		pins = append(pins, p)
+	}
+	s.Unlock()
+	for _, p := range pins {
+		if bcrypt.CompareHashAndPassword(p.Hash, []byte(secret)) == nil {
+			return p.Name, true
+		}
+	}
+	return "", false
+}
+
+// bindCredentials decodes name and secret from the request, the name is taken from the URL if present
+func bindCredentials(w http.ResponseWriter, r *http.Request) (credentials, bool) {
+	defer r.Body.Close()
+	var c credentials
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return c, false
+	}
+	if name := chi.URLParam(r, "name"); len(name) > 0 {
+		c.Name = name
+	}
+	return c, true
+}
+
+// listUsers returns the names of all users
+func listUsers(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, s.Users())
+	}
+}
+
+// setUser adds a user or changes the password
+func setUser(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := bindCredentials(w, r)
+		if !ok {
+			return
+		}
+		if err := s.SetUser(c.Name, c.Secret); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deleteUser removes a user
+func deleteUser(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.DeleteUser(chi.URLParam(r, "name")) {
+			http.Error(w, "user not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listPINs returns the names of all PINs
+func listPINs(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, s.PINs())
+	}
+}
+
+// setPIN adds or changes a PIN
+func setPIN(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := bindCredentials(w, r)
+		if !ok {
+			return
+		}
+		if err := s.SetPIN(c.Name, c.Secret); err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// deletePIN removes a PIN
+func deletePIN(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.DeletePIN(chi.URLParam(r, "name")) {
+			http.Error(w, "PIN not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// verifyPIN checks a PIN entered on a device
+func verifyPIN(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := bindCredentials(w, r)
+		if !ok {
+			return
+		}
+		name, ok := s.VerifyPIN(c.Secret)
+		if !ok {
+			s.requestLogger(r).Warn("invalid PIN")
+			http.Error(w, "invalid PIN", http.StatusForbidden)
+			return
+		}
+		s.requestLogger(r).Info("PIN verified", "pin", name)
+		auditDetail(r, "pin "+name)
+		render.JSON(w, r, credentials{Name: name})
+	}
+}
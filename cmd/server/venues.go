@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+// errVenueNotFound is returned for an unknown venue
+var errVenueNotFound = errors.New("venue not found")
+
+// PutVenue adds or updates a venue and returns it as stored
+func (s *store) PutVenue(v pitch.Venue) (pitch.Venue, error) {
+	if err := v.Validate(); err != nil {
+		return v, err
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.venues[v.ID] = &v
+	s.changed()
+	return v, nil
+}
+
+// DeleteVenue removes a venue, it fails if pitches not cancelled, series or devices are assigned to it
+func (s *store) DeleteVenue(id string) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.venues[id]; !ok {
+		return errVenueNotFound
+	}
+	for _, r := range s.records {
+		if r.Venue == id && r.Status != pitch.StatusCancelled {
+			return fmt.Errorf("venue %s: pitch %s is assigned to it", id, r.ID)
+		}
+	}
+	for _, sr := range s.series {
+		if sr.Venue == id {
+			return fmt.Errorf("venue %s: series %s refers to it", id, sr.ID)
+		}
+	}
+	for _, d := range s.devices {
+		if d.Venue == id {
+			return fmt.Errorf("venue %s: device %s is bound to it", id, d.Name)
+		}
+	}
+	delete(s.venues, id)
+	s.changed()
+	return nil
+}
+
+// Venues returns all venues ordered by name
+func (s *store) Venues() []pitch.Venue {
+	s.Lock()
+	defer s.Unlock()
+	venues := make([]pitch.Venue, 0, len(s.venues))
+	for _, v := range s.venues {
+		venues = append(venues, *v)
+	}
+	sort.Slice(venues, func(i, j int) bool { return venues[i].Name < venues[j].Name })
+	return venues
+}
+
+// DeviceVenue returns the venue the device is bound to
+func (s *store) DeviceVenue(name string) string {
+	s.Lock()
+	defer s.Unlock()
+	if d, ok := s.devices[name]; ok {
+		return d.Venue
+	}
+	return ""
+}
+
+// Validate checks venue, date and timezone of p and converts the date to UTC
+// a pitch without timezone gets the timezone of its venue or the server
+func (s *store) Validate(p *pitch.Pitch) error {
+	s.Lock()
+	defer s.Unlock()
+	timezone := s.timezone
+	if len(p.Venue) > 0 {
+		v, ok := s.venues[p.Venue]
+		if !ok {
+			return fmt.Errorf("no such venue: %s", p.Venue)
+		}
+		if len(v.Timezone) > 0 {
+			timezone = v.Timezone
+		}
+	}
+	p.VenueName = ""
+	return p.Normalize(timezone)
+}
+
+// withVenue returns p with the name of its venue, the caller has to hold the lock
+func (s *store) withVenue(p pitch.Pitch) pitch.Pitch {
+	if v, ok := s.venues[p.Venue]; ok {
+		p.VenueName = v.Name
+	}
+	return p
+}
+
+// requestVenue returns the venue given by ?venue= or the venue of the calling device
+func requestVenue(s *store, r *http.Request) (string, error) {
+	if venue := r.URL.Query().Get("venue"); len(venue) > 0 {
+		s.Lock()
+		defer s.Unlock()
+		if _, ok := s.venues[venue]; !ok {
+			return "", errVenueNotFound
+		}
+		return venue, nil
+	}
+	return s.DeviceVenue(r.Header.Get(device.Header)), nil
+}
+
+// listVenues returns all venues
+func listVenues(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		render.JSON(w, r, s.Venues())
+	}
+}
+
+// putVenue adds or updates a venue, the id is taken from the URL if present
+func putVenue(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		defer r.Body.Close()
+		var v pitch.Venue
+		if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if id := chi.URLParam(r, "id"); len(id) > 0 {
+			v.ID = id
+		}
+		v, err := s.PutVenue(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		render.JSON(w, r, v)
+	}
+}
+
+// deleteVenue removes a venue
+func deleteVenue(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch err := s.DeleteVenue(chi.URLParam(r, "id")); {
+		case err == errVenueNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
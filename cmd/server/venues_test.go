@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/pressly/chi"
+)
+
+func TestDeleteVenue(t *testing.T) {
+	s := testStore(t)
+	router := chi.NewRouter()
+	router.Delete("/venues/:id", deleteVenue(s))
+	remove := func(id string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/venues/"+id, nil))
+		return w.Code
+	}
+	if _, err := s.PutVenue(pitch.Venue{ID: "pflab"}); err != nil {
+		t.Fatal(err)
+	}
+	// the series has no occurrence within the horizon
+	start := time.Now().Add(2 * s.horizon).UTC().Truncate(time.Hour)
+	if _, err := s.PutSeries(pitch.Series{ID: "weekly", Title: "Lightning talk", Venue: "pflab", Start: start, RRule: "FREQ=WEEKLY"}); err != nil {
+		t.Fatal(err)
+	}
+	if code := remove("pflab"); code != http.StatusConflict {
+		t.Errorf("status %d, want %d", code, http.StatusConflict)
+	}
+	if err := s.DeleteSeries("weekly"); err != nil {
+		t.Fatal(err)
+	}
+	if code := remove("pflab"); code != http.StatusNoContent {
+		t.Errorf("status %d, want %d", code, http.StatusNoContent)
+	}
+	if code := remove("pflab"); code != http.StatusNotFound {
+		t.Errorf("status %d, want %d", code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/i18n"
+	"github.com/marcsauter/buzzer/pkg/notify"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/pressly/chi"
+	"github.com/pressly/chi/render"
+)
+
+var (
+	// errNoSpeaker is returned if a pitch without speaker is cancelled
+	errNoSpeaker = errors.New("pitch has no speaker")
+	// errStarted is returned if a pitch already started is cancelled
+	errStarted = errors.New("pitch already started")
+	// errCancelled is returned if a pitch already cancelled is cancelled
+	errCancelled = errors.New("pitch already cancelled")
+	// errOfferNotFound is returned for an unknown or expired offer
+	errOfferNotFound = errors.New("offer not found")
+)
+
+// addHistory adds an entry to the history of the pitch, the caller has to hold the lock
+func (s *store) addHistory(r *record, now time.Time, event, speaker, title, reason string) {
+	s.history(r, pitch.HistoryEntry{Time: now, Event: event, Date: r.Date, Speaker: speaker, Title: title, Reason: reason})
+}
+
+// history adds the entry to the history of the pitch and passes it to the observer, the caller has to hold the lock
+func (s *store) history(r *record, h pitch.HistoryEntry) {
+	r.History = append(r.History, h)
+	if s.observe != nil {
+		s.observe(s.withVenue(r.Pitch), h)
+	}
+}
+
+// waitlisted returns true if contact is on the waitlist of the pitch
+func (r *record) waitlisted(contact string) bool {
+	if r.Offer != nil && r.Offer.Contact == contact {
+		return true
+	}
+	for _, c := range r.Waitlist {
+		if c.Contact == contact {
+			return true
+		}
+	}
+	return false
+}
+
+// vacate removes the speaker from the slot, an occurrence of a series gets the title of the series
+func (s *store) vacate(r *record) {
+	title := ""
+	if sr, ok := s.series[r.Series]; ok {
+		title = sr.Title
+		r.Source = sourceSeries
+	}
+	r.Speaker, r.Title, r.Abstract, r.Contact = "", title, "", ""
+	r.Status = ""
+	r.Offer = nil
+}
+
+// offerNext offers the vacant slot to the first speaker of the waitlist and returns the offer,
+// the offer is valid for the offer deadline but not after the start of the pitch
+// nil is returned if the waitlist is empty or the pitch already started
+func (s *store) offerNext(r *record, now time.Time) *pitch.Offer {
+	if len(r.Waitlist) == 0 || !r.Date.After(now) {
+		return nil
+	}
+	token, err := newToken()
+	if err != nil {
+		s.logger.Error("creating offer failed", "pitch", r.ID, "error", err)
+		return nil
+	}
+	c := r.Waitlist[0]
+	r.Waitlist = r.Waitlist[1:]
+	deadline := now.Add(s.deadline)
+	if deadline.After(r.Date) {
+		deadline = r.Date
+	}
+	r.Offer = &pitch.Offer{Candidate: c, Token: token, Deadline: deadline}
+	r.Status = pitch.StatusOffered
+	s.addHistory(r, now, pitch.HistoryOffered, c.Speaker, c.Title, "")
+	offer := *r.Offer
+	return &offer
+}
+
+// newToken returns a random token of an offer
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Cancel cancels the pitch (see cancel), the cancelled pitch and the offer are returned,
+// the offer is nil if the waitlist is empty
+func (s *store) Cancel(id, reason string, now time.Time) (pitch.Pitch, *pitch.Offer, error) {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.records[id]
+	switch {
+	case !ok:
+		return pitch.Pitch{}, nil, errPitchNotFound
+	case r.Status == pitch.StatusCancelled:
+		return pitch.Pitch{}, nil, errCancelled
+	case r.Open():
+		return pitch.Pitch{}, nil, errNoSpeaker
+	case !r.Date.After(now):
+		return pitch.Pitch{}, nil, errStarted
+	}
+	cancelled := s.withVenue(r.Pitch)
+	offer := s.cancel(r, reason, now)
+	s.changed()
+	return cancelled, offer, nil
+}
+
+// cancel records the cancellation in the history and returns the offer of the slot, the caller has to hold the lock
+// an occurrence of a series is open again and offered to the next speaker of the waitlist as well as a pitch
+// with a waitlist, any other pitch is cancelled outright (see tombstone)
+func (s *store) cancel(r *record, reason string, now time.Time) *pitch.Offer {
+	if _, ok := s.series[r.Series]; !ok && len(r.Waitlist) == 0 {
+		s.tombstone(r, reason, now)
+		return nil
+	}
+	s.addHistory(r, now, pitch.HistoryCancelled, r.Speaker, r.Title, reason)
+	r.Modified = now
+	s.vacate(r)
+	return s.reoffer(r, now)
+}
+
+// tombstone records the cancellation in the history and cancels the pitch outright, it is kept with its speaker
+// and the history but no longer shown (see pitch.StatusCancelled), the caller has to hold the lock
+func (s *store) tombstone(r *record, reason string, now time.Time) {
+	s.addHistory(r, now, pitch.HistoryCancelled, r.Speaker, r.Title, reason)
+	r.Status, r.Offer, r.Waitlist = pitch.StatusCancelled, nil, nil
+	r.Modified = now
+}
+
+// reasonUnfilled is the reason in the history of a slot cancelled because nobody of the waitlist took it
+const reasonUnfilled = "no speaker of the waitlist took the slot"
+
+// reoffer offers the vacant slot to the next speaker of the waitlist, a slot that is not an occurrence of a series
+// is cancelled if nobody is left (see tombstone), the caller has to hold the lock
+func (s *store) reoffer(r *record, now time.Time) *pitch.Offer {
+	offer := s.offerNext(r, now)
+	if _, ok := s.series[r.Series]; offer == nil && !ok {
+		s.tombstone(r, reasonUnfilled, now)
+	}
+	return offer
+}
+
+// offered returns the record with the offer of the given token
+func (s *store) offered(token string) *record {
+	if len(token) == 0 {
+		return nil
+	}
+	for _, r := range s.records {
+		if r.Offer != nil && r.Offer.Token == token {
+			return r
+		}
+	}
+	return nil
+}
+
+// Offer returns the slot and the offer of the given token
+func (s *store) Offer(token string, now time.Time) (pitch.Pitch, pitch.Offer, bool) {
+	s.Lock()
+	defer s.Unlock()
+	r := s.offered(token)
+	if r == nil || !r.Offer.Deadline.After(now) {
+		return pitch.Pitch{}, pitch.Offer{}, false
+	}
+	return s.withVenue(r.Pitch), *r.Offer, true
+}
+
+// Respond accepts or declines the offer of the given token and returns the pitch,
+// an accepted pitch is approved, a declined slot is offered to the next speaker of the waitlist
+func (s *store) Respond(token string, accept bool, now time.Time) (pitch.Pitch, *pitch.Offer, error) {
+	s.Lock()
+	defer s.Unlock()
+	r := s.offered(token)
+	if r == nil || !r.Offer.Deadline.After(now) {
+		return pitch.Pitch{}, nil, errOfferNotFound
+	}
+	c := r.Offer.Candidate
+	r.Offer = nil
+	r.Modified = now
+	if accept {
+		r.Speaker, r.Title, r.Abstract, r.Contact = c.Speaker, c.Title, c.Abstract, c.Contact
+		r.Status = pitch.StatusApproved
+		// changes of the series keep the speaker
+		r.Source = sourceAPI
+		s.addHistory(r, now, pitch.HistoryAccepted, c.Speaker, c.Title, "")
+		s.changed()
+		return s.withVenue(r.Pitch), nil, nil
+	}
+	r.Status = ""
+	s.addHistory(r, now, pitch.HistoryDeclined, c.Speaker, c.Title, "")
+	offer := s.reoffer(r, now)
+	s.changed()
+	return s.withVenue(r.Pitch), offer, nil
+}
+
+// ExpireOffers withdraws the offers not accepted until the deadline and offers the slots to the next speakers,
+// fn is called for every new offer
+func (s *store) ExpireOffers(now time.Time, fn func(pitch.Pitch, *pitch.Offer)) {
+	s.Lock()
+	defer s.Unlock()
+	changed := false
+	for _, r := range s.records {
+		if r.Offer == nil || r.Offer.Deadline.After(now) {
+			continue
+		}
+		s.addHistory(r, now, pitch.HistoryExpired, r.Offer.Speaker, r.Offer.Title, "")
+		r.Offer = nil
+		r.Status = ""
+		r.Modified = now
+		if offer := s.reoffer(r, now); offer != nil {
+			fn(s.withVenue(r.Pitch), offer)
+		}
+		changed = true
+	}
+	if changed {
+		s.changed()
+	}
+}
+
+// RunWaitlist expires the offers every interval until ctx is done, fn is called for every new offer
+func (s *store) RunWaitlist(ctx context.Context, interval time.Duration, fn func(pitch.Pitch, *pitch.Offer)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			s.ExpireOffers(time.Now(), fn)
+		}
+	}
+}
+
+// Slot returns the history, the waitlist and the current offer of the pitch
+func (s *store) Slot(id string) (pitch.Slot, bool) {
+	s.Lock()
+	defer s.Unlock()
+	r, ok := s.records[id]
+	if !ok {
+		return pitch.Slot{}, false
+	}
+	slot := pitch.Slot{
+		History:  append([]pitch.HistoryEntry{}, r.History...),
+		Waitlist: append([]pitch.Candidate{}, r.Waitlist...),
+	}
+	if r.Offer != nil {
+		offer := *r.Offer
+		slot.Offer = &offer
+	}
+	return slot, true
+}
+
+// notifyOffer notifies the speaker of the waitlist about the offered slot, nothing is sent if offer is nil
+// the link to accept or decline is based on the public URL of the server
+func notifyOffer(logger *slog.Logger, n notify.Notifier, slot pitch.Pitch, offer *pitch.Offer, publicURL string) {
+	if offer == nil {
+		return
+	}
+	slot.Speaker, slot.Title, slot.Contact = offer.Speaker, offer.Title, offer.Contact
+	deliver(logger, n, notify.Notification{
+		Event:     notify.EventOffered,
+		Recipient: offer.Contact,
+		Pitch:     slot,
+		Deadline:  offer.Deadline,
+		Link:      strings.TrimSuffix(publicURL, "/") + "/offers/" + offer.Token,
+	})
+}
+
+// cancelPitch cancels a pitch, notifies the speaker and the organizers
+// and offers the slot to the next speaker of the waitlist
+func cancelPitch(s *store, n notify.Notifier, publicURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var d decision
+		if r.Body != nil && r.ContentLength != 0 {
+			defer r.Body.Close()
+			if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		p, offer, err := s.Cancel(chi.URLParam(r, "id"), d.Reason, time.Now())
+		switch {
+		case err == errPitchNotFound:
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if len(p.Contact) > 0 {
+			deliver(s.requestLogger(r), n, notify.Notification{Event: notify.EventCancelled, Recipient: p.Contact, Pitch: p, Reason: d.Reason})
+		}
+		deliver(s.requestLogger(r), n, notify.Notification{Event: notify.EventCancelled, Pitch: p, Reason: d.Reason})
+		notifyOffer(s.requestLogger(r), n, p, offer, publicURL)
+		p, _ = s.Pitch(p.ID)
+		render.JSON(w, r, p)
+	}
+}
+
+// getSlot returns the history, the waitlist and the current offer of a pitch
+func getSlot(s *store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		slot, ok := s.Slot(chi.URLParam(r, "id"))
+		if !ok {
+			http.Error(w, "pitch not found", http.StatusNotFound)
+			return
+		}
+		render.JSON(w, r, slot)
+	}
+}
+
+// offerTemplate renders an offer with the forms to accept or decline it and the answer
+var offerTemplate = template.Must(template.New("offer").Parse(`<!DOCTYPE html>
+<html lang="{{.Locale.Language}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Locale.T "offer.title"}}</title>
+</head>
+<body>
+<h1>{{.Locale.T "offer.title"}}</h1>
+{{if .Message}}
+<p>{{.Message}}</p>
+{{else}}
+<p>{{.Locale.T "offer.text" .Date .Deadline}}</p>
+<p><strong>{{.Speaker}}</strong>: {{.Title}}{{with .Venue}} - {{.}}{{end}}</p>
+<form method="post" action="{{.Token}}/accept"><button type="submit">{{.Locale.T "offer.accept"}}</button></form>
+<form method="post" action="{{.Token}}/decline"><button type="submit">{{.Locale.T "offer.decline"}}</button></form>
+{{end}}
+</body>
+</html>
+`))
+
+// offerPage renders the offer or msg if not empty
+func offerPage(w http.ResponseWriter, logger *slog.Logger, locale *i18n.Locale, status int, p pitch.Pitch, o pitch.Offer, msg string) {
+	l := locale.In(p.Location(locale.Location))
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	err := offerTemplate.Execute(w, map[string]interface{}{
+		"Locale":   locale,
+		"Message":  msg,
+		"Date":     l.Date(p.Date),
+		"Deadline": l.Date(o.Deadline),
+		"Speaker":  o.Speaker,
+		"Title":    o.Title,
+		"Venue":    p.VenueName,
+		"Token":    o.Token,
+	})
+	if err != nil {
+		logger.Error("rendering offer failed", "error", err)
+	}
+}
+
+// getOffer serves the offer of the token in the language of the browser or ?lang=
+func getOffer(s *store, language, timezone string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		locale, err := requestLocale(r, language, timezone)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p, o, ok := s.Offer(chi.URLParam(r, "token"), time.Now())
+		if !ok {
+			offerPage(w, s.requestLogger(r), locale, http.StatusNotFound, p, o, locale.T("offer.invalid"))
+			return
+		}
+		offerPage(w, s.requestLogger(r), locale, http.StatusOK, p, o, "")
+	}
+}
+
+// respondOffer accepts or declines the offer of the token
+// an accepted pitch is reported to the organizers, a declined slot is offered to the next speaker of the waitlist
+// a form is answered with an HTML page, other requests with the pitch as JSON
+func respondOffer(s *store, n notify.Notifier, accept bool, language, timezone, publicURL string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		form := strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded")
+		locale, err := requestLocale(r, language, timezone)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		p, offer, err := s.Respond(chi.URLParam(r, "token"), accept, time.Now())
+		if err != nil {
+			if form {
+				offerPage(w, s.requestLogger(r), locale, http.StatusNotFound, p, pitch.Offer{}, locale.T("offer.invalid"))
+				return
+			}
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		msg := locale.T("offer.declined")
+		if accept {
+			msg = locale.T("offer.accepted")
+			deliver(s.requestLogger(r), n, notify.Notification{Event: notify.EventReassigned, Pitch: p})
+		}
+		notifyOffer(s.requestLogger(r), n, p, offer, publicURL)
+		if form {
+			offerPage(w, s.requestLogger(r), locale, http.StatusOK, p, pitch.Offer{}, msg)
+			return
+		}
+		render.JSON(w, r, p)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+func TestCancelOneOff(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	addPitch(t, s, "42", "Marc", now.Add(time.Hour))
+	p, offer, err := s.Cancel("42", "ill", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offer != nil || p.Speaker != "Marc" {
+		t.Errorf("cancelled %+v, offer %+v", p, offer)
+	}
+	p, _ = s.Pitch("42")
+	if p.Status != pitch.StatusCancelled || p.Speaker != "Marc" {
+		t.Errorf("pitch %+v, want cancelled with speaker", p)
+	}
+	if next, _ := s.Next("", now); len(next.ID) > 0 {
+		t.Errorf("cancelled pitch is next: %+v", next)
+	}
+	if len(s.PublicPitches("")) > 0 || len(s.OpenSlots("", now)) > 0 {
+		t.Error("cancelled pitch shown as pitch or open slot")
+	}
+	if _, _, err := s.Cancel("42", "", now); err != errCancelled {
+		t.Errorf("cancelled again: %v", err)
+	}
+	if want := []string{pitch.HistoryCreated, pitch.HistoryCancelled}; !reflect.DeepEqual(events(s, "42"), want) {
+		t.Errorf("history %q, want %q", events(s, "42"), want)
+	}
+}
+
+func TestCancelWaitlist(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	addPitch(t, s, "42", "Marc", now.Add(time.Hour))
+	if _, waitlisted, err := s.SignUp(signUp{Slot: "42", Speaker: "Jane", Title: "Go", Contact: "jane@example.com"}, now); err != nil || !waitlisted {
+		t.Fatalf("sign-up: %v", err)
+	}
+	_, offer, err := s.Cancel("42", "ill", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if offer == nil || offer.Speaker != "Jane" {
+		t.Fatalf("offer %+v, want Jane", offer)
+	}
+	if p, _ := s.Pitch("42"); p.Status != pitch.StatusOffered {
+		t.Errorf("status %q, want offered", p.Status)
+	}
+	// nobody left on the waitlist
+	if _, offer, err = s.Respond(offer.Token, false, now); err != nil || offer != nil {
+		t.Fatalf("decline: offer %+v, %v", offer, err)
+	}
+	if p, _ := s.Pitch("42"); p.Status != pitch.StatusCancelled || !p.Open() {
+		t.Errorf("pitch %+v, want cancelled", p)
+	}
+}
+
+func TestWaitlistExhausted(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	addPitch(t, s, "42", "Marc", now.Add(48*time.Hour))
+	for _, speaker := range []string{"Jane", "John"} {
+		if _, waitlisted, err := s.SignUp(signUp{Slot: "42", Speaker: speaker, Title: "Go", Contact: speaker + "@example.com"}, now); err != nil || !waitlisted {
+			t.Fatalf("sign-up of %s: %v", speaker, err)
+		}
+	}
+	_, offer, err := s.Cancel("42", "ill", now)
+	if err != nil || offer == nil || offer.Speaker != "Jane" {
+		t.Fatalf("offer %+v, %v, want Jane", offer, err)
+	}
+	if _, offer, err = s.Respond(offer.Token, false, now); err != nil || offer == nil || offer.Speaker != "John" {
+		t.Fatalf("offer %+v, %v, want John", offer, err)
+	}
+	offers := 0
+	s.ExpireOffers(now.Add(25*time.Hour), func(pitch.Pitch, *pitch.Offer) { offers++ })
+	if offers > 0 {
+		t.Errorf("%d offers, want none", offers)
+	}
+	if p, _ := s.Pitch("42"); p.Status != pitch.StatusCancelled || !p.Open() {
+		t.Errorf("pitch %+v, want cancelled", p)
+	}
+	want := []string{pitch.HistoryCreated, pitch.HistoryWaitlisted, pitch.HistoryWaitlisted, pitch.HistoryCancelled,
+		pitch.HistoryOffered, pitch.HistoryDeclined, pitch.HistoryOffered, pitch.HistoryExpired, pitch.HistoryCancelled}
+	if !reflect.DeepEqual(events(s, "42"), want) {
+		t.Errorf("history %q, want %q", events(s, "42"), want)
+	}
+	slot, _ := s.Slot("42")
+	if h := slot.History[len(slot.History)-1]; h.Reason != reasonUnfilled {
+		t.Errorf("reason %q, want %q", h.Reason, reasonUnfilled)
+	}
+}
+
+func TestCancelSeries(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	addPitch(t, s, "weekly-1", "Marc", now.Add(time.Hour))
+	s.Lock()
+	s.series["weekly"] = &pitch.Series{ID: "weekly", Title: "Lightning talk"}
+	s.records["weekly-1"].Series = "weekly"
+	s.Unlock()
+	if _, offer, err := s.Cancel("weekly-1", "", now); err != nil || offer != nil {
+		t.Fatalf("offer %+v, %v", offer, err)
+	}
+	p, _ := s.Pitch("weekly-1")
+	if !p.Open() || len(p.Status) > 0 || p.Title != "Lightning talk" {
+		t.Errorf("pitch %+v, want open slot of the series", p)
+	}
+	if slots := s.OpenSlots("", now); len(slots) != 1 {
+		t.Errorf("%d open slots, want 1", len(slots))
+	}
+}
+
+func TestCancelStarted(t *testing.T) {
+	s := testStore(t)
+	now := time.Now()
+	addPitch(t, s, "42", "Marc", now.Add(-time.Minute))
+	if _, _, err := s.Cancel("42", "", now); err != errStarted {
+		t.Errorf("got %v, want %v", err, errStarted)
+	}
+	if _, _, err := s.Cancel("43", "", now); err != errPitchNotFound {
+		t.Errorf("got %v, want %v", err, errPitchNotFound)
+	}
+}
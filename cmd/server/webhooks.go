@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/marcsauter/buzzer/pkg/webhook"
+	"github.com/pressly/chi/render"
+)
+
+// webhookEvent returns the webhook event of an entry of the history of the pitch, false if there is none
+func webhookEvent(p pitch.Pitch, h pitch.HistoryEntry) (string, bool) {
+	scheduled := (p.Status == "" || p.Status == pitch.StatusApproved) && !p.Open()
+	switch h.Event {
+	case pitch.HistoryCreated:
+		return webhook.EventScheduled, scheduled
+	case pitch.HistoryApproved, pitch.HistoryAccepted:
+		return webhook.EventScheduled, true
+	case pitch.HistoryRescheduled:
+		return webhook.EventRescheduled, scheduled
+	case pitch.HistoryCancelled:
+		return webhook.EventCancelled, true
+	case pitch.HistoryReleased:
+		return webhook.EventReleased, true
+	case pitch.HistoryTimeUp:
+		return webhook.EventTimeUp, true
+	}
+	return "", false
+}
+
+// publishHistory returns the observer of the store (see store.Observe) publishing the lifecycle events of the pitches,
+// the contact of the speaker is left out
+func publishHistory(d *webhook.Dispatcher) func(pitch.Pitch, pitch.HistoryEntry) {
+	return func(p pitch.Pitch, h pitch.HistoryEntry) {
+		event, ok := webhookEvent(p, h)
+		if !ok {
+			return
+		}
+		p.Contact = ""
+		d.Publish(webhook.Event{Event: event, Time: h.Time, Pitch: p, Reason: h.Reason})
+	}
+}
+
+// Starting returns the scheduled pitches starting after now within lead ordered by date
+func (s *store) Starting(now time.Time, lead time.Duration) pitch.Pitches {
+	s.Lock()
+	defer s.Unlock()
+	pitches := pitch.Pitches{}
+	for _, r := range s.records {
+		if r.scheduled() && r.Date.After(now) && !r.Date.After(now.Add(lead)) {
+			p := s.withVenue(r.Pitch)
+			p.Contact = ""
+			pitches = append(pitches, p)
+		}
+	}
+	sort.Sort(pitches)
+	return pitches
+}
+
+// RunStarting publishes the starting event of the scheduled pitches lead before their date, checked every interval until ctx is done,
+// a rescheduled pitch is published again
+func (s *store) RunStarting(ctx context.Context, interval, lead time.Duration, d *webhook.Dispatcher) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	published := make(map[string]time.Time)
+	for {
+		now := time.Now()
+		for id, date := range published {
+			if date.Before(now) {
+				delete(published, id)
+			}
+		}
+		for _, p := range s.Starting(now, lead) {
+			if date, ok := published[p.ID]; ok && date.Equal(p.Date) {
+				continue
+			}
+			published[p.ID] = p.Date
+			d.Publish(webhook.Event{Event: webhook.EventStarting, Time: now, Pitch: p})
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// listWebhooks returns the webhooks without their secrets, URLs and header values are redacted (see webhook.Hook.Redacted)
+func listWebhooks(d *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hooks := []webhook.Hook{}
+		for _, h := range d.Hooks() {
+			hooks = append(hooks, h.Redacted())
+		}
+		render.JSON(w, r, hooks)
+	}
+}
+
+// listDeliveries returns the last delivery attempts (?limit=, default 100) of the webhooks filtered by ?hook= and ?event=
+func listDeliveries(d *webhook.Dispatcher) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		limit := 100
+		if v := q.Get("limit"); len(v) > 0 {
+			var err error
+			if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+				http.Error(w, "limit: "+strconv.Quote(v)+" is not a number", http.StatusBadRequest)
+				return
+			}
+		}
+		deliveries, err := d.Deliveries(q.Get("hook"), q.Get("event"), limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		render.JSON(w, r, deliveries)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// load loads the settings from the config file with content and the flags args
+func load(t *testing.T, content string, args ...string) (*settings, error) {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "ticker.yaml")
+	if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TICKER_CONFIG", name)
+	fs := flag.NewFlagSet("ticker", flag.ContinueOnError)
+	cfg, loader := newSettings(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cfg, loader.Load(cfg)
+}
+
+func TestSettings(t *testing.T) {
+	device := filepath.Join(t.TempDir(), "ttyUSB0")
+	if err := ioutil.WriteFile(device, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	valid := "device: " + device + "\npitch-url: http://buzzer.example.com/\n"
+	cfg, err := load(t, valid, "-locale", "de", "-lead", "10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Device != device || cfg.CheckInterval != 30 || cfg.Transport != "http" || cfg.Locale != "de" || cfg.Lead != 10*time.Minute {
+		t.Errorf("settings %+v, want the file, the flags and the defaults", cfg)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		args    []string
+		err     string
+	}{
+		{"device missing", "pitch-url: http://buzzer.example.com/\n", nil, "device"},
+		{"no such device", "device: /dev/nonexistent\npitch-url: http://buzzer.example.com/\n", nil, "device"},
+		{"unknown locale", valid, []string{"-locale", "it"}, "locale"},
+		{"unknown timezone", valid, []string{"-timezone", "Europe/Nowhere"}, "timezone"},
+		{"unknown transport", valid, []string{"-transport", "serial"}, "transport"},
+	}
+	for _, tt := range tests {
+		if _, err := load(t, tt.content, tt.args...); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want an error about %s", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	now := time.Now()
+	p := pitch.Pitch{ID: "42", Speaker: "Jane", Title: "Go", Date: now.Add(10 * time.Minute)}
+	tests := []struct {
+		name string
+		cfg  settings
+		want string
+	}{
+		{"english", settings{Lead: 30 * time.Minute, Locale: "en", Timezone: "Europe/Zurich"}, "Go by Jane"},
+		{"german", settings{Lead: 30 * time.Minute, Locale: "de", Timezone: "Europe/Zurich"}, "Go von Jane"},
+		{"template", settings{Lead: 30 * time.Minute, Locale: "en", Timezone: "Europe/Zurich", MessageUpcoming: "{{.Speaker}} in {{.Minutes}}"}, "Jane in 10"},
+		{"not yet shown", settings{Lead: 5 * time.Minute, Locale: "en", Timezone: "Europe/Zurich"}, ""},
+	}
+	for _, tt := range tests {
+		d, err := tt.cfg.display()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		text, err := d.Render(p, now)
+		if err != nil || !strings.Contains(text, tt.want) || (len(tt.want) == 0 && len(text) > 0) {
+			t.Errorf("%s: %q, %v, want %q", tt.name, text, err, tt.want)
+		}
+	}
+	if _, err := (&settings{Locale: "en", Timezone: "Europe/Zurich", MessageRunning: "{{.Speaker"}).display(); err == nil {
+		t.Error("template not valid: no error")
+	}
+}
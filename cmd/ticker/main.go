@@ -1,47 +1,147 @@
 package main
 
 import (
-	"log"
-	"net/url"
+	"context"
+	"flag"
+	"log/slog"
 	"os"
-	"os/signal"
-	"strconv"
-	"syscall"
+	"time"
 
+	"github.com/marcsauter/buzzer/pkg/client"
+	"github.com/marcsauter/buzzer/pkg/config"
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/health"
+	"github.com/marcsauter/buzzer/pkg/lifecycle"
+	"github.com/marcsauter/buzzer/pkg/logging"
+	"github.com/marcsauter/buzzer/pkg/metrics"
+	"github.com/marcsauter/buzzer/pkg/mqtt"
 	"github.com/marcsauter/buzzer/pkg/pitch"
 	"github.com/marcsauter/buzzer/pkg/ticker"
 )
 
 func main() {
-
-	device := os.Getenv("TICKER_DEVICE")
-	if _, err := os.Stat(device); os.IsNotExist(err) {
-		log.Fatal("TICKER_DEVICE missing or not valid")
+	cfg, loader := newSettings(flag.CommandLine)
+	flag.Parse()
+	if ok, err := loader.Command(flag.Args(), os.Stdout); ok {
+		lifecycle.Exit(logging.Default(), lifecycle.WithCode(lifecycle.ExitConfig, err))
 	}
-	url, err := url.Parse(os.Getenv("TICKER_PITCH_URL"))
-	if err != nil || !url.IsAbs() {
-		log.Fatal("TICKER_PITCH_URL missing or not valid")
+	if err := loader.Load(cfg); err != nil {
+		lifecycle.Exit(logging.Default(), lifecycle.WithCode(lifecycle.ExitConfig, err))
 	}
-	interval, err := strconv.Atoi(os.Getenv("TICKER_PITCH_CHECK_INTERVAL"))
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
 	if err != nil {
-		log.Fatal("TICKER_PITCH_CHECK_INTERVAL missing or not valid")
+		lifecycle.Exit(logging.Default(), lifecycle.WithCode(lifecycle.ExitConfig, err))
 	}
+	// the device name is attached to every entry
+	logger = logger.With("component", "ticker", "device", cfg.Name)
+	lifecycle.Exit(logger, run(cfg, loader, logger))
+}
 
-	t, err := ticker.NewTicker(device)
+// run sets up the ticker and runs it until a signal is received or a component fails
+func run(cfg *settings, loader *config.Loader, logger *slog.Logger) error {
+	interval := cfg.CheckInterval
+	name := cfg.Name
+	api, err := client.New(cfg.PitchURL, client.WithDevice(name), client.WithTimeout(time.Duration(interval)*time.Second))
+	if err != nil {
+		return lifecycle.WithCode(lifecycle.ExitConfig, err)
+	}
+	display, err := cfg.display()
 	if err != nil {
-		log.Fatal(err)
+		return lifecycle.WithCode(lifecycle.ExitConfig, err)
 	}
 
-	p := pitch.NewPitch(url)
-	p.StartCheckNext(interval, t)
+	t, err := ticker.NewTicker(cfg.Device, logger)
+	if err != nil {
+		return err
+	}
 
-	//
-	cancel := make(chan os.Signal, 1)
-	signal.Notify(cancel, syscall.SIGINT, syscall.SIGTERM, syscall.SIGKILL)
-	for {
-		select {
-		case <-cancel:
-			log.Fatalln("signal received - exiting")
+	// the next pitch and the heartbeats are received and sent through MQTT or the API, commands always use the API
+	var src pitch.Source = api
+	var m *mqtt.Device
+	if cfg.Transport == mqtt.Transport {
+		if m, err = mqtt.NewDevice(cfg.MQTT, cfg.MQTTTopic, name, cfg.Venue, logger); err != nil {
+			return lifecycle.WithCode(lifecycle.ExitConfig, err)
 		}
+		src = m
+	}
+	p := pitch.NewPoller(src, time.Duration(interval)*time.Second, cfg.Cache, logger)
+
+	d := pitch.NewDispatcher(display, logger)
+	d.Add("ticker", t)
+
+	lc := lifecycle.New(lifecycle.DefaultTimeout, logger)
+	lc.Go("ticker", t.Run)
+	lc.Go("pitch", func(ctx context.Context) error {
+		return p.Run(ctx, d)
+	})
+	if m != nil {
+		lc.Go("mqtt", func(ctx context.Context) error {
+			return m.Run(ctx, time.Duration(interval)*time.Second)
+		})
+	}
+	// health of the components, a failing serial port stops the keep-alives of the systemd watchdog
+	hc := health.New()
+	hc.Live("ticker", t.Check)
+	hc.Ready("pitch", p.Check)
+	lc.Go("systemd", func(ctx context.Context) error {
+		return hc.Systemd(ctx, logger)
+	})
+	// optional local health endpoints
+	if len(cfg.Health) > 0 {
+		lc.Go("health", func(ctx context.Context) error {
+			return health.Serve(ctx, cfg.Health, hc)
+		})
+	}
+	// optional local metrics endpoint
+	if len(cfg.Metrics) > 0 {
+		metrics.Poller(p)
+		lc.Go("metrics", func(ctx context.Context) error {
+			return metrics.Serve(ctx, cfg.Metrics)
+		})
 	}
+	// nothing to reload at runtime, changes are reported
+	lc.Go("config", func(ctx context.Context) error {
+		return loader.Watch(ctx, logger, func(interface{}, []string) {})
+	})
+	lc.Go("commands", func(ctx context.Context) error {
+		// the heartbeats register the device with the transport mqtt
+		if m == nil {
+			if err := device.Register(ctx, api, name, cfg.Venue); err != nil {
+				logger.Error("registering device failed", "error", err)
+			}
+		}
+		commands := time.NewTicker(time.Second * time.Duration(interval))
+		defer commands.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-commands.C:
+			}
+			id := logging.NewID()
+			cmds, err := api.Commands(logging.WithID(ctx, id), name)
+			if err != nil {
+				if ctx.Err() == nil {
+					logger.Error("polling commands failed", logging.Key, id, "error", err)
+				}
+				continue
+			}
+			for _, c := range cmds {
+				logger.Info("command received", logging.Key, id, "command", c.Name)
+				if c.Name == device.CommandOff {
+					if err := t.Stop(); err != nil {
+						logger.Error("stopping ticker failed", logging.Key, id, "error", err)
+					}
+				}
+			}
+		}
+	})
+	// clear the display and release the serial port on exit
+	lc.OnStop("ticker", func(ctx context.Context) error {
+		if err := t.Stop(); err != nil {
+			return err
+		}
+		return t.Close()
+	})
+	return lc.Run(context.Background())
 }
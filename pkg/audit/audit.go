@@ -0,0 +1,349 @@
+// Package audit implements an append-only audit log,
+// the entries are chained by their SHA-256 hashes so a modified, removed or inserted entry is detected
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Actions recorded besides the requests
+const (
+	// ActionLoginFailure credentials were given but not valid
+	ActionLoginFailure = "login.failure"
+)
+
+// Change is the value of a field before and after an action, null if the field did not exist
+type Change struct {
+	Before json.RawMessage `json:"before"`
+	After  json.RawMessage `json:"after"`
+}
+
+// Entry represents an entry of the audit log
+// Action is <kind>.<verb> e.g. pitch.put, Target <kind>/<id> e.g. pitch/42, Diff the changed fields of the target,
+// Prev is the hash of the previous entry and Hash the hash of the entry with an empty Hash (see Sum)
+type Entry struct {
+	Seq           uint64            `json:"seq"`
+	Time          time.Time         `json:"time"`
+	Actor         string            `json:"actor"`
+	IP            string            `json:"ip"`
+	Forwarded     string            `json:"forwarded,omitempty"`
+	Device        string            `json:"device,omitempty"`
+	CorrelationID string            `json:"correlation_id,omitempty"`
+	Action        string            `json:"action"`
+	Method        string            `json:"method,omitempty"`
+	Path          string            `json:"path,omitempty"`
+	Target        string            `json:"target,omitempty"`
+	Status        int               `json:"status"`
+	Detail        string            `json:"detail,omitempty"`
+	Diff          map[string]Change `json:"diff,omitempty"`
+	Prev          string            `json:"prev"`
+	Hash          string            `json:"hash"`
+}
+
+// Sum returns the hash of the entry: the hex encoded SHA-256 of its JSON encoding with an empty Hash
+func (e Entry) Sum() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Diff returns the top-level fields of the JSON objects before and after which differ, nil if nothing changed
+// a missing object (nil or null) is an object without fields
+func Diff(before, after json.RawMessage) (map[string]Change, error) {
+	fields := func(data json.RawMessage) (map[string]json.RawMessage, error) {
+		m := make(map[string]json.RawMessage)
+		if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+			return m, nil
+		}
+		return m, json.Unmarshal(data, &m)
+	}
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+	var diff map[string]Change
+	add := func(name string, c Change) {
+		if diff == nil {
+			diff = make(map[string]Change)
+		}
+		diff[name] = c
+	}
+	for name, v := range b {
+		if w, ok := a[name]; !ok || !bytes.Equal(v, w) {
+			add(name, Change{Before: v, After: a[name]})
+		}
+	}
+	for name, w := range a {
+		if _, ok := b[name]; !ok {
+			add(name, Change{After: w})
+		}
+	}
+	return diff, nil
+}
+
+// Filter selects entries, empty fields and zero times are not limited
+// Action matches the action or its kind e.g. pitch, Limit returns the last entries only (0: all)
+type Filter struct {
+	Actor  string
+	Action string
+	Target string
+	From   time.Time
+	To     time.Time
+	Limit  int
+}
+
+// match returns true if the entry is selected by the filter
+func (f Filter) match(e Entry) bool {
+	switch {
+	case len(f.Actor) > 0 && e.Actor != f.Actor:
+		return false
+	case len(f.Action) > 0 && e.Action != f.Action && !strings.HasPrefix(e.Action, f.Action+"."):
+		return false
+	case len(f.Target) > 0 && e.Target != f.Target:
+		return false
+	case !f.From.IsZero() && e.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !e.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// Verification is the result of the verification of the hash chain
+// Entries is the number of entries verified, Error the first break of the chain
+type Verification struct {
+	Valid   bool   `json:"valid"`
+	Entries int    `json:"entries"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Log is an audit log in a file with one JSON encoded entry per line
+type Log struct {
+	mutex sync.Mutex
+	path  string
+	seq   uint64
+	last  string
+	err   error
+}
+
+// Truncated is returned by Open if the last line was partial e.g. after a crash while writing,
+// the line is removed and the log is usable
+type Truncated struct {
+	Path string
+	Line int
+	Data string
+}
+
+func (t *Truncated) Error() string {
+	return fmt.Sprintf("%s: partial line %d removed: %q", t.Path, t.Line, t.Data)
+}
+
+// Open returns the audit log in the file path, the chain is continued after the last entry,
+// a partial last line is removed and returned as *Truncated, a broken chain is returned as error,
+// the log is usable in both cases, a line not valid before the last one fails
+func Open(path string) (*Log, error) {
+	l := &Log{path: path}
+	v, p, err := l.read(Filter{}, func(e Entry) {
+		l.seq, l.last = e.Seq, e.Hash
+	})
+	if err != nil {
+		return nil, err
+	}
+	var truncated error
+	switch {
+	case p == nil:
+	case p.entry:
+		// the entry is complete, only the line break is missing
+		if err := l.write([]byte("\n")); err != nil {
+			return nil, err
+		}
+	default:
+		if err := os.Truncate(path, p.offset); err != nil {
+			return nil, err
+		}
+		truncated = &Truncated{Path: path, Line: p.line, Data: string(p.data)}
+	}
+	switch {
+	case !v.Valid && truncated != nil:
+		return l, fmt.Errorf("%s: %s, %s", path, v.Error, truncated)
+	case !v.Valid:
+		return l, fmt.Errorf("%s: %s", path, v.Error)
+	}
+	return l, truncated
+}
+
+// Append sets sequence number, time (if not set) and the hashes of the entry and appends it to the log
+func (l *Log) Append(e Entry) (Entry, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	e.Seq, e.Prev = l.seq+1, l.last
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	var err error
+	if e.Hash, err = e.Sum(); err != nil {
+		return e, err
+	}
+	data, err := json.Marshal(e)
+	if err != nil {
+		return e, err
+	}
+	l.err = l.write(append(data, '\n'))
+	if l.err != nil {
+		return e, l.err
+	}
+	l.seq, l.last = e.Seq, e.Hash
+	return e, nil
+}
+
+// write appends the line to the file and syncs it
+func (l *Log) write(line []byte) error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(line); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Entries returns the entries selected by the filter ordered by sequence number
+func (l *Log) Entries(f Filter) ([]Entry, error) {
+	entries := []Entry{}
+	_, err := l.scan(f, func(e Entry) {
+		entries = append(entries, e)
+		if f.Limit > 0 && len(entries) > f.Limit {
+			entries = entries[1:]
+		}
+	})
+	return entries, err
+}
+
+// Verify verifies the hash chain of all entries
+func (l *Log) Verify() (Verification, error) {
+	return l.scan(Filter{}, func(Entry) {})
+}
+
+// scan reads the log, verifies the chain and calls fn for each entry selected by the filter
+func (l *Log) scan(f Filter, fn func(Entry)) (Verification, error) {
+	v, _, err := l.read(f, fn)
+	return v, err
+}
+
+// partial is the last line of the log if it is not terminated by a line break or not valid,
+// entry is true if the line is a complete entry without line break
+type partial struct {
+	offset int64
+	line   int
+	data   []byte
+	entry  bool
+}
+
+// read reads the log like scan and returns the partial last line, nil if the last line is complete,
+// a line not valid before the last one is returned as error
+func (l *Log) read(f Filter, fn func(Entry)) (Verification, *partial, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	v := Verification{Valid: true}
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return v, nil, nil
+	}
+	if err != nil {
+		return v, nil, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	prev := ""
+	var (
+		offset int64
+		p      *partial
+	)
+	for n := 1; ; n++ {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return v, nil, err
+		}
+		_, peek := r.Peek(1)
+		last := err == io.EOF || peek == io.EOF
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			if last {
+				return v, &partial{offset: offset, line: n, data: bytes.TrimSpace(line)}, nil
+			}
+			return v, nil, fmt.Errorf("line %d: %s", n, err)
+		}
+		if err == io.EOF {
+			p = &partial{offset: offset, line: n, data: line, entry: true}
+		}
+		offset += int64(len(line))
+		if v.Valid {
+			if msg := check(e, prev, uint64(v.Entries+1)); len(msg) > 0 {
+				v.Valid, v.Error = false, fmt.Sprintf("line %d: %s", n, msg)
+			} else {
+				v.Entries++
+			}
+		}
+		prev = e.Hash
+		if f.match(e) {
+			fn(e)
+		}
+	}
+	return v, p, nil
+}
+
+// check returns why the entry does not continue the chain after the hash prev, empty if it does
+func check(e Entry, prev string, seq uint64) string {
+	if e.Seq != seq {
+		return fmt.Sprintf("sequence number %d, expected %d", e.Seq, seq)
+	}
+	if e.Prev != prev {
+		return fmt.Sprintf("entry %d does not follow the previous entry", e.Seq)
+	}
+	sum, err := e.Sum()
+	if err != nil {
+		return err.Error()
+	}
+	if sum != e.Hash {
+		return fmt.Sprintf("entry %d was modified", e.Seq)
+	}
+	return ""
+}
+
+// Check returns the error of the last write
+func (l *Log) Check() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.err != nil {
+		return fmt.Errorf("%s: %w", l.path, l.err)
+	}
+	return nil
+}
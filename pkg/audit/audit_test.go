@@ -0,0 +1,253 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testLog returns a log with n entries in a temporary directory
+func testLog(t *testing.T, n int) (*Log, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "buzzer.audit")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		e := Entry{Actor: "marc", Action: "pitch.put", Target: "pitch/" + string(rune('a'+i)), Status: 200}
+		if _, err := l.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return l, path
+}
+
+// lines returns the lines of the file
+func lines(t *testing.T, path string) []string {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.SplitAfter(string(data), "\n")
+}
+
+// rewrite replaces the content of the file
+func rewrite(t *testing.T, path string, lines []string) {
+	t.Helper()
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "")), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestChain(t *testing.T) {
+	l, path := testLog(t, 3)
+	v, err := l.Verify()
+	if err != nil || !v.Valid || v.Entries != 3 {
+		t.Fatalf("verification %+v, %v", v, err)
+	}
+	// the chain is continued after reopening
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := l.Append(Entry{Actor: "marc", Action: ActionLoginFailure, Status: 401})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Seq != 4 || len(e.Prev) == 0 || e.Time.Location() != time.UTC {
+		t.Errorf("entry %+v does not continue the chain", e)
+	}
+	if v, _ := l.Verify(); !v.Valid || v.Entries != 4 {
+		t.Errorf("verification %+v", v)
+	}
+}
+
+func TestTamper(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func([]string) []string
+		want   string
+	}{
+		{
+			name: "modified",
+			tamper: func(l []string) []string {
+				l[1] = strings.Replace(l[1], `"actor":"marc"`, `"actor":"jane"`, 1)
+				return l
+			},
+			want: "line 2: entry 2 was modified",
+		},
+		{
+			name: "removed",
+			tamper: func(l []string) []string {
+				return append(l[:1], l[2:]...)
+			},
+			want: "line 2: sequence number 3, expected 2",
+		},
+		{
+			name: "inserted",
+			tamper: func(l []string) []string {
+				return append(l[:2], append([]string{l[1]}, l[2:]...)...)
+			},
+			want: "line 3: sequence number 2, expected 3",
+		},
+		{
+			name: "renumbered",
+			tamper: func(l []string) []string {
+				var e Entry
+				json.Unmarshal([]byte(l[2]), &e)
+				e.Seq, e.Prev = 2, ""
+				e.Hash, _ = e.Sum()
+				data, _ := json.Marshal(e)
+				return append(l[:1], string(data)+"\n")
+			},
+			want: "line 2: entry 2 does not follow the previous entry",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, path := testLog(t, 3)
+			rewrite(t, path, tt.tamper(lines(t, path)))
+			v, err := l.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Valid || v.Error != tt.want {
+				t.Errorf("verification %+v, want %q", v, tt.want)
+			}
+			// the log is usable with a broken chain
+			if l, err := Open(path); l == nil || err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("open: %v", err)
+			}
+		})
+	}
+}
+
+func TestOpenTruncated(t *testing.T) {
+	_, path := testLog(t, 3)
+	l := lines(t, path)
+	complete := strings.Join(l[:2], "")
+	rewrite(t, path, append(l[:2], l[2][:len(l[2])/2]))
+
+	log, err := Open(path)
+	var truncated *Truncated
+	if !errors.As(err, &truncated) || truncated.Line != 3 {
+		t.Fatalf("open: %v, want partial line 3", err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != complete {
+		t.Errorf("partial line not removed:\n%s", data)
+	}
+	e, err := log.Append(Entry{Actor: "marc", Action: "pitch.put", Status: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Seq != 3 {
+		t.Errorf("sequence number %d, want 3", e.Seq)
+	}
+	if v, _ := log.Verify(); !v.Valid || v.Entries != 3 {
+		t.Errorf("verification %+v", v)
+	}
+}
+
+func TestOpenLineBreakMissing(t *testing.T) {
+	_, path := testLog(t, 2)
+	l := lines(t, path)
+	rewrite(t, path, append(l[:1], strings.TrimSuffix(l[1], "\n")))
+	log, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.Append(Entry{Actor: "marc", Action: "pitch.put", Status: 200}); err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := log.Verify(); !v.Valid || v.Entries != 3 {
+		t.Errorf("verification %+v", v)
+	}
+}
+
+func TestOpenCorrupt(t *testing.T) {
+	_, path := testLog(t, 3)
+	l := lines(t, path)
+	l[1] = l[1][:10] + "\n"
+	rewrite(t, path, l)
+	if log, err := Open(path); log != nil || err == nil || !strings.HasPrefix(err.Error(), "line 2:") {
+		t.Errorf("open: %v, want line 2 not valid", err)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	l, _ := testLog(t, 5)
+	if _, err := l.Append(Entry{Actor: "jane", Action: "venue.delete", Target: "venue/pflab", Status: 200}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"all", Filter{}, 6},
+		{"actor", Filter{Actor: "jane"}, 1},
+		{"kind", Filter{Action: "pitch"}, 5},
+		{"action", Filter{Action: "pitch.put"}, 5},
+		{"prefix only", Filter{Action: "pit"}, 0},
+		{"target", Filter{Target: "pitch/b"}, 1},
+		{"limit", Filter{Limit: 2}, 2},
+		{"future", Filter{From: time.Now().Add(time.Hour)}, 0},
+	}
+	for _, tt := range tests {
+		entries, err := l.Entries(tt.filter)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != tt.want {
+			t.Errorf("%s: %d entries, want %d", tt.name, len(entries), tt.want)
+		}
+	}
+	if entries, _ := l.Entries(Filter{Limit: 2}); entries[1].Seq != 6 {
+		t.Errorf("limit returns %+v, want the last entries", entries)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	diff, err := Diff(json.RawMessage(`{"id":"42","title":"Go","speaker":"Marc"}`), json.RawMessage(`{"id":"42","title":"Rust","venue":"pflab"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Change{
+		"title":   {Before: json.RawMessage(`"Go"`), After: json.RawMessage(`"Rust"`)},
+		"speaker": {Before: json.RawMessage(`"Marc"`)},
+		"venue":   {After: json.RawMessage(`"pflab"`)},
+	}
+	if len(diff) != len(want) {
+		t.Errorf("diff %v, want %v", diff, want)
+	}
+	for name, c := range want {
+		if !bytes.Equal(diff[name].Before, c.Before) || !bytes.Equal(diff[name].After, c.After) {
+			t.Errorf("%s: %s -> %s, want %s -> %s", name, diff[name].Before, diff[name].After, c.Before, c.After)
+		}
+	}
+	if diff, err := Diff(nil, json.RawMessage("null")); err != nil || diff != nil {
+		t.Errorf("diff %v, %v of nothing", diff, err)
+	}
+}
+
+func TestOpenMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "buzzer.audit")
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("log created before the first entry: %v", err)
+	}
+	if v, err := l.Verify(); err != nil || !v.Valid || v.Entries != 0 {
+		t.Errorf("verification %+v, %v", v, err)
+	}
+}
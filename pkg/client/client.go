@@ -0,0 +1,507 @@
+package client
+
+// package implements a client for the API of cmd/server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/audit"
+	"github.com/marcsauter/buzzer/pkg/device"
+	"github.com/marcsauter/buzzer/pkg/logging"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// Defaults
+const (
+	DefaultTimeout = 30 * time.Second
+	DefaultRetries = 3
+	DefaultBackoff = 500 * time.Millisecond
+	maxBackoff     = 30 * time.Second
+)
+
+// errNotModified is returned by send for 304 Not Modified
+var errNotModified = errors.New("not modified")
+
+// Error is returned if the server responds with a status other than 2xx
+type Error struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	if len(e.Message) == 0 {
+		return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+	}
+	return fmt.Sprintf("%s %s: %s: %s", e.Method, e.URL, e.Status, e.Message)
+}
+
+// StatusCode returns the status code of an *Error or 0 for all other errors
+func StatusCode(err error) int {
+	if e, ok := err.(*Error); ok {
+		return e.StatusCode
+	}
+	return 0
+}
+
+// IsNotFound returns true if the requested resource does not exist
+func IsNotFound(err error) bool {
+	return StatusCode(err) == http.StatusNotFound
+}
+
+// IsUnauthorized returns true if the credentials are missing or not valid
+func IsUnauthorized(err error) bool {
+	return StatusCode(err) == http.StatusUnauthorized
+}
+
+// Client represents a client of the server API
+type Client struct {
+	baseURL  *url.URL
+	username string
+	password string
+	device   string
+	retries  int
+	backoff  time.Duration
+	http     *http.Client
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithCredentials sets the credentials for basic authentication
+func WithCredentials(username, password string) Option {
+	return func(c *Client) {
+		if len(username) > 0 {
+			c.username, c.password = username, password
+		}
+	}
+}
+
+// WithDevice identifies the client as the device name, the server answers with the pitches of its venue
+func WithDevice(name string) Option {
+	return func(c *Client) {
+		c.device = name
+	}
+}
+
+// WithTimeout sets the timeout of a single request
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) {
+		c.http.Timeout = d
+	}
+}
+
+// WithRetries sets the number of retries and the initial backoff, the backoff doubles with every retry
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries, c.backoff = retries, backoff
+	}
+}
+
+// WithHTTPClient sets the underlying http.Client
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// credentials is the request body to set users and PINs
+type credentials struct {
+	Name   string `json:"name"`
+	Secret string `json:"secret,omitempty"`
+}
+
+// New returns a new Client for the server at baseURL
+// the credentials can also be part of the URL
+func New(baseURL string, options ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil || !u.IsAbs() {
+		return nil, fmt.Errorf("server URL %q missing or not valid", baseURL)
+	}
+	c := &Client{
+		retries: DefaultRetries,
+		backoff: DefaultBackoff,
+		http:    &http.Client{Timeout: DefaultTimeout},
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+		u.User = nil
+	}
+	// keep the base path
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+	}
+	c.baseURL = u
+	for _, o := range options {
+		o(c)
+	}
+	return c, nil
+}
+
+// URL returns the absolute URL for path relative to the base URL, path may contain a query
+// the segments of path are already escaped (see url.PathEscape) and are not escaped again
+func (c *Client) URL(path string) *url.URL {
+	path = strings.TrimPrefix(path, "/")
+	ref := &url.URL{}
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, ref.RawQuery = path[:i], path[i+1:]
+	}
+	p, err := url.PathUnescape(path)
+	if err != nil {
+		p = path
+	}
+	ref.Path, ref.RawPath = p, path
+	return c.baseURL.ResolveReference(ref)
+}
+
+// venueQuery returns path with the venue as query if not empty
+func venueQuery(path, venue string) string {
+	if len(venue) == 0 {
+		return path
+	}
+	return path + "?" + url.Values{"venue": {venue}}.Encode()
+}
+
+// retryable returns true if a failed request may be sent again
+func retryable(method string, status int) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE":
+	default:
+		return false
+	}
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// do sends a request to the server and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	_, err := c.doHeader(ctx, method, path, nil, in, out)
+	return err
+}
+
+// doHeader sends a request with additional header and returns the response header
+// idempotent requests are retried with exponential backoff on network and server errors,
+// the correlation id of ctx (or a new one) is sent with every attempt
+func (c *Client) doHeader(ctx context.Context, method, path string, header http.Header, in, out interface{}) (http.Header, error) {
+	if len(logging.ID(ctx)) == 0 {
+		ctx = logging.WithID(ctx, logging.NewID())
+	}
+	var body []byte
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = data
+	}
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		h, err := c.send(ctx, method, path, header, body, out)
+		if err == nil || err == errNotModified || attempt >= c.retries || !retryable(method, StatusCode(err)) || ctx.Err() != nil {
+			return h, err
+		}
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// send sends a single request
+func (c *Client) send(ctx context.Context, method, path string, header http.Header, body []byte, out interface{}) (http.Header, error) {
+	u := c.URL(path)
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), r)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if len(c.username) > 0 {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	if len(c.device) > 0 {
+		req.Header.Set(device.Header, c.device)
+	}
+	req.Header.Set(logging.Header, logging.ID(ctx))
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return resp.Header, errNotModified
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return resp.Header, &Error{
+			Method:     method,
+			URL:        u.String(),
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Message:    strings.TrimSpace(string(msg)),
+		}
+	}
+	switch o := out.(type) {
+	case nil:
+		io.Copy(ioutil.Discard, resp.Body)
+		return resp.Header, nil
+	case *[]byte:
+		// raw response e.g. CSV
+		*o, err = ioutil.ReadAll(resp.Body)
+		return resp.Header, err
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// Next returns the next pitch in venue, empty for the venue of the device or all venues
+func (c *Client) Next(ctx context.Context, venue string) (pitch.Pitch, error) {
+	p := pitch.Pitch{}
+	err := c.do(ctx, "GET", venueQuery("next", venue), nil, &p)
+	return p, err
+}
+
+// NextIfModified returns the next pitch if it changed since version v
+// modified is false if the server answered with 304 Not Modified
+func (c *Client) NextIfModified(ctx context.Context, v pitch.Version) (next pitch.Pitch, version pitch.Version, modified bool, err error) {
+	header := http.Header{}
+	if len(v.ETag) > 0 {
+		header.Set("If-None-Match", v.ETag)
+	}
+	if len(v.LastModified) > 0 {
+		header.Set("If-Modified-Since", v.LastModified)
+	}
+	h, err := c.doHeader(ctx, "GET", "next", header, nil, &next)
+	if err == errNotModified {
+		return next, v, false, nil
+	}
+	if err != nil {
+		return next, v, false, err
+	}
+	version = pitch.Version{
+		ETag:         h.Get("ETag"),
+		LastModified: h.Get("Last-Modified"),
+	}
+	return next, version, true, nil
+}
+
+// Pitches returns all pitches in venue, empty for all venues
+func (c *Client) Pitches(ctx context.Context, venue string) (pitch.Pitches, error) {
+	pitches := pitch.Pitches{}
+	err := c.do(ctx, "GET", venueQuery("pitches", venue), nil, &pitches)
+	return pitches, err
+}
+
+// Pitch returns the pitch with the given id
+func (c *Client) Pitch(ctx context.Context, id string) (pitch.Pitch, error) {
+	p := pitch.Pitch{}
+	err := c.do(ctx, "GET", "pitches/"+url.PathEscape(id), nil, &p)
+	return p, err
+}
+
+// CreatePitch adds a new pitch, it fails if the id already exists
+func (c *Client) CreatePitch(ctx context.Context, p pitch.Pitch) error {
+	return c.do(ctx, "POST", "pitches", p, nil)
+}
+
+// PutPitch adds or updates a pitch
+func (c *Client) PutPitch(ctx context.Context, p pitch.Pitch) error {
+	return c.do(ctx, "PUT", "pitches/"+url.PathEscape(p.ID), p, nil)
+}
+
+// DeletePitch removes a pitch
+func (c *Client) DeletePitch(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", "pitches/"+url.PathEscape(id), nil, nil)
+}
+
+// Slots returns the open slots in venue, empty for all venues
+func (c *Client) Slots(ctx context.Context, venue string) (pitch.Pitches, error) {
+	slots := pitch.Pitches{}
+	err := c.do(ctx, "GET", venueQuery("slots", venue), nil, &slots)
+	return slots, err
+}
+
+// ApprovePitch approves a pending pitch
+func (c *Client) ApprovePitch(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", "pitches/"+url.PathEscape(id)+"/approve", nil, nil)
+}
+
+// RejectPitch rejects a pending pitch, the reason is sent to the speaker
+func (c *Client) RejectPitch(ctx context.Context, id, reason string) error {
+	return c.do(ctx, "POST", "pitches/"+url.PathEscape(id)+"/reject", struct {
+		Reason string `json:"reason,omitempty"`
+	}{reason}, nil)
+}
+
+// CancelPitch cancels a pitch, the slot is offered to the next speaker of the waitlist
+func (c *Client) CancelPitch(ctx context.Context, id, reason string) (pitch.Pitch, error) {
+	p := pitch.Pitch{}
+	err := c.do(ctx, "POST", "pitches/"+url.PathEscape(id)+"/cancel", struct {
+		Reason string `json:"reason,omitempty"`
+	}{reason}, &p)
+	return p, err
+}
+
+// PitchSlot returns the history, the waitlist and the current offer of a pitch
+func (c *Client) PitchSlot(ctx context.Context, id string) (pitch.Slot, error) {
+	slot := pitch.Slot{}
+	err := c.do(ctx, "GET", "pitches/"+url.PathEscape(id)+"/slot", nil, &slot)
+	return slot, err
+}
+
+// Venues returns all venues
+func (c *Client) Venues(ctx context.Context) ([]pitch.Venue, error) {
+	venues := []pitch.Venue{}
+	err := c.do(ctx, "GET", "venues", nil, &venues)
+	return venues, err
+}
+
+// PutVenue adds or updates a venue
+func (c *Client) PutVenue(ctx context.Context, v pitch.Venue) error {
+	return c.do(ctx, "PUT", "venues/"+url.PathEscape(v.ID), v, nil)
+}
+
+// DeleteVenue removes a venue
+func (c *Client) DeleteVenue(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", "venues/"+url.PathEscape(id), nil, nil)
+}
+
+// Series returns all series
+func (c *Client) Series(ctx context.Context) ([]pitch.Series, error) {
+	series := []pitch.Series{}
+	err := c.do(ctx, "GET", "series", nil, &series)
+	return series, err
+}
+
+// PutSeries adds or updates a series
+func (c *Client) PutSeries(ctx context.Context, s pitch.Series) error {
+	return c.do(ctx, "PUT", "series/"+url.PathEscape(s.ID), s, nil)
+}
+
+// DeleteSeries removes a series
+func (c *Client) DeleteSeries(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", "series/"+url.PathEscape(id), nil, nil)
+}
+
+// Devices returns all registered devices or the devices bound to venue
+func (c *Client) Devices(ctx context.Context, venue string) ([]device.Device, error) {
+	devices := []device.Device{}
+	err := c.do(ctx, "GET", venueQuery("devices", venue), nil, &devices)
+	return devices, err
+}
+
+// RegisterDevice registers a device
+func (c *Client) RegisterDevice(ctx context.Context, d device.Device) error {
+	return c.do(ctx, "POST", "devices", d, nil)
+}
+
+// SendCommand queues a command for a device
+func (c *Client) SendCommand(ctx context.Context, name, command string) error {
+	return c.do(ctx, "POST", "devices/"+url.PathEscape(name)+"/commands", device.Command{Name: command}, nil)
+}
+
+// Commands returns the commands queued for a device
+func (c *Client) Commands(ctx context.Context, name string) ([]device.Command, error) {
+	commands := []device.Command{}
+	err := c.do(ctx, "GET", "devices/"+url.PathEscape(name)+"/commands", nil, &commands)
+	return commands, err
+}
+
+// ReportEvent reports an event of a device e.g. a release and returns the pitch it was assigned to
+func (c *Client) ReportEvent(ctx context.Context, name string, e device.Event) (pitch.Pitch, error) {
+	p := pitch.Pitch{}
+	err := c.do(ctx, "POST", "devices/"+url.PathEscape(name)+"/events", e, &p)
+	return p, err
+}
+
+// Report returns the report name (months, delays, speakers, noshows or events) as CSV,
+// query limits it e.g. to a venue and a period (see the server)
+func (c *Client) Report(ctx context.Context, name string, query url.Values) ([]byte, error) {
+	q := url.Values{"format": {"csv"}}
+	for k, v := range query {
+		q[k] = v
+	}
+	var csv []byte
+	err := c.do(ctx, "GET", "reports/"+url.PathEscape(name)+"?"+q.Encode(), nil, &csv)
+	return csv, err
+}
+
+// Audit returns the entries of the audit log selected by query e.g. actor, action, target, from, to and limit (see the server)
+func (c *Client) Audit(ctx context.Context, query url.Values) ([]audit.Entry, error) {
+	entries := []audit.Entry{}
+	err := c.do(ctx, "GET", "audit?"+query.Encode(), nil, &entries)
+	return entries, err
+}
+
+// VerifyAudit verifies the hash chain of the audit log
+func (c *Client) VerifyAudit(ctx context.Context) (audit.Verification, error) {
+	v := audit.Verification{}
+	err := c.do(ctx, "GET", "audit/verify", nil, &v)
+	return v, err
+}
+
+// Users returns the names of all users
+func (c *Client) Users(ctx context.Context) ([]string, error) {
+	users := []string{}
+	err := c.do(ctx, "GET", "users", nil, &users)
+	return users, err
+}
+
+// SetUser adds a user or changes the password of an existing user
+func (c *Client) SetUser(ctx context.Context, username, password string) error {
+	return c.do(ctx, "PUT", "users/"+url.PathEscape(username), credentials{Secret: password}, nil)
+}
+
+// DeleteUser removes a user
+func (c *Client) DeleteUser(ctx context.Context, username string) error {
+	return c.do(ctx, "DELETE", "users/"+url.PathEscape(username), nil, nil)
+}
+
+// PINs returns the names of all PINs
+func (c *Client) PINs(ctx context.Context) ([]string, error) {
+	pins := []string{}
+	err := c.do(ctx, "GET", "pins", nil, &pins)
+	return pins, err
+}
+
+// SetPIN adds or changes a PIN
+func (c *Client) SetPIN(ctx context.Context, name, pin string) error {
+	return c.do(ctx, "PUT", "pins/"+url.PathEscape(name), credentials{Secret: pin}, nil)
+}
+
+// DeletePIN removes a PIN
+func (c *Client) DeletePIN(ctx context.Context, name string) error {
+	return c.do(ctx, "DELETE", "pins/"+url.PathEscape(name), nil, nil)
+}
+
+// VerifyPIN returns the name of the PIN if it is valid
+func (c *Client) VerifyPIN(ctx context.Context, pin string) (string, error) {
+	res := credentials{}
+	err := c.do(ctx, "POST", "pins/verify", credentials{Secret: pin}, &res)
+	return res.Name, err
+}
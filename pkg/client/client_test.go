@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestEscaping(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RequestURI
+		w.Write([]byte("null"))
+	}))
+	defer srv.Close()
+	c, err := New(srv.URL+"/api", WithRetries(0, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		call func() error
+		want string
+	}{
+		{"space", func() error { _, err := c.Pitch(ctx, "a b"); return err }, "/api/pitches/a%20b"},
+		{"slash", func() error { _, err := c.Pitch(ctx, "x/y"); return err }, "/api/pitches/x%2Fy"},
+		{"non-ascii", func() error { _, err := c.Pitch(ctx, "ü"); return err }, "/api/pitches/%C3%BC"},
+		{"percent", func() error { _, err := c.Pitch(ctx, "100%"); return err }, "/api/pitches/100%25"},
+		{"action", func() error { return c.ApprovePitch(ctx, "a b/ü") }, "/api/pitches/a%20b%2F%C3%BC/approve"},
+		{"user", func() error { return c.DeleteUser(ctx, "jane doe") }, "/api/users/jane%20doe"},
+		{"query", func() error { _, err := c.Pitches(ctx, "a b"); return err }, "/api/pitches?venue=a+b"},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: request URI %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestURL(t *testing.T) {
+	c, err := New("https://buzzer.example.com/api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, want := range map[string]string{
+		"pitches":                 "https://buzzer.example.com/api/pitches",
+		"/pitches/a%2Fb":          "https://buzzer.example.com/api/pitches/a%2Fb",
+		"reports/x%20y?from=2017": "https://buzzer.example.com/api/reports/x%20y?from=2017",
+	} {
+		if got := c.URL(path).String(); got != want {
+			t.Errorf("URL(%q) = %s, want %s", path, got, want)
+		}
+	}
+}
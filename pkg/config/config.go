@@ -0,0 +1,445 @@
+package config
+
+// package loads the configuration of a daemon from defaults, a config file,
+// the environment and flags - every layer overrides the previous one
+//
+// the fields of the configuration struct are described by tags:
+//
+//	yaml     key in the config file and name of the flag
+//	env      name of the environment variable
+//	usage    description of the flag
+//	required the value must not be empty
+//	requiredwith the value must not be empty if the field with this key is set
+//	validate comma separated rules: url, file, digits, port, timezone, min=N, oneof=a|b
+//	secret   the value is masked by Print
+//	reload   the value may change at runtime (see Watch)
+//
+// the values of the struct passed to New are the defaults
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// FieldError reports a value that is missing or not valid
+type FieldError struct {
+	Key    string
+	Source string
+	Err    error
+}
+
+func (e *FieldError) Error() string {
+	if len(e.Source) == 0 {
+		return fmt.Sprintf("%s: %s", e.Key, e.Err)
+	}
+	return fmt.Sprintf("%s (%s): %s", e.Key, e.Source, e.Err)
+}
+
+// Errors collects all errors found in a configuration
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "configuration not valid:\n  " + strings.Join(msgs, "\n  ")
+}
+
+// field describes a field of the configuration struct
+type field struct {
+	index    int
+	key      string
+	env      string
+	usage    string
+	required bool
+	with     string
+	validate []string
+	secret   bool
+	reload   bool
+}
+
+// Loader loads a configuration struct
+type Loader struct {
+	typ         reflect.Type
+	defaults    reflect.Value
+	fields      []field
+	env         string
+	file        string
+	defaultFile string
+	flags       map[string]string
+	sources     map[string]string
+	current     reflect.Value
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// New returns a new Loader for cfg, a pointer to a struct, and registers its flags and -config on fs
+// the config file is taken from -config, the environment variable env or file
+func New(fs *flag.FlagSet, cfg interface{}, env, file string) *Loader {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		panic("config: cfg must be a pointer to a struct")
+	}
+	l := &Loader{
+		typ:         v.Elem().Type(),
+		defaults:    reflect.New(v.Elem().Type()).Elem(),
+		env:         env,
+		defaultFile: file,
+		flags:       make(map[string]string),
+		sources:     make(map[string]string),
+	}
+	l.defaults.Set(v.Elem())
+	for i := 0; i < l.typ.NumField(); i++ {
+		sf := l.typ.Field(i)
+		key := sf.Tag.Get("yaml")
+		if len(key) == 0 || key == "-" {
+			continue
+		}
+		f := field{
+			index:    i,
+			key:      key,
+			env:      sf.Tag.Get("env"),
+			usage:    sf.Tag.Get("usage"),
+			required: sf.Tag.Get("required") == "true",
+			with:     sf.Tag.Get("requiredwith"),
+			secret:   sf.Tag.Get("secret") == "true",
+			reload:   sf.Tag.Get("reload") == "true",
+		}
+		if rules := sf.Tag.Get("validate"); len(rules) > 0 {
+			f.validate = strings.Split(rules, ",")
+		}
+		l.fields = append(l.fields, f)
+		usage := f.usage
+		if len(f.env) > 0 {
+			usage = fmt.Sprintf("%s (env %s)", usage, f.env)
+		}
+		if def := l.defaults.Field(i); !def.IsZero() && !f.secret {
+			usage = fmt.Sprintf("%s (default %v)", usage, def.Interface())
+		}
+		fs.Func(f.key, usage, func(s string) error {
+			l.flags[f.key] = s
+			return nil
+		})
+	}
+	fs.StringVar(&l.file, "config", "", fmt.Sprintf("config file (env %s, default %s)", env, file))
+	return l
+}
+
+// File returns the name of the config file and whether it has to exist
+func (l *Loader) File() (string, bool) {
+	if len(l.file) > 0 {
+		return l.file, true
+	}
+	if name := os.Getenv(l.env); len(name) > 0 {
+		return name, true
+	}
+	return l.defaultFile, false
+}
+
+// readFile returns the values of the config file
+func (l *Loader) readFile() (map[string]string, string, error) {
+	name, required := l.File()
+	values := make(map[string]string)
+	if len(name) == 0 {
+		return values, "", nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if os.IsNotExist(err) && !required {
+		return values, "", nil
+	}
+	if err != nil {
+		return nil, name, err
+	}
+	raw := make(map[string]interface{})
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, name, fmt.Errorf("%s: %s", name, err)
+	}
+	for key, value := range raw {
+		if value != nil {
+			values[key] = fmt.Sprint(value)
+		}
+	}
+	return values, name, nil
+}
+
+// Load fills cfg, a pointer to a struct of the type passed to New, with the defaults
+// and the values of the config file, the environment and the flags and validates the result
+// all errors found are returned as Errors
+func (l *Loader) Load(cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Type() != l.typ {
+		return fmt.Errorf("config: cfg must be a *%s", l.typ.Name())
+	}
+	file, name, err := l.readFile()
+	if err != nil {
+		return err
+	}
+	v = v.Elem()
+	v.Set(l.defaults)
+	errs := Errors{}
+	known := make(map[string]bool)
+	sources := make(map[string]string)
+	for _, f := range l.fields {
+		known[f.key] = true
+		sources[f.key] = "default"
+		layers := []struct {
+			source string
+			value  string
+			ok     bool
+		}{
+			{"file " + name, file[f.key], hasKey(file, f.key)},
+			{"env " + f.env, os.Getenv(f.env), len(f.env) > 0 && len(os.Getenv(f.env)) > 0},
+			{"flag -" + f.key, l.flags[f.key], hasKey(l.flags, f.key)},
+		}
+		for _, layer := range layers {
+			if !layer.ok {
+				continue
+			}
+			sources[f.key] = layer.source
+			if err := set(v.Field(f.index), layer.value); err != nil {
+				errs = append(errs, &FieldError{Key: f.key, Source: layer.source, Err: err})
+			}
+		}
+		if err := f.check(v.Field(f.index)); err != nil {
+			if sources[f.key] == "default" {
+				errs = append(errs, &FieldError{Key: f.key, Err: fmt.Errorf("%s (%s)", err, l.hint(f))})
+			} else {
+				errs = append(errs, &FieldError{Key: f.key, Source: sources[f.key], Err: err})
+			}
+		}
+	}
+	for _, f := range l.fields {
+		if len(f.with) == 0 || !v.Field(f.index).IsZero() {
+			continue
+		}
+		for _, other := range l.fields {
+			if other.key == f.with && !v.Field(other.index).IsZero() {
+				errs = append(errs, &FieldError{Key: f.key, Source: sources[f.key], Err: fmt.Errorf("missing if %s is set", f.with)})
+			}
+		}
+	}
+	for key := range file {
+		if !known[key] {
+			errs = append(errs, &FieldError{Key: key, Source: "file " + name, Err: fmt.Errorf("unknown key")})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	l.sources = sources
+	l.current = reflect.New(l.typ).Elem()
+	l.current.Set(v)
+	return nil
+}
+
+// hint describes where the value of a field can be set
+func (l *Loader) hint(f field) string {
+	name, _ := l.File()
+	where := []string{fmt.Sprintf("%s in %s", f.key, name)}
+	if len(f.env) > 0 {
+		where = append(where, f.env)
+	}
+	where = append(where, "-"+f.key)
+	return "set " + strings.Join(where, ", ")
+}
+
+func hasKey(m map[string]string, key string) bool {
+	_, ok := m[key]
+	return ok
+}
+
+// set parses s into the field v
+func set(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration e.g. 15m", s)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Int:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		v.SetInt(int64(i))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", s)
+		}
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("type %s not supported", v.Type())
+	}
+	return nil
+}
+
+// check validates the value of the field v
+func (f field) check(v reflect.Value) error {
+	if v.IsZero() {
+		if f.required {
+			return fmt.Errorf("missing")
+		}
+		if v.Kind() == reflect.String {
+			return nil
+		}
+	}
+	s := fmt.Sprint(v.Interface())
+	for _, rule := range f.validate {
+		name, arg := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, arg = rule[:i], rule[i+1:]
+		}
+		switch name {
+		case "url":
+			if u, err := url.Parse(s); err != nil || !u.IsAbs() {
+				return fmt.Errorf("%q is not an absolute URL", s)
+			}
+		case "file":
+			if _, err := os.Stat(s); err != nil {
+				return fmt.Errorf("%q does not exist", s)
+			}
+		case "digits":
+			for _, c := range s {
+				if c < '0' || c > '9' {
+					return fmt.Errorf("must contain digits only")
+				}
+			}
+		case "port":
+			if p, err := strconv.Atoi(s); err != nil || p < 1 || p > 65535 {
+				return fmt.Errorf("%q is not a port", s)
+			}
+		case "timezone":
+			if _, err := time.LoadLocation(s); err != nil {
+				return fmt.Errorf("%q is not a timezone (IANA name e.g. Europe/Zurich)", s)
+			}
+		case "min":
+			min, _ := strconv.ParseInt(arg, 10, 64)
+			if v.Int() < min {
+				return fmt.Errorf("must be at least %s", arg)
+			}
+		case "oneof":
+			ok := false
+			for _, o := range strings.Split(arg, "|") {
+				ok = ok || s == o
+			}
+			if !ok {
+				return fmt.Errorf("%q is not one of %s", s, strings.Replace(arg, "|", ", ", -1))
+			}
+		}
+	}
+	return nil
+}
+
+// Print writes cfg as config file with the source of every value, secrets are masked
+func (l *Loader) Print(w io.Writer, cfg interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(cfg))
+	for _, f := range l.fields {
+		value := v.Field(f.index).Interface()
+		if d, ok := value.(time.Duration); ok {
+			value = d.String()
+		}
+		if f.secret && !v.Field(f.index).IsZero() {
+			value = "********"
+		}
+		data, err := yaml.Marshal(map[string]interface{}{f.key: value})
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%-40s # %s\n", strings.TrimSpace(string(data)), l.sources[f.key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Command runs the sub commands "config print" and "config validate"
+// ok is false if args is not a config command
+func (l *Loader) Command(args []string, w io.Writer) (ok bool, err error) {
+	if len(args) == 0 || args[0] != "config" {
+		return false, nil
+	}
+	if len(args) != 2 {
+		return true, fmt.Errorf("usage: config print|validate")
+	}
+	cfg := reflect.New(l.typ).Interface()
+	switch args[1] {
+	case "print":
+		if err := l.Load(cfg); err != nil {
+			return true, err
+		}
+		return true, l.Print(w, cfg)
+	case "validate":
+		if err := l.Load(cfg); err != nil {
+			return true, err
+		}
+		name, _ := l.File()
+		fmt.Fprintf(w, "configuration valid (%s)\n", name)
+		return true, nil
+	}
+	return true, fmt.Errorf("config: no such sub command: %s", args[1])
+}
+
+// Watch loads the configuration again on SIGHUP until ctx is done
+// apply is called with the new configuration and the keys of the reloadable fields that changed,
+// changes of other fields are logged and take effect after a restart
+func (l *Loader) Watch(ctx context.Context, logger *slog.Logger, apply func(cfg interface{}, changed []string)) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+		}
+		l.reload(logger, apply)
+	}
+}
+
+// reload loads the configuration again and calls apply with the reloadable fields that changed,
+// the other fields keep the applied values until a restart i.e. a change is logged on every reload
+func (l *Loader) reload(logger *slog.Logger, apply func(cfg interface{}, changed []string)) {
+	previous, sources := l.current, l.sources
+	cfg := reflect.New(l.typ)
+	if err := l.Load(cfg.Interface()); err != nil {
+		logger.Error("config reload failed", "error", err)
+		return
+	}
+	changed := []string{}
+	for _, f := range l.fields {
+		if reflect.DeepEqual(previous.Field(f.index).Interface(), cfg.Elem().Field(f.index).Interface()) {
+			continue
+		}
+		if !f.reload {
+			logger.Warn("config changed - restart required", "key", f.key)
+			cfg.Elem().Field(f.index).Set(previous.Field(f.index))
+			l.current.Field(f.index).Set(previous.Field(f.index))
+			l.sources[f.key] = sources[f.key]
+			continue
+		}
+		changed = append(changed, f.key)
+	}
+	logger.Info("config reloaded", "applied", len(changed))
+	if len(changed) > 0 {
+		apply(cfg.Interface(), changed)
+	}
+}
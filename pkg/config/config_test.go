@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type settings struct {
+	Name     string        `yaml:"name" env:"TEST_NAME" reload:"true" usage:"name"`
+	Port     string        `yaml:"port" env:"TEST_PORT" required:"true" validate:"port" usage:"port"`
+	Interval time.Duration `yaml:"interval" env:"TEST_INTERVAL" validate:"min=1" usage:"interval"`
+	Source   string        `yaml:"source" env:"TEST_SOURCE" usage:"source"`
+	Property string        `yaml:"property" env:"TEST_PROPERTY" requiredwith:"source" usage:"property of the source"`
+	Secret   string        `yaml:"secret" env:"TEST_SECRET" secret:"true" usage:"secret"`
+}
+
+// load loads the settings from the config file with content, the environment env and the flags args
+func load(t *testing.T, content string, env map[string]string, args ...string) (*settings, *Loader, error) {
+	name := filepath.Join(t.TempDir(), "test.yaml")
+	if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"TEST_NAME", "TEST_PORT", "TEST_INTERVAL", "TEST_SOURCE", "TEST_PROPERTY", "TEST_SECRET", "TEST_CONFIG"} {
+		t.Setenv(key, env[key])
+	}
+	cfg := &settings{Port: "8080", Interval: time.Minute}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l := New(fs, cfg, "TEST_CONFIG", name)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return cfg, l, l.Load(cfg)
+}
+
+func TestLayers(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		env      map[string]string
+		args     []string
+		want     settings
+		wantFrom string
+	}{
+		{
+			name:     "defaults",
+			want:     settings{Port: "8080", Interval: time.Minute},
+			wantFrom: "default",
+		},
+		{
+			name:     "file",
+			file:     "name: file\nport: 8081\ninterval: 5m\n",
+			want:     settings{Name: "file", Port: "8081", Interval: 5 * time.Minute},
+			wantFrom: "file",
+		},
+		{
+			name:     "env over file",
+			file:     "name: file\nport: 8081\n",
+			env:      map[string]string{"TEST_NAME": "env"},
+			want:     settings{Name: "env", Port: "8081", Interval: time.Minute},
+			wantFrom: "env TEST_NAME",
+		},
+		{
+			name:     "flag over env",
+			file:     "name: file\n",
+			env:      map[string]string{"TEST_NAME": "env", "TEST_PORT": "8082"},
+			args:     []string{"-name", "flag"},
+			want:     settings{Name: "flag", Port: "8082", Interval: time.Minute},
+			wantFrom: "flag -name",
+		},
+		{
+			name:     "empty env ignored",
+			file:     "name: file\n",
+			env:      map[string]string{"TEST_NAME": ""},
+			want:     settings{Name: "file", Port: "8080", Interval: time.Minute},
+			wantFrom: "file",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, l, err := load(t, tt.file, tt.env, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *cfg != tt.want {
+				t.Errorf("got %+v, want %+v", *cfg, tt.want)
+			}
+			if from := l.sources["name"]; !strings.HasPrefix(from, tt.wantFrom) {
+				t.Errorf("source of name %q, want %q", from, tt.wantFrom)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{
+			name: "not valid",
+			file: "port: 0\n",
+			env:  map[string]string{"TEST_INTERVAL": "soon"},
+			want: []string{"port (file", "interval (env TEST_INTERVAL)"},
+		},
+		{
+			name: "required",
+			args: []string{"-port", ""},
+			want: []string{"port (flag -port): missing"},
+		},
+		{
+			name: "unknown key",
+			file: "nmae: typo\n",
+			want: []string{"nmae (file"},
+		},
+		{
+			name: "required with",
+			file: "source: calendar.ics\n",
+			want: []string{"property (default): missing if source is set"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := load(t, tt.file, tt.env, tt.args...)
+			errs, ok := err.(Errors)
+			if !ok {
+				t.Fatalf("got %v, want Errors", err)
+			}
+			if len(errs) != len(tt.want) {
+				t.Errorf("got %d errors, want %d: %v", len(errs), len(tt.want), err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("%q missing in %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestRequiredWith(t *testing.T) {
+	if _, _, err := load(t, "", nil); err != nil {
+		t.Errorf("property without source: %v", err)
+	}
+	cfg, _, err := load(t, "source: calendar.ics\n", map[string]string{"TEST_PROPERTY": "DESCRIPTION"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Property != "DESCRIPTION" {
+		t.Errorf("property %q", cfg.Property)
+	}
+}
+
+func TestConfigFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "missing.yaml")
+	t.Setenv("TEST_CONFIG", "")
+	l := New(flag.NewFlagSet("test", flag.ContinueOnError), &settings{Port: "8080", Interval: time.Minute}, "TEST_CONFIG", name)
+	if err := l.Load(&settings{}); err != nil {
+		t.Errorf("missing default config file: %v", err)
+	}
+	t.Setenv("TEST_CONFIG", name)
+	if err := l.Load(&settings{}); !os.IsNotExist(err) {
+		t.Errorf("missing config file given by env: got %v", err)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	cfg, l, err := load(t, "secret: s3cr3t\n", map[string]string{"TEST_NAME": "env"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &strings.Builder{}
+	if err := l.Print(b, cfg); err != nil {
+		t.Fatal(err)
+	}
+	out := b.String()
+	if strings.Contains(out, "s3cr3t") {
+		t.Errorf("secret not masked:\n%s", out)
+	}
+	for _, want := range []string{"name: env", "# env TEST_NAME", "interval: 1m0s", "# default"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("%q missing:\n%s", want, out)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	_, l, err := load(t, "name: first\n", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, _ := l.File()
+	log := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(log, nil))
+	tests := []struct {
+		name    string
+		content string
+		changed []string
+		warned  bool
+	}{
+		{"reloadable", "name: second\n", []string{"name"}, false},
+		{"restart required", "name: second\nport: 8081\n", nil, true},
+		{"restart still required", "name: third\nport: 8081\n", []string{"name"}, true},
+		{"restored", "name: third\nport: 8080\n", nil, false},
+		{"not valid", "name: fourth\nport: x\n", nil, false},
+	}
+	for _, tt := range tests {
+		if err := ioutil.WriteFile(name, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		log.Reset()
+		var changed []string
+		var applied *settings
+		l.reload(logger, func(cfg interface{}, keys []string) {
+			applied, changed = cfg.(*settings), keys
+		})
+		if !reflect.DeepEqual(changed, tt.changed) {
+			t.Errorf("%s: changed %q, want %q", tt.name, changed, tt.changed)
+		}
+		if applied != nil && applied.Port != "8080" {
+			t.Errorf("%s: port %s applied, want 8080 until a restart", tt.name, applied.Port)
+		}
+		if warned := strings.Contains(log.String(), "restart required"); warned != tt.warned {
+			t.Errorf("%s: warned %v, want %v:\n%s", tt.name, warned, tt.warned, log)
+		}
+	}
+	if port := l.current.Interface().(settings).Port; port != "8080" {
+		t.Errorf("current port %s, want 8080", port)
+	}
+}
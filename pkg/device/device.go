@@ -1,21 +1,53 @@
 package device
 
-// packeg is only used for buzzer-ws
+// package describes the devices registered on the server
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"context"
 	"net"
-	"net/http"
 	"strings"
 	"sync"
+	"time"
 )
 
+// Header identifies the calling device in requests to the server
+const Header = "X-Buzzer-Device"
+
 // Device represents a device with name an IP
+// Venue is the id of the venue the device is bound to, empty for all venues
 type Device struct {
-	Name string
-	IP   string
+	Name     string    `json:"name"`
+	IP       string    `json:"ip"`
+	Venue    string    `json:"venue,omitempty"`
+	LastSeen time.Time `json:"lastseen"`
+}
+
+// Commands understood by the devices
+const (
+	// CommandRelease releases the pitch like the buzzer does
+	CommandRelease = "release"
+	// CommandOff switches light, horn and ticker off
+	CommandOff = "off"
+)
+
+// Events reported by the devices
+const (
+	// EventReleased the pitch was released by the buzzer or a release command
+	EventReleased = "released"
+	// EventTimeUp the time of the pitch is up i.e. the light was switched off after the release
+	EventTimeUp = "timeup"
+)
+
+// Event represents an event reported by a device, the server assigns it to a pitch in the venue of the device
+type Event struct {
+	Name string    `json:"name"`
+	Time time.Time `json:"time"`
+}
+
+// Command represents a command sent to a device e.g. release or off
+type Command struct {
+	Name string    `json:"name"`
+	Sent time.Time `json:"sent"`
 }
 
 // Devices represents a list of Device
@@ -29,34 +61,28 @@ func NewDevices() *Devices {
 	return &Devices{Items: make(map[string]Device)}
 }
 
-// Register device name on URL
-func Register(name, url string) error {
-
-	ifAddrs, err := net.InterfaceAddrs()
-	if err != nil {
-		return err
-	}
-
+// Local returns the device name with the addresses of the local interfaces
+func Local(name string) Device {
 	addrs := []string{}
-	for _, a := range ifAddrs {
-		addrs = append(addrs, a.String())
+	if ifAddrs, err := net.InterfaceAddrs(); err == nil {
+		for _, a := range ifAddrs {
+			addrs = append(addrs, a.String())
+		}
 	}
-
-	//
-	dev := Device{
+	return Device{
 		Name: name,
 		IP:   strings.Join(addrs, ", "),
 	}
-	body, err := json.Marshal(dev)
-	if err != nil {
-		return err
-	}
-	resp, err := http.Post(url, "application/json", bytes.NewReader(body))
-	if err != nil {
-		return err
-	}
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("%s: %s", url, resp.Status)
-	}
-	return nil
+}
+
+// Registrar registers devices e.g. *client.Client
+type Registrar interface {
+	RegisterDevice(ctx context.Context, d Device) error
+}
+
+// Register registers the device name with the addresses of the local interfaces and binds it to venue
+func Register(ctx context.Context, r Registrar, name, venue string) error {
+	d := Local(name)
+	d.Venue = venue
+	return r.RegisterDevice(ctx, d)
 }
@@ -0,0 +1,58 @@
+package device
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+// registrar records the registered devices
+type registrar struct {
+	devices []Device
+	err     error
+}
+
+func (r *registrar) RegisterDevice(ctx context.Context, d Device) error {
+	r.devices = append(r.devices, d)
+	return r.err
+}
+
+func TestRegister(t *testing.T) {
+	r := &registrar{}
+	if err := Register(context.Background(), r, "buzzer1", "pflab"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.devices) != 1 {
+		t.Fatalf("%d devices registered, want 1", len(r.devices))
+	}
+	if d := r.devices[0]; d.Name != "buzzer1" || d.Venue != "pflab" || d.IP != Local("buzzer1").IP {
+		t.Errorf("device %+v, want buzzer1 in pflab with the local addresses", d)
+	}
+	r.err = errors.New("unauthorized")
+	if err := Register(context.Background(), r, "buzzer1", ""); err != r.err {
+		t.Errorf("error %v, want %v", err, r.err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	seen := time.Date(2030, 3, 30, 17, 30, 0, 0, time.UTC)
+	data, err := json.Marshal(Device{Name: "buzzer1", IP: "10.0.0.1", LastSeen: seen})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"name":"buzzer1","ip":"10.0.0.1","lastseen":"2030-03-30T17:30:00Z"}`; string(data) != want {
+		t.Errorf("device %s, want %s", data, want)
+	}
+	e := Event{}
+	if err := json.Unmarshal([]byte(`{"name": "released", "time": "2030-03-30T17:35:00Z"}`), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Name != EventReleased || !e.Time.Equal(seen.Add(5*time.Minute)) {
+		t.Errorf("event %+v, want released", e)
+	}
+	if d := NewDevices(); d.Items == nil {
+		t.Error("devices without items")
+	}
+}
@@ -0,0 +1,168 @@
+// Package health aggregates the health of the components of a daemon, serves it at /healthz and /readyz
+// and notifies systemd about readiness and liveness (sd_notify)
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Check returns an error if a component is not healthy
+type Check func() error
+
+type check struct {
+	name  string
+	check Check
+}
+
+// Health holds the checks of the components
+// the liveness checks fail if a component is wedged and the daemon has to be restarted,
+// the readiness checks fail if the daemon is running but can not do its job yet e.g. no pitch is known
+type Health struct {
+	mutex sync.Mutex
+	live  []check
+	ready []check
+}
+
+// New returns a new Health without checks
+func New() *Health {
+	return &Health{}
+}
+
+// Live registers a liveness check, it is part of the readiness as well
+func (h *Health) Live(name string, c Check) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.live = append(h.live, check{name: name, check: c})
+}
+
+// Ready registers a readiness check
+func (h *Health) Ready(name string, c Check) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.ready = append(h.ready, check{name: name, check: c})
+}
+
+// Report is the result of the checks
+type Report struct {
+	OK     bool              `json:"ok"`
+	Checks map[string]string `json:"checks"`
+}
+
+// Err returns the failed checks as error, nil if all passed
+func (r Report) Err() error {
+	if r.OK {
+		return nil
+	}
+	var failed []string
+	for name, result := range r.Checks {
+		if result != "ok" {
+			failed = append(failed, fmt.Sprintf("%s: %s", name, result))
+		}
+	}
+	sort.Strings(failed)
+	return fmt.Errorf("unhealthy: %v", failed)
+}
+
+// Liveness runs the liveness checks
+func (h *Health) Liveness() Report {
+	h.mutex.Lock()
+	checks := append([]check{}, h.live...)
+	h.mutex.Unlock()
+	return run(checks)
+}
+
+// Readiness runs the liveness and the readiness checks
+func (h *Health) Readiness() Report {
+	h.mutex.Lock()
+	checks := append(append([]check{}, h.live...), h.ready...)
+	h.mutex.Unlock()
+	return run(checks)
+}
+
+func run(checks []check) Report {
+	r := Report{OK: true, Checks: make(map[string]string)}
+	for _, c := range checks {
+		if err := c.check(); err != nil {
+			r.OK = false
+			r.Checks[c.name] = err.Error()
+			continue
+		}
+		r.Checks[c.name] = "ok"
+	}
+	return r
+}
+
+// Healthz serves the liveness, the status is 503 if a check failed
+func (h *Health) Healthz(w http.ResponseWriter, r *http.Request) {
+	write(w, h.Liveness())
+}
+
+// Readyz serves the readiness, the status is 503 if a check failed
+func (h *Health) Readyz(w http.ResponseWriter, r *http.Request) {
+	write(w, h.Readiness())
+}
+
+func write(w http.ResponseWriter, r Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	if !r.OK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(r)
+}
+
+// Serve serves /healthz and /readyz on addr until ctx is done
+func Serve(ctx context.Context, addr string, h *Health) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", h.Healthz)
+	mux.HandleFunc("/readyz", h.Readyz)
+	srv := &http.Server{Addr: addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdown)
+}
+
+// Heartbeat is beaten by a loop of a component, the check fails if the last beat is older than the maximum age
+// e.g. the main loop of the screen is stuck
+type Heartbeat struct {
+	mutex  sync.Mutex
+	maxAge time.Duration
+	last   time.Time
+}
+
+// NewHeartbeat returns a new Heartbeat failing if not beaten within maxAge, the first period starts now
+func NewHeartbeat(maxAge time.Duration) *Heartbeat {
+	return &Heartbeat{maxAge: maxAge, last: time.Now()}
+}
+
+// Beat records a heartbeat
+func (hb *Heartbeat) Beat() {
+	hb.mutex.Lock()
+	hb.last = time.Now()
+	hb.mutex.Unlock()
+}
+
+// Check implements Check
+func (hb *Heartbeat) Check() error {
+	hb.mutex.Lock()
+	defer hb.mutex.Unlock()
+	if age := time.Since(hb.last); age > hb.maxAge {
+		return fmt.Errorf("no heartbeat for %s", age.Truncate(time.Second))
+	}
+	return nil
+}
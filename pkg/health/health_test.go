@@ -0,0 +1,70 @@
+package health
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	h := New()
+	var boardErr error
+	h.Live("board", func() error { return boardErr })
+	h.Ready("pitch", func() error { return errors.New("no pitch known") })
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		board   error
+		status  int
+		checks  map[string]string
+	}{
+		{"live", h.Healthz, nil, http.StatusOK, map[string]string{"board": "ok"}},
+		{"not ready", h.Readyz, nil, http.StatusServiceUnavailable, map[string]string{"board": "ok", "pitch": "no pitch known"}},
+		{"wedged", h.Healthz, errors.New("stuck"), http.StatusServiceUnavailable, map[string]string{"board": "stuck"}},
+	}
+	for _, tt := range tests {
+		boardErr = tt.board
+		w := httptest.NewRecorder()
+		tt.handler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		var r Report
+		if err := json.NewDecoder(w.Body).Decode(&r); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if w.Code != tt.status || r.OK != (tt.status == http.StatusOK) || len(r.Checks) != len(tt.checks) {
+			t.Errorf("%s: status %d %+v, want %d %v", tt.name, w.Code, r, tt.status, tt.checks)
+		}
+		for name, result := range tt.checks {
+			if r.Checks[name] != result {
+				t.Errorf("%s: %s %q, want %q", tt.name, name, r.Checks[name], result)
+			}
+		}
+	}
+
+	boardErr = errors.New("stuck")
+	if err := h.Readiness().Err(); err == nil || err.Error() != "unhealthy: [board: stuck pitch: no pitch known]" {
+		t.Errorf("error %v, want the failed checks in order", err)
+	}
+	boardErr = nil
+	if err := h.Liveness().Err(); err != nil {
+		t.Errorf("error %v, want none", err)
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	hb := NewHeartbeat(time.Hour)
+	if err := hb.Check(); err != nil {
+		t.Errorf("error %v, want none within the first period", err)
+	}
+	hb.last = time.Now().Add(-2 * time.Hour)
+	if err := hb.Check(); err == nil || err.Error() != "no heartbeat for 2h0m0s" {
+		t.Errorf("error %v, want no heartbeat", err)
+	}
+	hb.Beat()
+	if err := hb.Check(); err != nil {
+		t.Errorf("error %v, want none after the beat", err)
+	}
+}
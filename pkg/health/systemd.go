@@ -0,0 +1,80 @@
+package health
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// states sent to systemd
+const (
+	StateReady    = "READY=1"
+	StateStopping = "STOPPING=1"
+	StateWatchdog = "WATCHDOG=1"
+)
+
+// Notify sends state to systemd (sd_notify), it does nothing if the daemon is not started by systemd with Type=notify
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if len(socket) == 0 {
+		return nil
+	}
+	// abstract socket
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// WatchdogInterval returns the interval of the systemd watchdog (WatchdogSec), 0 if it is not enabled for this process
+func WatchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); len(pid) > 0 && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// Systemd notifies systemd that the daemon is ready and keeps the watchdog alive as long as the liveness checks pass
+// until ctx is done, a wedged component stops the keep-alives and systemd restarts the daemon
+func (h *Health) Systemd(ctx context.Context, logger *slog.Logger) error {
+	if err := Notify(StateReady); err != nil {
+		logger.Error("notifying systemd failed", "error", err)
+	}
+	interval := WatchdogInterval()
+	if interval == 0 {
+		<-ctx.Done()
+		return nil
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if err := Notify(StateStopping); err != nil {
+				logger.Error("notifying systemd failed", "error", err)
+			}
+			return nil
+		case <-ticker.C:
+		}
+		if err := h.Liveness().Err(); err != nil {
+			logger.Error("watchdog not notified", "error", err)
+			continue
+		}
+		if err := Notify(StateWatchdog); err != nil {
+			logger.Error("notifying systemd failed", "error", err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// notifications listens on a notify socket set in NOTIFY_SOCKET and returns the received states
+func notifications(t *testing.T) <-chan string {
+	t.Helper()
+	// the path of a unix socket is limited to about 100 bytes
+	dir, err := os.MkdirTemp("", "sd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "notify")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", socket)
+	states := make(chan string, 10)
+	go func() {
+		b := make([]byte, 64)
+		for {
+			n, err := conn.Read(b)
+			if err != nil {
+				return
+			}
+			states <- string(b[:n])
+		}
+	}()
+	return states
+}
+
+// state returns the next state received
+func state(t *testing.T, states <-chan string) string {
+	t.Helper()
+	select {
+	case s := <-states:
+		return s
+	case <-time.After(time.Second):
+		t.Fatal("no state received")
+	}
+	return ""
+}
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify(StateReady); err != nil {
+		t.Errorf("error %v, want none without systemd", err)
+	}
+	states := notifications(t)
+	if err := Notify(StateReady); err != nil {
+		t.Fatal(err)
+	}
+	if s := state(t, states); s != StateReady {
+		t.Errorf("state %q, want %q", s, StateReady)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		usec string
+		pid  string
+		want time.Duration
+	}{
+		{"", "", 0},
+		{"x", "", 0},
+		{"-1", "", 0},
+		{"30000000", "", 30 * time.Second},
+		{"30000000", pid, 30 * time.Second},
+		{"30000000", "1", 0},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		if d := WatchdogInterval(); d != tt.want {
+			t.Errorf("%q %q: %s, want %s", tt.usec, tt.pid, d, tt.want)
+		}
+	}
+}
+
+func TestSystemd(t *testing.T) {
+	states := notifications(t)
+	t.Setenv("WATCHDOG_USEC", "40000")
+	t.Setenv("WATCHDOG_PID", "")
+	h := New()
+	var wedged atomic.Bool
+	h.Live("screen", func() error {
+		if wedged.Load() {
+			return errors.New("stuck")
+		}
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- h.Systemd(ctx, slog.New(slog.NewTextHandler(io.Discard, nil))) }()
+
+	if s := state(t, states); s != StateReady {
+		t.Errorf("state %q, want %q", s, StateReady)
+	}
+	if s := state(t, states); s != StateWatchdog {
+		t.Errorf("state %q, want %q", s, StateWatchdog)
+	}
+	// a wedged component stops the keep-alives
+	wedged.Store(true)
+	time.Sleep(30 * time.Millisecond)
+	for len(states) > 0 {
+		<-states
+	}
+	time.Sleep(60 * time.Millisecond)
+	if len(states) > 0 {
+		t.Errorf("state %q, want no keep-alive while wedged", <-states)
+	}
+	wedged.Store(false)
+	if s := state(t, states); s != StateWatchdog {
+		t.Errorf("state %q, want %q", s, StateWatchdog)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	for s := state(t, states); s != StateStopping; s = state(t, states) {
+		if s != StateWatchdog {
+			t.Fatalf("state %q, want %q", s, StateStopping)
+		}
+	}
+}
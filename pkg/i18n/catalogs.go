@@ -0,0 +1,144 @@
+package i18n
+
+// catalogs contains the messages per language, the messages shown on the ticker are ASCII only
+// plural forms are the keys with the suffix .one and .other
+var catalogs = map[string]map[string]string{
+	"de": {
+		"minutes.one":       "%d Minute",
+		"minutes.other":     "%d Minuten",
+		"seconds.one":       "%d Sekunde",
+		"seconds.other":     "%d Sekunden",
+		"hours.one":         "%d Stunde",
+		"hours.other":       "%d Stunden",
+		"duration":          "%s %s",
+		"layout.time":       "15:04",
+		"layout.date":       "02.01.2006 15:04",
+		"message.upcoming":  "In {{minutes .Minutes}} Pitch{{with .VenueName}} im {{.}}{{end}}: {{.Title}} von {{.Speaker}}",
+		"message.starting":  "Jetzt Pitch{{with .VenueName}} im {{.}}{{end}}: {{.Title}} von {{.Speaker}}",
+		"message.running":   "Pitch{{with .VenueName}} im {{.}}{{end}} seit {{minutes .MinutesSince}}: {{.Title}} von {{.Speaker}}",
+		"message.open":      "Offener Pitch-Slot{{with .VenueName}} im {{.}}{{end}} in {{minutes .Minutes}} - jetzt anmelden!",
+		"keypad.prompt":     "%s\nPIN eingeben, um den Buzzer freizugeben ... ",
+		"keypad.invalid":    "FEHLER: PIN ungültig",
+		"keypad.valid":      "PIN gültig - Buzzer drücken, um den Pitch freizugeben ...\n",
+		"status.ip":         "IP: %s",
+		"status.offline":    "%s - Verbindung unterbrochen seit %s",
+		"schedule.title":    "Pitches",
+		"schedule.date":     "Datum",
+		"schedule.speaker":  "Referent",
+		"schedule.pitch":    "Pitch",
+		"schedule.venue":    "Raum",
+		"schedule.all":      "Alle Räume",
+		"schedule.empty":    "Keine Pitches geplant",
+		"signup.title":      "Pitch anmelden",
+		"signup.slot":       "Slot",
+		"signup.speaker":    "Name",
+		"signup.pitch":      "Titel",
+		"signup.abstract":   "Zusammenfassung",
+		"signup.contact":    "E-Mail",
+		"signup.submit":     "Anmelden",
+		"signup.thanks":     "Danke! Die Anmeldung wird von den Organisatoren geprüft, die Bestätigung folgt per E-Mail.",
+		"signup.none":       "Zurzeit sind keine Slots frei.",
+		"signup.waitlist":   "Warteliste",
+		"signup.waitlisted": "Der Slot ist bereits vergeben - du bist auf der Warteliste und wirst benachrichtigt, falls er frei wird.",
+		"offer.title":       "Pitch-Slot frei geworden",
+		"offer.text":        "Der Slot am %s ist frei geworden. Bitte bis %s annehmen oder ablehnen.",
+		"offer.accept":      "Annehmen",
+		"offer.decline":     "Ablehnen",
+		"offer.accepted":    "Danke! Dein Pitch ist bestätigt.",
+		"offer.declined":    "Schade - der Slot wird weitergegeben.",
+		"offer.invalid":     "Das Angebot ist nicht mehr gültig.",
+		"calendar.name":     "Pitches",
+	},
+	"en": {
+		"minutes.one":       "%d minute",
+		"minutes.other":     "%d minutes",
+		"seconds.one":       "%d second",
+		"seconds.other":     "%d seconds",
+		"hours.one":         "%d hour",
+		"hours.other":       "%d hours",
+		"duration":          "%s %s",
+		"layout.time":       "15:04",
+		"layout.date":       "2006-01-02 15:04",
+		"message.upcoming":  "Pitch{{with .VenueName}} at {{.}}{{end}} in {{minutes .Minutes}}: {{.Title}} by {{.Speaker}}",
+		"message.starting":  "Pitch{{with .VenueName}} at {{.}}{{end}} starting now: {{.Title}} by {{.Speaker}}",
+		"message.running":   "Pitch{{with .VenueName}} at {{.}}{{end}} running for {{minutes .MinutesSince}}: {{.Title}} by {{.Speaker}}",
+		"message.open":      "Open pitch slot{{with .VenueName}} at {{.}}{{end}} in {{minutes .Minutes}} - sign up now!",
+		"keypad.prompt":     "%s\nEnter a valid PIN to release the Buzzer ... ",
+		"keypad.invalid":    "ERROR: invalid PIN",
+		"keypad.valid":      "PIN valid - Please press the Buzzer to release the Pitch ...\n",
+		"status.ip":         "IP: %s",
+		"status.offline":    "%s - connection lost since %s",
+		"schedule.title":    "Pitches",
+		"schedule.date":     "Date",
+		"schedule.speaker":  "Speaker",
+		"schedule.pitch":    "Pitch",
+		"schedule.venue":    "Venue",
+		"schedule.all":      "All venues",
+		"schedule.empty":    "No pitches scheduled",
+		"signup.title":      "Sign up for a pitch",
+		"signup.slot":       "Slot",
+		"signup.speaker":    "Name",
+		"signup.pitch":      "Title",
+		"signup.abstract":   "Abstract",
+		"signup.contact":    "E-mail",
+		"signup.submit":     "Sign up",
+		"signup.thanks":     "Thank you! The organizers review your sign-up, the confirmation follows by e-mail.",
+		"signup.none":       "There are no open slots at the moment.",
+		"signup.waitlist":   "waitlist",
+		"signup.waitlisted": "The slot is already taken - you are on the waitlist and will be notified if it becomes free.",
+		"offer.title":       "Pitch slot available",
+		"offer.text":        "The slot on %s became free. Please accept or decline until %s.",
+		"offer.accept":      "Accept",
+		"offer.decline":     "Decline",
+		"offer.accepted":    "Thank you! Your pitch is confirmed.",
+		"offer.declined":    "Too bad - the slot is passed on.",
+		"offer.invalid":     "The offer is no longer valid.",
+		"calendar.name":     "Pitches",
+	},
+	"fr": {
+		"minutes.one":       "%d minute",
+		"minutes.other":     "%d minutes",
+		"seconds.one":       "%d seconde",
+		"seconds.other":     "%d secondes",
+		"hours.one":         "%d heure",
+		"hours.other":       "%d heures",
+		"duration":          "%s %s",
+		"layout.time":       "15:04",
+		"layout.date":       "02/01/2006 15:04",
+		"message.upcoming":  "Pitch{{with .VenueName}} au {{.}}{{end}} dans {{minutes .Minutes}} : {{.Title}} par {{.Speaker}}",
+		"message.starting":  "Pitch{{with .VenueName}} au {{.}}{{end}} maintenant : {{.Title}} par {{.Speaker}}",
+		"message.running":   "Pitch{{with .VenueName}} au {{.}}{{end}} depuis {{minutes .MinutesSince}} : {{.Title}} par {{.Speaker}}",
+		"message.open":      "Creneau de pitch libre{{with .VenueName}} au {{.}}{{end}} dans {{minutes .Minutes}} - inscrivez-vous !",
+		"keypad.prompt":     "%s\nEntrez un PIN valide pour libérer le Buzzer ... ",
+		"keypad.invalid":    "ERREUR : PIN invalide",
+		"keypad.valid":      "PIN valide - Appuyez sur le Buzzer pour lancer le Pitch ...\n",
+		"status.ip":         "IP : %s",
+		"status.offline":    "%s - connexion perdue depuis %s",
+		"schedule.title":    "Pitches",
+		"schedule.date":     "Date",
+		"schedule.speaker":  "Orateur",
+		"schedule.pitch":    "Pitch",
+		"schedule.venue":    "Salle",
+		"schedule.all":      "Toutes les salles",
+		"schedule.empty":    "Aucun pitch prévu",
+		"signup.title":      "S'inscrire pour un pitch",
+		"signup.slot":       "Créneau",
+		"signup.speaker":    "Nom",
+		"signup.pitch":      "Titre",
+		"signup.abstract":   "Résumé",
+		"signup.contact":    "E-mail",
+		"signup.submit":     "S'inscrire",
+		"signup.thanks":     "Merci ! Les organisateurs examinent votre inscription, la confirmation suit par e-mail.",
+		"signup.none":       "Aucun créneau libre pour le moment.",
+		"signup.waitlist":   "liste d'attente",
+		"signup.waitlisted": "Le créneau est déjà pris - vous êtes sur la liste d'attente et serez informé s'il se libère.",
+		"offer.title":       "Créneau de pitch disponible",
+		"offer.text":        "Le créneau du %s s'est libéré. Veuillez accepter ou refuser jusqu'au %s.",
+		"offer.accept":      "Accepter",
+		"offer.decline":     "Refuser",
+		"offer.accepted":    "Merci ! Votre pitch est confirmé.",
+		"offer.declined":    "Dommage - le créneau est transmis.",
+		"offer.invalid":     "L'offre n'est plus valable.",
+		"calendar.name":     "Pitches",
+	},
+}
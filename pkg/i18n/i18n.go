@@ -0,0 +1,180 @@
+package i18n
+
+// package provides the message catalogs and the formatting of times and durations per locale
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Defaults
+const (
+	DefaultLanguage = "de"
+	DefaultTimezone = "Europe/Zurich"
+)
+
+// Locale formats messages, numbers and times for a language and a timezone
+type Locale struct {
+	Language string
+	Location *time.Location
+	catalog  map[string]string
+}
+
+// New returns the Locale for language (e.g. de, de-CH) and timezone (IANA name)
+func New(language, timezone string) (*Locale, error) {
+	lang := base(language)
+	catalog, ok := catalogs[lang]
+	if !ok {
+		return nil, fmt.Errorf("no such language: %s (available: %s)", language, strings.Join(Languages(), ", "))
+	}
+	if len(timezone) == 0 {
+		timezone = DefaultTimezone
+	}
+	loc, err := time.LoadLocation(timezone)
+	if err != nil {
+		return nil, fmt.Errorf("no such timezone: %s", timezone)
+	}
+	return &Locale{Language: lang, Location: loc, catalog: catalog}, nil
+}
+
+// Default returns the Locale for DefaultLanguage and DefaultTimezone
+func Default() *Locale {
+	l, err := New(DefaultLanguage, DefaultTimezone)
+	if err != nil {
+		l, _ = New(DefaultLanguage, "UTC")
+	}
+	return l
+}
+
+// In returns a copy of the Locale formatting times in loc
+func (l *Locale) In(loc *time.Location) *Locale {
+	if loc == nil || loc == l.Location {
+		return l
+	}
+	c := *l
+	c.Location = loc
+	return &c
+}
+
+// Languages returns the languages with a catalog
+func Languages() []string {
+	langs := []string{}
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// base returns the language of a tag e.g. de for de-CH
+func base(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	if i := strings.IndexAny(tag, "-_"); i >= 0 {
+		tag = tag[:i]
+	}
+	return tag
+}
+
+// Match returns the first language of an Accept-Language header with a catalog or fallback
+func Match(accept, fallback string) string {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+	langs := []weighted{}
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		w := weighted{lang: base(fields[0]), q: 1}
+		for _, f := range fields[1:] {
+			if f = strings.TrimSpace(f); strings.HasPrefix(f, "q=") {
+				w.q, _ = strconv.ParseFloat(f[2:], 64)
+			}
+		}
+		langs = append(langs, w)
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	for _, w := range langs {
+		if _, ok := catalogs[w.lang]; ok && w.q > 0 {
+			return w.lang
+		}
+	}
+	return fallback
+}
+
+// T returns the message for key formatted with args, the english message or the key if missing
+func (l *Locale) T(key string, args ...interface{}) string {
+	msg, ok := l.catalog[key]
+	if !ok {
+		if msg, ok = catalogs["en"][key]; !ok {
+			return key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// N returns the plural form of the message for key and n e.g. N("minutes", 5) returns "5 minutes"
+func (l *Locale) N(key string, n int) string {
+	return l.T(key+"."+l.plural(n), n)
+}
+
+// plural returns the plural category of n
+func (l *Locale) plural(n int) string {
+	switch l.Language {
+	case "fr":
+		if n == 0 || n == 1 || n == -1 {
+			return "one"
+		}
+	default:
+		if n == 1 || n == -1 {
+			return "one"
+		}
+	}
+	return "other"
+}
+
+// Minutes returns the number of minutes e.g. "1 Minute", "5 Minuten"
+func (l *Locale) Minutes(n int) string {
+	return l.N("minutes", n)
+}
+
+// Hours returns the number of hours e.g. "1 hour", "2 hours"
+func (l *Locale) Hours(n int) string {
+	return l.N("hours", n)
+}
+
+// Seconds returns the number of seconds e.g. "1 second", "30 seconds"
+func (l *Locale) Seconds(n int) string {
+	return l.N("seconds", n)
+}
+
+// Duration returns d in hours and minutes e.g. "1 Stunde 5 Minuten"
+func (l *Locale) Duration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	hrs := int(d.Hours())
+	min := int(d.Minutes()) - hrs*60
+	switch {
+	case hrs == 0:
+		return l.Minutes(min)
+	case min == 0:
+		return l.Hours(hrs)
+	}
+	return l.T("duration", l.Hours(hrs), l.Minutes(min))
+}
+
+// Time returns the time of day of t in the location
+func (l *Locale) Time(t time.Time) string {
+	return t.In(l.Location).Format(l.T("layout.time"))
+}
+
+// Date returns date and time of t in the location
+func (l *Locale) Date(t time.Time) string {
+	return t.In(l.Location).Format(l.T("layout.date"))
+}
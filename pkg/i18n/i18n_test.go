@@ -0,0 +1,89 @@
+package i18n
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	l, err := New("de-CH", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Language != "de" || l.Location.String() != DefaultTimezone {
+		t.Errorf("locale %s %s, want de in %s", l.Language, l.Location, DefaultTimezone)
+	}
+	if _, err := New("it", "Europe/Rome"); err == nil || !strings.Contains(err.Error(), "available: de, en, fr") {
+		t.Errorf("error %v, want the available languages", err)
+	}
+	if _, err := New("en", "Europe/Nowhere"); err == nil {
+		t.Error("unknown timezone: no error")
+	}
+}
+
+func TestCatalogs(t *testing.T) {
+	for lang, catalog := range catalogs {
+		for key := range catalogs["en"] {
+			if _, ok := catalog[key]; !ok {
+				t.Errorf("%s: %s missing", lang, key)
+			}
+		}
+		// shown on the ticker
+		for key, msg := range catalog {
+			if strings.HasPrefix(key, "message.") && strings.IndexFunc(msg, func(r rune) bool { return r > 127 }) >= 0 {
+				t.Errorf("%s: %s %q is not ASCII", lang, key, msg)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"fr-CH, fr;q=0.9, en;q=0.8", "fr"},
+		{"it, en;q=0.5, de;q=0.7", "de"},
+		{"en;q=0, it", "de"},
+		{"", "de"},
+	}
+	for _, tt := range tests {
+		if lang := Match(tt.accept, "de"); lang != tt.want {
+			t.Errorf("%q: %s, want %s", tt.accept, lang, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	de, _ := New("de", "Europe/Zurich")
+	en, _ := New("en", "UTC")
+	fr, _ := New("fr", "Europe/Paris")
+	date := time.Date(2030, 3, 30, 16, 30, 0, 0, time.UTC)
+	tests := []struct {
+		got  string
+		want string
+	}{
+		{de.Minutes(1), "1 Minute"},
+		{de.Minutes(5), "5 Minuten"},
+		{en.Minutes(-1), "-1 minute"},
+		{fr.Minutes(0), "0 minute"},
+		{en.Duration(65 * time.Minute), "1 hour 5 minutes"},
+		{en.Duration(-2 * time.Hour), "2 hours"},
+		{de.Duration(30 * time.Minute), "30 Minuten"},
+		{de.Time(date), "17:30"},
+		{en.Time(date), "16:30"},
+		{de.In(en.Location).Time(date), "16:30"},
+		{de.Date(date), "30.03.2030 17:30"},
+		{en.T("no.such.key"), "no.such.key"},
+		{de.T("status.ip", "10.0.0.1"), "IP: 10.0.0.1"},
+	}
+	for i, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%d: %q, want %q", i, tt.got, tt.want)
+		}
+	}
+	if de.In(nil) != de || de.In(de.Location) != de {
+		t.Error("copied for the same location")
+	}
+}
@@ -0,0 +1,4 @@
+package i18n
+
+// the timezone database is embedded, the zoneinfo of the system may be missing (e.g. on the Raspberry Pi)
+import _ "time/tzdata"
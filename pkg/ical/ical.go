@@ -0,0 +1,335 @@
+package ical
+
+// package implements the small subset of RFC 5545 needed to exchange
+// the pitch schedule with calendar applications
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dateTimeFormat    = "20060102T150405"
+	dateTimeUTCFormat = "20060102T150405Z"
+	dateFormat        = "20060102"
+	// maxLineLength is the maximal length of a line in octets without the line break,
+	// the leading space of a continuation line included
+	maxLineLength = 75
+)
+
+// Property represents a content line e.g. DTSTART;TZID=Europe/Zurich:20170124T173000
+type Property struct {
+	Name   string
+	Params map[string]string
+	Value  string
+}
+
+// Text returns the unescaped value of a TEXT property
+func (p Property) Text() string {
+	return unescape(p.Value)
+}
+
+// Time returns the value of a DATE or DATE-TIME property
+// floating times are interpreted in loc
+func (p Property) Time(loc *time.Location) (time.Time, error) {
+	if tzid, ok := p.Params["TZID"]; ok {
+		l, err := time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s: %s", p.Name, err)
+		}
+		loc = l
+	}
+	switch {
+	case p.Params["VALUE"] == "DATE" || len(p.Value) == len(dateFormat):
+		return time.ParseInLocation(dateFormat, p.Value, loc)
+	case strings.HasSuffix(p.Value, "Z"):
+		return time.Parse(dateTimeUTCFormat, p.Value)
+	default:
+		return time.ParseInLocation(dateTimeFormat, p.Value, loc)
+	}
+}
+
+// Event represents a VEVENT component
+// a recurring event has a RRULE and the excepted dates (EXDATE), an instance of it (see Expand)
+// or an event overriding an instance has the RECURRENCE-ID
+type Event struct {
+	UID          string
+	Summary      string
+	Description  string
+	Location     string
+	Start        time.Time
+	Status       string
+	Sequence     int
+	Stamp        time.Time
+	LastModified time.Time
+	RRule        string
+	ExDates      []time.Time
+	RecurrenceID time.Time
+	Properties   map[string]Property
+}
+
+// ID returns the UID of the event, the UID and the RECURRENCE-ID in UTC of an instance of a recurring event
+// e.g. 42@example.com-20170126T163000Z
+func (e *Event) ID() string {
+	if e.RecurrenceID.IsZero() {
+		return e.UID
+	}
+	return e.UID + "-" + e.RecurrenceID.UTC().Format(dateTimeUTCFormat)
+}
+
+// Modified returns LAST-MODIFIED or DTSTAMP if the former is missing
+func (e *Event) Modified() time.Time {
+	if !e.LastModified.IsZero() {
+		return e.LastModified
+	}
+	return e.Stamp
+}
+
+// Field returns the plain value of the named property
+// for calendar user addresses (ORGANIZER, ATTENDEE) the common name is preferred
+func (e *Event) Field(name string) string {
+	p, ok := e.Properties[strings.ToUpper(name)]
+	if !ok {
+		return ""
+	}
+	if cn, ok := p.Params["CN"]; ok && len(cn) > 0 {
+		return cn
+	}
+	if strings.HasPrefix(strings.ToLower(p.Value), "mailto:") {
+		return p.Value[len("mailto:"):]
+	}
+	return p.Text()
+}
+
+// Parse reads all events from a VCALENDAR stream, recurring events are not expanded (see Expand)
+// floating times are interpreted in loc
+func Parse(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		events []Event
+		cur    *Event
+		depth  int
+	)
+	for n, l := range lines {
+		p, err := parseLine(l)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", n+1, err)
+		}
+		switch p.Name {
+		case "BEGIN":
+			depth++
+			if p.Value == "VEVENT" {
+				cur = &Event{Properties: make(map[string]Property)}
+				depth = 0
+			}
+			continue
+		case "END":
+			if p.Value == "VEVENT" && cur != nil {
+				events = append(events, *cur)
+				cur = nil
+				continue
+			}
+			depth--
+			continue
+		}
+		// ignore properties outside of events and of nested components (VALARM)
+		if cur == nil || depth > 0 {
+			continue
+		}
+		if _, ok := cur.Properties[p.Name]; !ok {
+			cur.Properties[p.Name] = p
+		}
+		switch p.Name {
+		case "UID":
+			cur.UID = p.Value
+		case "SUMMARY":
+			cur.Summary = p.Text()
+		case "DESCRIPTION":
+			cur.Description = p.Text()
+		case "LOCATION":
+			cur.Location = p.Text()
+		case "STATUS":
+			cur.Status = strings.ToUpper(p.Value)
+		case "SEQUENCE":
+			cur.Sequence, _ = strconv.Atoi(p.Value)
+		case "DTSTART":
+			if cur.Start, err = p.Time(loc); err != nil {
+				return nil, fmt.Errorf("line %d: %s", n+1, err)
+			}
+		case "DTSTAMP":
+			cur.Stamp, _ = p.Time(time.UTC)
+		case "LAST-MODIFIED":
+			cur.LastModified, _ = p.Time(time.UTC)
+		case "RRULE":
+			cur.RRule = p.Value
+		case "RECURRENCE-ID":
+			if cur.RecurrenceID, err = p.Time(loc); err != nil {
+				return nil, fmt.Errorf("line %d: %s", n+1, err)
+			}
+		case "EXDATE":
+			// the property may occur more than once with a list of dates
+			for _, v := range strings.Split(p.Value, ",") {
+				d, err := Property{Name: p.Name, Params: p.Params, Value: v}.Time(loc)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %s", n+1, err)
+				}
+				cur.ExDates = append(cur.ExDates, d)
+			}
+		}
+	}
+	if cur != nil {
+		return nil, errors.New("unterminated VEVENT")
+	}
+	return events, nil
+}
+
+// Calendar represents a VCALENDAR to be written
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []Event
+}
+
+// WriteTo writes the calendar in iCalendar format
+func (c *Calendar) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	line := func(name, value string) {
+		fold(&buf, fmt.Sprintf("%s:%s", name, value))
+	}
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", c.ProdID)
+	line("CALSCALE", "GREGORIAN")
+	if len(c.Name) > 0 {
+		line("X-WR-CALNAME", escape(c.Name))
+	}
+	for _, e := range c.Events {
+		line("BEGIN", "VEVENT")
+		line("UID", e.UID)
+		line("DTSTAMP", e.Stamp.UTC().Format(dateTimeUTCFormat))
+		line("DTSTART", e.Start.UTC().Format(dateTimeUTCFormat))
+		if !e.LastModified.IsZero() {
+			line("LAST-MODIFIED", e.LastModified.UTC().Format(dateTimeUTCFormat))
+		}
+		if e.Sequence > 0 {
+			line("SEQUENCE", strconv.Itoa(e.Sequence))
+		}
+		line("SUMMARY", escape(e.Summary))
+		if len(e.Description) > 0 {
+			line("DESCRIPTION", escape(e.Description))
+		}
+		if len(e.Location) > 0 {
+			line("LOCATION", escape(e.Location))
+		}
+		if len(e.Status) > 0 {
+			line("STATUS", e.Status)
+		}
+		if len(e.RRule) > 0 {
+			line("RRULE", e.RRule)
+		}
+		if len(e.ExDates) > 0 {
+			dates := make([]string, len(e.ExDates))
+			for i, d := range e.ExDates {
+				dates[i] = d.UTC().Format(dateTimeUTCFormat)
+			}
+			line("EXDATE", strings.Join(dates, ","))
+		}
+		if !e.RecurrenceID.IsZero() {
+			line("RECURRENCE-ID", e.RecurrenceID.UTC().Format(dateTimeUTCFormat))
+		}
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return buf.WriteTo(w)
+}
+
+// unfold joins continuation lines (starting with space or tab) with their predecessor
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for s.Scan() {
+		l := strings.TrimRight(s.Text(), "\r")
+		if len(l) == 0 {
+			continue
+		}
+		if (l[0] == ' ' || l[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += l[1:]
+			continue
+		}
+		lines = append(lines, l)
+	}
+	return lines, s.Err()
+}
+
+// fold writes a content line and splits it into lines of at most 75 octets,
+// the continuation lines start with a space and take 74 octets of the content line
+func fold(buf *bytes.Buffer, l string) {
+	max := maxLineLength
+	for len(l) > max {
+		// do not split UTF-8 sequences
+		i := max
+		for i > 0 && l[i]&0xc0 == 0x80 {
+			i--
+		}
+		buf.WriteString(l[:i])
+		buf.WriteString("\r\n ")
+		l = l[i:]
+		max = maxLineLength - 1
+	}
+	buf.WriteString(l)
+	buf.WriteString("\r\n")
+}
+
+// parseLine splits a content line into name, parameters and value
+func parseLine(l string) (Property, error) {
+	p := Property{Params: make(map[string]string)}
+	// the value starts at the first colon outside of a quoted parameter value
+	quoted := false
+	sep := -1
+	for i, c := range l {
+		if c == '"' {
+			quoted = !quoted
+		}
+		if c == ':' && !quoted {
+			sep = i
+			break
+		}
+	}
+	if sep < 0 {
+		return p, fmt.Errorf("invalid content line: %q", l)
+	}
+	p.Value = l[sep+1:]
+	parts := strings.Split(l[:sep], ";")
+	p.Name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		p.Params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+	}
+	return p, nil
+}
+
+var (
+	escaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`)
+	unescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+func escape(s string) string {
+	return escaper.Replace(s)
+}
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
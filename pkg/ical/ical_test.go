@@ -0,0 +1,227 @@
+package ical
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// parseFile parses the calendar in testdata, floating times are in UTC
+func parseFile(t *testing.T, name string) []Event {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	events, err := Parse(f, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+func TestParse(t *testing.T) {
+	events := parseFile(t, "schedule.ics")
+	if len(events) != 5 {
+		t.Fatalf("%d events, want 5", len(events))
+	}
+	e := events[0]
+	if e.UID != "201701@pflab.ch" || e.Summary != "Buzzer, a pitch timer" || e.Description != "Marc" || e.Location != "PFLab" {
+		t.Errorf("event %+v", e)
+	}
+	if want := time.Date(2017, 1, 10, 16, 30, 0, 0, time.UTC); !e.Start.Equal(want) {
+		t.Errorf("start %s, want %s", e.Start, want)
+	}
+	if want := time.Date(2017, 1, 2, 8, 0, 0, 0, time.UTC); e.Sequence != 2 || !e.Modified().Equal(want) {
+		t.Errorf("sequence %d, modified %s", e.Sequence, e.Modified())
+	}
+	if organizer := e.Field("organizer"); organizer != "Sauter, Marc" {
+		t.Errorf("organizer %q", organizer)
+	}
+
+	e = events[1]
+	if want := "This description is long enough to be folded into more than one line by the calendar application; it is unfolded again."; e.Description != want {
+		t.Errorf("description %q, want %q", e.Description, want)
+	}
+	if e.RRule != "FREQ=WEEKLY;BYDAY=TH;COUNT=6" || len(e.ExDates) != 1 || !e.ExDates[0].Equal(time.Date(2017, 1, 19, 17, 30, 0, 0, time.UTC)) {
+		t.Errorf("recurrence %q, excepted %v", e.RRule, e.ExDates)
+	}
+	if e.ID() != e.UID {
+		t.Errorf("ID %s of recurring event", e.ID())
+	}
+
+	e = events[2]
+	if want := time.Date(2017, 1, 26, 17, 30, 0, 0, time.UTC); !e.RecurrenceID.Equal(want) {
+		t.Errorf("recurrence id %s, want %s", e.RecurrenceID, want)
+	}
+	if e.ID() != "weekly@pflab.ch-20170126T173000Z" {
+		t.Errorf("ID %s", e.ID())
+	}
+
+	if events[3].Status != "CANCELLED" {
+		t.Errorf("status %q", events[3].Status)
+	}
+	if want := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC); !events[4].Start.Equal(want) {
+		t.Errorf("floating start %s, want %s", events[4].Start, want)
+	}
+}
+
+func TestParseUnterminated(t *testing.T) {
+	if _, err := Parse(strings.NewReader("BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\n"), time.UTC); err == nil {
+		t.Error("unterminated event accepted")
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	events := parseFile(t, "schedule.ics")
+	events = append(events, Event{
+		UID:         "long@pflab.ch",
+		Summary:     strings.Repeat("Zürcher Grüezi-Pitch; ", 8),
+		Description: "Jane, Marc\nand Anna",
+		Start:       time.Date(2017, 4, 4, 16, 0, 0, 0, time.UTC),
+		Stamp:       time.Date(2017, 1, 1, 12, 0, 0, 0, time.UTC),
+	})
+	buf := &bytes.Buffer{}
+	if _, err := (&Calendar{ProdID: "-//test//EN", Name: "Pitches", Events: events}).WriteTo(buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+		if len(l) > maxLineLength {
+			t.Errorf("line of %d octets: %q", len(l), l)
+		}
+	}
+	parsed, err := Parse(buf, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(events) {
+		t.Fatalf("%d events, want %d", len(parsed), len(events))
+	}
+	for i, e := range events {
+		p := parsed[i]
+		if p.ID() != e.ID() || p.Summary != e.Summary || p.Description != e.Description || p.Location != e.Location ||
+			p.Status != e.Status || p.Sequence != e.Sequence || p.RRule != e.RRule {
+			t.Errorf("event %s: got %+v, want %+v", e.ID(), p, e)
+		}
+		if !p.Start.Equal(e.Start) || !p.Modified().Equal(e.Modified()) || !p.RecurrenceID.Equal(e.RecurrenceID) {
+			t.Errorf("event %s: times %s %s %s, want %s %s %s", e.ID(), p.Start, p.Modified(), p.RecurrenceID, e.Start, e.Modified(), e.RecurrenceID)
+		}
+		if len(p.ExDates) != len(e.ExDates) {
+			t.Errorf("event %s: excepted %v, want %v", e.ID(), p.ExDates, e.ExDates)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	for _, l := range []string{
+		"SUMMARY:short",
+		"SUMMARY:" + strings.Repeat("a", maxLineLength-len("SUMMARY:")),
+		"SUMMARY:" + strings.Repeat("a", maxLineLength-len("SUMMARY:")+1),
+		"SUMMARY:" + strings.Repeat("a", 300),
+		"SUMMARY:" + strings.Repeat("ü", 100),
+		"SUMMARY:" + strings.Repeat("€😀", 40),
+	} {
+		buf := &bytes.Buffer{}
+		fold(buf, l)
+		folded := strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n")
+		for i, f := range folded {
+			if len(f) > maxLineLength {
+				t.Errorf("line %d of %d octets: %q", i, len(f), f)
+			}
+			if i > 0 && !strings.HasPrefix(f, " ") {
+				t.Errorf("continuation line %d without space: %q", i, f)
+			}
+		}
+		lines, err := unfold(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != 1 || lines[0] != l {
+			t.Errorf("unfolded %q, want %q", lines, l)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	events := parseFile(t, "schedule.ics")
+	tests := []struct {
+		name     string
+		from, to time.Time
+		want     []string
+	}{
+		{
+			name: "all",
+			from: time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC),
+			want: []string{
+				"201701@pflab.ch",
+				"weekly@pflab.ch-20170105T173000Z",
+				"weekly@pflab.ch-20170112T173000Z",
+				"weekly@pflab.ch-20170202T173000Z",
+				"weekly@pflab.ch-20170209T173000Z",
+				"weekly@pflab.ch-20170126T173000Z",
+				"cancelled@pflab.ch",
+				"floating@pflab.ch",
+			},
+		},
+		{
+			name: "window",
+			from: time.Date(2017, 1, 20, 0, 0, 0, 0, time.UTC),
+			to:   time.Date(2017, 2, 5, 0, 0, 0, 0, time.UTC),
+			want: []string{
+				"201701@pflab.ch",
+				"weekly@pflab.ch-20170202T173000Z",
+				"weekly@pflab.ch-20170126T173000Z",
+				"cancelled@pflab.ch",
+				"floating@pflab.ch",
+			},
+		},
+	}
+	for _, tt := range tests {
+		expanded, err := Expand(events, tt.from, tt.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids := []string{}
+		for _, e := range expanded {
+			ids = append(ids, e.ID())
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.name, ids, tt.want)
+		}
+	}
+
+	// the instances keep the time of day across the daylight saving time change on 2017-03-26
+	weekly := events[1]
+	weekly.RRule = "FREQ=WEEKLY;BYDAY=TH"
+	expanded, err := Expand([]Event{weekly}, time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2017, 5, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expanded) != 9 {
+		t.Errorf("%d instances, want 9", len(expanded))
+	}
+	for _, e := range expanded {
+		if e.Start.Hour() != 18 || e.Start.Minute() != 30 || len(e.RRule) > 0 || !e.Start.Equal(e.RecurrenceID) {
+			t.Errorf("instance %s at %s", e.ID(), e.Start)
+		}
+	}
+}
+
+func TestExpandNotSupported(t *testing.T) {
+	events := []Event{
+		{UID: "monthly", Start: time.Date(2017, 1, 5, 17, 30, 0, 0, time.UTC), RRule: "FREQ=MONTHLY"},
+		{UID: "single", Start: time.Date(2017, 1, 5, 17, 30, 0, 0, time.UTC)},
+	}
+	expanded, err := Expand(events, time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC))
+	if err == nil || !strings.Contains(err.Error(), "monthly") {
+		t.Errorf("error %v, want the monthly event", err)
+	}
+	if len(expanded) != 1 || expanded[0].UID != "single" {
+		t.Errorf("expanded %+v", expanded)
+	}
+}
@@ -0,0 +1,197 @@
+package ical
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// weekdays of BYDAY
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+// Recurrence represents the subset of a RRULE needed for pitch slots
+// e.g. FREQ=WEEKLY;BYDAY=TH or FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;UNTIL=20171221T000000Z
+type Recurrence struct {
+	// Freq is DAILY or WEEKLY
+	Freq string
+	// Interval between the days or weeks, default 1
+	Interval int
+	// ByDay are the weekdays of a weekly recurrence, default the weekday of the start
+	ByDay []time.Weekday
+	// Count is the maximal number of occurrences, 0 for no limit
+	Count int
+	// Until is the last possible occurrence, zero for no limit
+	Until time.Time
+}
+
+// ParseRecurrence parses the value of a RRULE, the parts FREQ (DAILY, WEEKLY), INTERVAL, BYDAY, COUNT and UNTIL are supported
+func ParseRecurrence(rule string) (Recurrence, error) {
+	r := Recurrence{Interval: 1}
+	for _, part := range strings.Split(strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:"), ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return r, fmt.Errorf("rrule: %q is not valid", part)
+		}
+		name, value := strings.ToUpper(kv[0]), strings.ToUpper(kv[1])
+		switch name {
+		case "FREQ":
+			if value != "DAILY" && value != "WEEKLY" {
+				return r, fmt.Errorf("rrule: FREQ=%s not supported (DAILY, WEEKLY)", value)
+			}
+			r.Freq = value
+		case "INTERVAL":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("rrule: INTERVAL=%s is not valid", value)
+			}
+			r.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return r, fmt.Errorf("rrule: COUNT=%s is not valid", value)
+			}
+			r.Count = n
+		case "UNTIL":
+			p := Property{Name: name, Params: map[string]string{}, Value: value}
+			t, err := p.Time(time.UTC)
+			if err != nil {
+				return r, fmt.Errorf("rrule: UNTIL=%s is not valid", value)
+			}
+			r.Until = t
+		case "BYDAY":
+			for _, d := range strings.Split(value, ",") {
+				wd, ok := weekdays[d]
+				if !ok {
+					return r, fmt.Errorf("rrule: BYDAY=%s not supported (SU, MO, TU, WE, TH, FR, SA)", d)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "WKST":
+			// weeks start on monday
+		default:
+			return r, fmt.Errorf("rrule: %s not supported", name)
+		}
+	}
+	if len(r.Freq) == 0 {
+		return r, fmt.Errorf("rrule: FREQ missing")
+	}
+	return r, nil
+}
+
+// String returns the recurrence as value of a RRULE
+func (r Recurrence) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := []string{}
+		for _, wd := range r.ByDay {
+			days = append(days, strings.ToUpper(wd.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format(dateTimeUTCFormat))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Between returns the occurrences of a recurrence starting at start within [from, to)
+// the occurrences keep the time of day of start in its location across daylight saving time changes
+func (r Recurrence) Between(start, from, to time.Time) []time.Time {
+	interval := r.Interval
+	if interval < 1 {
+		interval = 1
+	}
+	byDay := make(map[time.Weekday]bool)
+	for _, wd := range r.ByDay {
+		byDay[wd] = true
+	}
+	if len(byDay) == 0 {
+		byDay[start.Weekday()] = true
+	}
+	// monday of the week of start
+	monday := (int(start.Weekday()) + 6) % 7
+	occurrences := []time.Time{}
+	count := 0
+	for day := 0; ; day++ {
+		t := time.Date(start.Year(), start.Month(), start.Day()+day, start.Hour(), start.Minute(), start.Second(), 0, start.Location())
+		if !t.Before(to) || (!r.Until.IsZero() && t.After(r.Until)) {
+			break
+		}
+		switch r.Freq {
+		case "DAILY":
+			if day%interval != 0 {
+				continue
+			}
+		default:
+			if !byDay[t.Weekday()] || ((day+monday)/7)%interval != 0 {
+				continue
+			}
+		}
+		if count++; r.Count > 0 && count > r.Count {
+			break
+		}
+		if !t.Before(from) {
+			occurrences = append(occurrences, t)
+		}
+	}
+	return occurrences
+}
+
+// Expand returns the events with the recurring events replaced by their instances within [from, to):
+// an instance gets its original start as RECURRENCE-ID, the excepted dates (EXDATE) are left out
+// and an event with the same UID and RECURRENCE-ID overrides the instance
+// other events are returned whatever their start, a recurring event with a rule not supported
+// (see ParseRecurrence) is left out and reported in the error, the other events are returned anyway
+func Expand(events []Event, from, to time.Time) ([]Event, error) {
+	overridden := make(map[string]bool)
+	for _, e := range events {
+		if !e.RecurrenceID.IsZero() {
+			overridden[e.ID()] = true
+		}
+	}
+	expanded := []Event{}
+	errs := []string{}
+	for _, e := range events {
+		if len(e.RRule) == 0 || !e.RecurrenceID.IsZero() {
+			expanded = append(expanded, e)
+			continue
+		}
+		r, err := ParseRecurrence(e.RRule)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %s", e.UID, err))
+			continue
+		}
+		except := make(map[int64]bool)
+		for _, d := range e.ExDates {
+			except[d.Unix()] = true
+		}
+		for _, t := range r.Between(e.Start, from, to) {
+			instance := e
+			instance.Start, instance.RecurrenceID = t, t
+			instance.RRule, instance.ExDates = "", nil
+			if except[t.Unix()] || overridden[instance.ID()] {
+				continue
+			}
+			expanded = append(expanded, instance)
+		}
+	}
+	if len(errs) > 0 {
+		return expanded, fmt.Errorf("recurring events not supported: %s", strings.Join(errs, "; "))
+	}
+	return expanded, nil
+}
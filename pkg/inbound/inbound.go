@@ -0,0 +1,262 @@
+package inbound
+
+// package maps the payloads pushed by external systems e.g. a booking tool to the fields of a pitch,
+// a mapping selects the values with JSONPath expressions: $.booking.start, $.items[0].name or $['first name']
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Fields contains the fields of a pitch which can be mapped, the keys of pitch.Pitch.FieldMap
+var Fields = []string{"id", "speaker", "title", "date", "timezone", "venue", "abstract"}
+
+// Mapping represents an inbound endpoint
+// Fields maps the fields of a pitch to a JSONPath expression (starting with $) or a constant e.g. the venue,
+// id is the external id, the id of the pitch is Prefix (default: <name>-) and the external id,
+// DateFormat is the layout (see time.Parse) of a date without offset, it is taken in the mapped timezone
+type Mapping struct {
+	Name       string            `yaml:"name" json:"name"`
+	Secret     string            `yaml:"secret" json:"-"`
+	Prefix     string            `yaml:"prefix" json:"prefix"`
+	Fields     map[string]string `yaml:"fields" json:"fields"`
+	DateFormat string            `yaml:"date-format" json:"date-format,omitempty"`
+	paths      map[string]path
+}
+
+// validate checks the mapping, sets the defaults and parses the paths
+func (m *Mapping) validate() error {
+	if len(m.Name) == 0 {
+		return errors.New("name missing")
+	}
+	if len(m.Secret) == 0 {
+		return fmt.Errorf("mapping %s: secret missing", m.Name)
+	}
+	if len(m.Prefix) == 0 {
+		m.Prefix = m.Name + "-"
+	}
+	for _, f := range []string{"id", "date"} {
+		if len(m.Fields[f]) == 0 {
+			return fmt.Errorf("mapping %s: field %s missing", m.Name, f)
+		}
+	}
+	m.paths = make(map[string]path)
+	for field, expr := range m.Fields {
+		known := false
+		for _, f := range Fields {
+			known = known || f == field
+		}
+		if !known {
+			return fmt.Errorf("mapping %s: no such field: %s (%s)", m.Name, field, strings.Join(Fields, ", "))
+		}
+		if !strings.HasPrefix(expr, "$") {
+			continue
+		}
+		p, err := parsePath(expr)
+		if err != nil {
+			return fmt.Errorf("mapping %s: %s: %s", m.Name, field, err)
+		}
+		m.paths[field] = p
+	}
+	return nil
+}
+
+// Load reads the mappings from a YAML file with a list of mappings
+func Load(file string) ([]*Mapping, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	mappings := []*Mapping{}
+	if err := yaml.UnmarshalStrict(data, &mappings); err != nil {
+		return nil, fmt.Errorf("%s: %s", file, err)
+	}
+	names := make(map[string]bool)
+	for _, m := range mappings {
+		if err := m.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+		if names[m.Name] {
+			return nil, fmt.Errorf("%s: mapping %s defined twice", file, m.Name)
+		}
+		names[m.Name] = true
+	}
+	return mappings, nil
+}
+
+// Values maps the JSON payload to the values of a pitch (see pitch.Bind) with the prefixed id,
+// a date without offset (see DateFormat) is taken in the mapped timezone or in fallback
+func (m *Mapping) Values(payload []byte, fallback *time.Location) (url.Values, error) {
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return nil, err
+	}
+	values := url.Values{}
+	for field := range m.Fields {
+		s, err := m.value(doc, field)
+		if err != nil {
+			return nil, err
+		}
+		if len(s) > 0 {
+			values.Set(field, s)
+		}
+	}
+	if len(values.Get("id")) == 0 {
+		return nil, errors.New("external id missing")
+	}
+	values.Set("id", m.Prefix+values.Get("id"))
+	if date := values.Get("date"); len(m.DateFormat) > 0 && len(date) > 0 {
+		loc := fallback
+		if tz := values.Get("timezone"); len(tz) > 0 {
+			var err error
+			if loc, err = time.LoadLocation(tz); err != nil {
+				return nil, fmt.Errorf("timezone: %s", err)
+			}
+		}
+		t, err := time.ParseInLocation(m.DateFormat, date, loc)
+		if err != nil {
+			return nil, fmt.Errorf("date: %s", err)
+		}
+		values.Set("date", t.Format(time.RFC3339))
+	}
+	return values, nil
+}
+
+// ID returns the prefixed id of the pitch the JSON payload is mapped to
+func (m *Mapping) ID(payload []byte) (string, error) {
+	var doc interface{}
+	if err := json.Unmarshal(payload, &doc); err != nil {
+		return "", err
+	}
+	id, err := m.value(doc, "id")
+	if err != nil {
+		return "", err
+	}
+	if len(id) == 0 {
+		return "", errors.New("external id missing")
+	}
+	return m.Prefix + id, nil
+}
+
+// value returns the value of the field selected in the document or the constant of the mapping
+func (m *Mapping) value(doc interface{}, field string) (string, error) {
+	expr := m.Fields[field]
+	p, ok := m.paths[field]
+	if !ok {
+		return expr, nil
+	}
+	v, err := p.get(doc)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %s", field, expr, err)
+	}
+	s, err := scalar(v)
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %s", field, expr, err)
+	}
+	return s, nil
+}
+
+// scalar returns a string, number or bool of a JSON document as string, null as empty string
+func scalar(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", errors.New("not a string, number or boolean")
+}
+
+// step is a member name or an array index of a path
+type step struct {
+	name  string
+	index int
+	array bool
+}
+
+// path is a parsed JSONPath expression, only member and index selectors are supported
+type path []step
+
+// parsePath parses a JSONPath expression e.g. $.a.b, $.a[0] or $['a b']
+func parsePath(expr string) (path, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("%q does not start with $", expr)
+	}
+	p := path{}
+	rest := expr[1:]
+	for len(rest) > 0 {
+		switch {
+		case rest[0] == '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end < 0 {
+				end = len(rest) - 1
+			}
+			name := rest[1 : end+1]
+			if len(name) == 0 {
+				return nil, fmt.Errorf("%q: empty member name", expr)
+			}
+			p = append(p, step{name: name})
+			rest = rest[end+1:]
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("%q: ' missing", expr)
+			}
+			p = append(p, step{name: rest[2:end]})
+			rest = rest[end+2:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("%q: ] missing", expr)
+			}
+			i, err := strconv.Atoi(rest[1:end])
+			if err != nil || i < 0 {
+				return nil, fmt.Errorf("%q: %q is not an index", expr, rest[1:end])
+			}
+			p = append(p, step{index: i, array: true})
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("%q: unexpected %q", expr, rest[0])
+		}
+	}
+	return p, nil
+}
+
+// get returns the value selected by the path, a missing member is null
+func (p path) get(doc interface{}) (interface{}, error) {
+	v := doc
+	for _, s := range p {
+		if v == nil {
+			return nil, nil
+		}
+		if s.array {
+			a, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("[%d]: not an array", s.index)
+			}
+			if s.index >= len(a) {
+				return nil, nil
+			}
+			v = a[s.index]
+			continue
+		}
+		o, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s: not an object", s.name)
+		}
+		v = o[s.name]
+	}
+	return v, nil
+}
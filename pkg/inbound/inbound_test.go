@@ -0,0 +1,184 @@
+package inbound
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// doc is a document as decoded by encoding/json
+var doc = map[string]interface{}{
+	"booking": map[string]interface{}{
+		"id":       float64(7),
+		"paid":     true,
+		"customer": map[string]interface{}{"full name": "Jane", "email": nil},
+		"items":    []interface{}{map[string]interface{}{"title": "Go"}, "Rust"},
+	},
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		expr string
+		want path
+	}{
+		{"$", path{}},
+		{"$.booking.id", path{{name: "booking"}, {name: "id"}}},
+		{"$.items[0].title", path{{name: "items"}, {index: 0, array: true}, {name: "title"}}},
+		{"$['full name'].first", path{{name: "full name"}, {name: "first"}}},
+		{"$[12]", path{{index: 12, array: true}}},
+	}
+	for _, tt := range tests {
+		p, err := parsePath(tt.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tt.expr, err)
+			continue
+		}
+		if !reflect.DeepEqual(p, tt.want) {
+			t.Errorf("%s: %+v, want %+v", tt.expr, p, tt.want)
+		}
+	}
+	for _, expr := range []string{"booking.id", "$.", "$..id", "$['id", "$[0", "$[-1]", "$[x]", "$id"} {
+		if p, err := parsePath(expr); err == nil {
+			t.Errorf("%s: %+v, want an error", expr, p)
+		}
+	}
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		{"$.booking.id", float64(7)},
+		{"$.booking.customer['full name']", "Jane"},
+		{"$.booking.items[0].title", "Go"},
+		{"$.booking.items[1]", "Rust"},
+		{"$.booking.items[2].title", nil},
+		{"$.booking.customer.email", nil},
+		{"$.booking.missing.id", nil},
+	}
+	for _, tt := range tests {
+		p, err := parsePath(tt.expr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, err := p.get(doc)
+		if err != nil || v != tt.want {
+			t.Errorf("%s: %v, %v, want %v", tt.expr, v, err, tt.want)
+		}
+	}
+	for _, expr := range []string{"$.booking.id.value", "$.booking[0]", "$.booking.items.title"} {
+		p, _ := parsePath(expr)
+		if v, err := p.get(doc); err == nil {
+			t.Errorf("%s: %v, want an error", expr, v)
+		}
+	}
+}
+
+func TestValues(t *testing.T) {
+	m := &Mapping{
+		Name:   "booking",
+		Secret: "s3cr3t",
+		Fields: map[string]string{
+			"id":       "$.booking.id",
+			"speaker":  "$.booking.customer['full name']",
+			"title":    "$.booking.items[0].title",
+			"date":     "$.booking.start",
+			"timezone": "$.booking.timezone",
+			"venue":    "pflab",
+		},
+		DateFormat: "2006-01-02 15:04",
+	}
+	if err := m.validate(); err != nil {
+		t.Fatal(err)
+	}
+	utc := time.UTC
+	tests := []struct {
+		name    string
+		payload string
+		want    map[string]string
+	}{
+		{
+			name:    "timezone",
+			payload: `{"booking": {"id": 7, "customer": {"full name": "Jane"}, "items": [{"title": "Go"}], "start": "2030-03-30 17:30", "timezone": "Europe/Zurich"}}`,
+			want:    map[string]string{"id": "booking-7", "speaker": "Jane", "title": "Go", "date": "2030-03-30T17:30:00+01:00", "timezone": "Europe/Zurich", "venue": "pflab"},
+		},
+		{
+			name:    "fallback",
+			payload: `{"booking": {"id": "x7", "customer": {"full name": null}, "start": "2030-03-30 17:30"}}`,
+			want:    map[string]string{"id": "booking-x7", "date": "2030-03-30T17:30:00Z", "venue": "pflab"},
+		},
+	}
+	for _, tt := range tests {
+		values, err := m.Values([]byte(tt.payload), utc)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(values) != len(tt.want) {
+			t.Errorf("%s: %v, want %v", tt.name, values, tt.want)
+		}
+		for field, want := range tt.want {
+			if v := values.Get(field); v != want {
+				t.Errorf("%s: %s %q, want %q", tt.name, field, v, want)
+			}
+		}
+	}
+	for _, payload := range []string{
+		`{"booking": {"start": "2030-03-30 17:30"}}`,
+		`{"booking": {"id": {"value": 7}, "start": "2030-03-30 17:30"}}`,
+		`{"booking": {"id": 7, "start": "30.3.2030 17:30"}}`,
+		`{"booking": {"id": 7, "start": "2030-03-30 17:30", "timezone": "Europe/Nowhere"}}`,
+		`{"booking": `,
+	} {
+		if values, err := m.Values([]byte(payload), utc); err == nil {
+			t.Errorf("%s: %v, want an error", payload, values)
+		}
+	}
+	if id, err := m.ID([]byte(`{"booking": {"id": 7}}`)); err != nil || id != "booking-7" {
+		t.Errorf("id %q, %v, want booking-7", id, err)
+	}
+	if id, err := m.ID([]byte(`{"booking": {}}`)); err == nil {
+		t.Errorf("id %q, want an error", id)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{"name missing", "- secret: s3cr3t\n  fields: {id: $.id, date: $.date}\n", "name missing"},
+		{"secret missing", "- name: booking\n  fields: {id: $.id, date: $.date}\n", "secret missing"},
+		{"date missing", "- name: booking\n  secret: s3cr3t\n  fields: {id: $.id}\n", "field date missing"},
+		{"unknown field", "- name: booking\n  secret: s3cr3t\n  fields: {id: $.id, date: $.date, room: $.room}\n", "no such field: room"},
+		{"path not valid", "- name: booking\n  secret: s3cr3t\n  fields: {id: '$[id]', date: $.date}\n", "is not an index"},
+		{"twice", "- {name: booking, secret: s3cr3t, fields: {id: $.id, date: $.date}}\n- {name: booking, secret: s3cr3t, fields: {id: $.id, date: $.date}}\n", "defined twice"},
+		{"unknown key", "- {name: booking, secret: s3cr3t, fields: {id: $.id, date: $.date}, format: x}\n", "format"},
+	}
+	for _, tt := range tests {
+		name := filepath.Join(t.TempDir(), "inbound.yaml")
+		if err := ioutil.WriteFile(name, []byte(tt.content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := Load(name); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: %v, want %q", tt.name, err, tt.err)
+		}
+	}
+
+	name := filepath.Join(t.TempDir(), "inbound.yaml")
+	if err := ioutil.WriteFile(name, []byte("- {name: booking, secret: s3cr3t, fields: {id: $.id, date: $.date}}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	mappings, err := Load(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings) != 1 || mappings[0].Prefix != "booking-" {
+		t.Errorf("mappings %+v, want booking with the default prefix", mappings)
+	}
+}
@@ -0,0 +1,180 @@
+package lifecycle
+
+// package runs the components of a daemon until one of them fails or a signal
+// is received and shuts them down in reverse order, each within a deadline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Exit codes
+const (
+	ExitOK       = 0
+	ExitFailure  = 1 // a component failed
+	ExitConfig   = 2 // configuration missing or not valid
+	ExitShutdown = 3 // shutdown deadline exceeded
+)
+
+// DefaultTimeout is the default shutdown deadline of a component or hook
+const DefaultTimeout = 10 * time.Second
+
+// Error attaches an exit code to an error
+type Error struct {
+	Code int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the wrapped error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCode attaches an exit code to err
+func WithCode(code int, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// ErrShutdownTimeout is returned by Run if the components did not stop within the deadline
+var ErrShutdownTimeout = WithCode(ExitShutdown, errors.New("shutdown deadline exceeded"))
+
+// ExitCode returns the exit code for err
+func ExitCode(err error) int {
+	if err == nil {
+		return ExitOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ExitFailure
+}
+
+// Exit logs err and exits the process with the appropriate exit code
+func Exit(logger *slog.Logger, err error) {
+	if err != nil {
+		logger.Error("exiting", "code", ExitCode(err), "error", err)
+	}
+	os.Exit(ExitCode(err))
+}
+
+type component struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+type hook struct {
+	name string
+	stop func(ctx context.Context) error
+}
+
+// Lifecycle represents the components of a daemon
+type Lifecycle struct {
+	timeout    time.Duration
+	logger     *slog.Logger
+	components []component
+	hooks      []hook
+}
+
+// New returns a new Lifecycle with the given shutdown deadline of each component and hook
+func New(timeout time.Duration, logger *slog.Logger) *Lifecycle {
+	return &Lifecycle{timeout: timeout, logger: logger}
+}
+
+// Go registers a component, run has to return when ctx is done,
+// components are started in order of their registration and stopped in reverse order
+func (l *Lifecycle) Go(name string, run func(ctx context.Context) error) {
+	l.components = append(l.components, component{name: name, run: run})
+}
+
+// OnStop registers a function called on shutdown after the components returned e.g. to reset outputs
+// the functions are called in reverse order of their registration, also if a deadline is exceeded
+func (l *Lifecycle) OnStop(name string, stop func(ctx context.Context) error) {
+	l.hooks = append(l.hooks, hook{name: name, stop: stop})
+}
+
+// running is a started component
+type running struct {
+	name   string
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// Run starts all components and blocks until a component fails or SIGINT or SIGTERM is received,
+// the components are stopped in reverse order of their registration, each within the shutdown deadline,
+// the first error of a component is returned
+func (l *Lifecycle) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	returned := make(chan error, len(l.components))
+	started := make([]*running, 0, len(l.components))
+	for _, c := range l.components {
+		cctx, cancel := context.WithCancel(context.Background())
+		r := &running{name: c.name, cancel: cancel, done: make(chan struct{})}
+		started = append(started, r)
+		go func(c component) {
+			defer close(r.done)
+			if err := c.run(cctx); err != nil && !errors.Is(err, context.Canceled) {
+				r.err = fmt.Errorf("%s: %w", c.name, err)
+			}
+			returned <- r.err
+		}(c)
+	}
+
+	// until a component fails, all of them returned or the signal is received
+	var err error
+	for n := 0; n < len(started) && err == nil; n++ {
+		select {
+		case <-ctx.Done():
+			l.logger.Info("signal received - exiting")
+			n = len(started)
+		case err = <-returned:
+		}
+	}
+
+	// shutdown: stop the components in reverse order, then run the hooks
+	exceeded := false
+	for i := len(started) - 1; i >= 0; i-- {
+		r := started[i]
+		r.cancel()
+		timer := time.NewTimer(l.timeout)
+		select {
+		case <-r.done:
+			if err == nil {
+				err = r.err
+			}
+		case <-timer.C:
+			l.logger.Error("stop failed", "component", r.name, "error", ErrShutdownTimeout)
+			exceeded = true
+		}
+		timer.Stop()
+	}
+	for i := len(l.hooks) - 1; i >= 0; i-- {
+		hctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+		if herr := l.hooks[i].stop(hctx); herr != nil {
+			l.logger.Error("stop failed", "component", l.hooks[i].name, "error", herr)
+		}
+		cancel()
+	}
+	if exceeded {
+		if err != nil {
+			l.logger.Error("component failed", "error", err)
+		}
+		return ErrShutdownTimeout
+	}
+	return err
+}
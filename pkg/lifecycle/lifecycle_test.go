@@ -0,0 +1,144 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logger discards the log
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// stops records the order of the stopped components and hooks
+type stops struct {
+	sync.Mutex
+	names []string
+}
+
+func (s *stops) add(name string) {
+	s.Lock()
+	defer s.Unlock()
+	s.names = append(s.names, name)
+}
+
+// component runs until ctx is done
+func (s *stops) component(name string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		<-ctx.Done()
+		s.add(name)
+		return ctx.Err()
+	}
+}
+
+// hook records the call
+func (s *stops) hook(name string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		s.add(name)
+		return nil
+	}
+}
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, ExitOK},
+		{errors.New("failed"), ExitFailure},
+		{WithCode(ExitConfig, errors.New("not valid")), ExitConfig},
+		{fmt.Errorf("server: %w", WithCode(ExitConfig, errors.New("not valid"))), ExitConfig},
+		{ErrShutdownTimeout, ExitShutdown},
+	}
+	for _, tt := range tests {
+		if code := ExitCode(tt.err); code != tt.want {
+			t.Errorf("%v: exit code %d, want %d", tt.err, code, tt.want)
+		}
+	}
+	if WithCode(ExitConfig, nil) != nil {
+		t.Error("code attached to nil")
+	}
+}
+
+func TestRunOrder(t *testing.T) {
+	s := &stops{}
+	l := New(time.Second, logger)
+	for _, name := range []string{"poller", "mqtt", "http"} {
+		l.Go(name, s.component(name))
+	}
+	l.OnStop("light", s.hook("light"))
+	l.OnStop("horn", s.hook("horn"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := l.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"http", "mqtt", "poller", "horn", "light"}; !reflect.DeepEqual(s.names, want) {
+		t.Errorf("stopped %q, want %q", s.names, want)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	s := &stops{}
+	l := New(time.Second, logger)
+	l.Go("poller", s.component("poller"))
+	l.Go("http", func(ctx context.Context) error {
+		return errors.New("address in use")
+	})
+	l.Go("mqtt", s.component("mqtt"))
+	l.OnStop("light", s.hook("light"))
+	err := l.Run(context.Background())
+	if err == nil || err.Error() != "http: address in use" || ExitCode(err) != ExitFailure {
+		t.Errorf("error %v, want the failure of http", err)
+	}
+	if want := []string{"mqtt", "poller", "light"}; !reflect.DeepEqual(s.names, want) {
+		t.Errorf("stopped %q, want %q", s.names, want)
+	}
+
+	// all components returned
+	l = New(time.Second, logger)
+	l.Go("once", func(ctx context.Context) error { return nil })
+	if err := l.Run(context.Background()); err != nil {
+		t.Errorf("error %v, want none", err)
+	}
+}
+
+func TestRunDeadline(t *testing.T) {
+	s := &stops{}
+	l := New(20*time.Millisecond, logger)
+	release := make(chan struct{})
+	defer close(release)
+	l.Go("poller", s.component("poller"))
+	// ignores ctx
+	l.Go("stuck", func(ctx context.Context) error {
+		<-release
+		return nil
+	})
+	l.Go("http", s.component("http"))
+	l.OnStop("light", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("hook without deadline")
+		}
+		s.add("light")
+		return ctx.Err()
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := l.Run(ctx)
+	if err != ErrShutdownTimeout || ExitCode(err) != ExitShutdown {
+		t.Errorf("error %v, want %v", err, ErrShutdownTimeout)
+	}
+	// the components after the stuck one are still stopped
+	if want := []string{"http", "poller", "light"}; !reflect.DeepEqual(s.names, want) {
+		t.Errorf("stopped %q, want %q", s.names, want)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("stopped after %s", d)
+	}
+}
@@ -0,0 +1,93 @@
+// Package logging sets up the structured logger of the components and carries the correlation id of requests and polls
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// Header is the HTTP header carrying the correlation id
+const Header = "X-Request-ID"
+
+// Key is the attribute of the correlation id in the log entries
+const Key = "correlation_id"
+
+// Formats of the logger
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// New returns a logger writing to w in the given format (text or json) with entries of level and above (debug, info, warn or error)
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("log level %q: %w", level, err)
+	}
+	opts := &slog.HandlerOptions{Level: l}
+	switch format {
+	case FormatText, "":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("log format %q: must be %s or %s", format, FormatText, FormatJSON)
+}
+
+// Default returns a text logger writing to stderr, used until the configuration is loaded
+func Default() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, nil))
+}
+
+// Discard returns a logger dropping all entries
+func Discard() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{Level: slog.LevelError + 1}))
+}
+
+// NewID returns a new random correlation id
+func NewID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "00000000"
+	}
+	return hex.EncodeToString(b)
+}
+
+type contextKey int
+
+const (
+	idKey contextKey = iota
+	loggerKey
+)
+
+// WithID returns a context carrying the correlation id
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, idKey, id)
+}
+
+// ID returns the correlation id of ctx, empty if there is none
+func ID(ctx context.Context) string {
+	id, _ := ctx.Value(idKey).(string)
+	return id
+}
+
+// NewContext returns a context carrying the logger e.g. of a request
+func NewContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext returns the logger of ctx or fallback with the correlation id of ctx
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return l
+	}
+	if id := ID(ctx); len(id) > 0 {
+		return fallback.With(Key, id)
+	}
+	return fallback
+}
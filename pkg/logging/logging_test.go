@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		format string
+		level  string
+		logged bool
+	}{
+		{"", "info", true},
+		{FormatText, "debug", true},
+		{FormatJSON, "warn", false},
+		{FormatJSON, "INFO", true},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		l, err := New(&b, tt.format, tt.level)
+		if err != nil {
+			t.Errorf("%s %s: %v", tt.format, tt.level, err)
+			continue
+		}
+		l.Info("polled", "pitch", "42")
+		if logged := b.Len() > 0; logged != tt.logged {
+			t.Errorf("%s %s: logged %v, want %v", tt.format, tt.level, logged, tt.logged)
+		}
+		if tt.format == FormatJSON && tt.logged && !json.Valid(b.Bytes()) {
+			t.Errorf("%s %s: %q is not JSON", tt.format, tt.level, b.String())
+		}
+	}
+	for _, tt := range []struct{ format, level string }{{"xml", "info"}, {FormatText, "verbose"}} {
+		if _, err := New(&bytes.Buffer{}, tt.format, tt.level); err == nil {
+			t.Errorf("%s %s: no error", tt.format, tt.level)
+		}
+	}
+}
+
+func TestNewID(t *testing.T) {
+	id := NewID()
+	if len(id) != 16 || strings.Trim(id, "0123456789abcdef") != "" {
+		t.Errorf("id %q, want 16 hex digits", id)
+	}
+	if NewID() == id {
+		t.Error("same id twice")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var fallback, request bytes.Buffer
+	fl, _ := New(&fallback, FormatText, "info")
+	rl, _ := New(&request, FormatText, "info")
+
+	ctx := context.Background()
+	if ID(ctx) != "" {
+		t.Errorf("id %q, want none", ID(ctx))
+	}
+	FromContext(ctx, fl).Info("polled")
+	if strings.Contains(fallback.String(), Key) {
+		t.Errorf("%q, want no correlation id", fallback.String())
+	}
+
+	fallback.Reset()
+	ctx = WithID(ctx, "c0ffee")
+	if ID(ctx) != "c0ffee" {
+		t.Errorf("id %q, want c0ffee", ID(ctx))
+	}
+	FromContext(ctx, fl).Info("polled")
+	if !strings.Contains(fallback.String(), Key+"=c0ffee") {
+		t.Errorf("%q, want the correlation id", fallback.String())
+	}
+
+	// the logger of the request is preferred
+	fallback.Reset()
+	FromContext(NewContext(ctx, rl), fl).Info("released")
+	if fallback.Len() > 0 || !strings.Contains(request.String(), "released") {
+		t.Errorf("fallback %q, request %q, want the request logger", fallback.String(), request.String())
+	}
+
+	if Discard().Enabled(ctx, slog.LevelError) {
+		t.Error("discarded logger enabled")
+	}
+}
@@ -0,0 +1,101 @@
+// Package metrics provides the Prometheus metrics of the devices and serves them on a local endpoint
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics of the devices
+var (
+	// Releases counts the pitches released by the buzzer or a release command
+	Releases = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "buzzer",
+		Name:      "releases_total",
+		Help:      "Pitches released by the buzzer or a release command.",
+	})
+	// InvalidPINs counts the invalid codes entered on the keypad
+	InvalidPINs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "buzzer",
+		Name:      "invalid_pin_attempts_total",
+		Help:      "Invalid PINs entered on the keypad.",
+	})
+	// RelayOn accumulates the time the relays are switched on
+	RelayOn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "buzzer",
+		Name:      "relay_on_seconds_total",
+		Help:      "Time the relays were switched on.",
+	}, []string{"relay"})
+	// KeypadReconnects counts the reconnects of the keypad
+	KeypadReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "buzzer",
+		Name:      "keypad_reconnects_total",
+		Help:      "Reconnects of the keypad after a read error.",
+	})
+)
+
+// registry of the device metrics, separate from the default registry
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(Releases, InvalidPINs, RelayOn, KeypadReconnects)
+}
+
+// Poller registers the metrics of the poller: the successful and failed polls and the time since the last successful poll
+func Poller(p *pitch.Poller) {
+	registry.MustRegister(
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "buzzer",
+			Name:        "polls_total",
+			Help:        "Polls of the next pitch by result.",
+			ConstLabels: prometheus.Labels{"result": "success"},
+		}, func() float64 {
+			polls, failures := p.Polls()
+			return float64(polls - failures)
+		}),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   "buzzer",
+			Name:        "polls_total",
+			Help:        "Polls of the next pitch by result.",
+			ConstLabels: prometheus.Labels{"result": "failure"},
+		}, func() float64 {
+			_, failures := p.Polls()
+			return float64(failures)
+		}),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: "buzzer",
+			Name:      "last_poll_success_age_seconds",
+			Help:      "Time since the last successful poll of the next pitch, -1 if none succeeded yet.",
+		}, func() float64 {
+			last := p.Status().LastSuccess
+			if last.IsZero() {
+				return -1
+			}
+			return time.Since(last).Seconds()
+		}),
+	)
+}
+
+// Serve serves the metrics on addr at /metrics until ctx is done
+func Serve(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	srv := &http.Server{Addr: addr, Handler: mux}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdown)
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// source is the source of a poller that is not run
+type source struct{}
+
+func (source) NextIfModified(ctx context.Context, v pitch.Version) (pitch.Pitch, pitch.Version, bool, error) {
+	return pitch.Pitch{}, v, false, nil
+}
+
+func TestPoller(t *testing.T) {
+	Poller(pitch.NewPoller(source{}, time.Minute, "", slog.New(slog.NewTextHandler(io.Discard, nil))))
+	expected := `
+# HELP buzzer_last_poll_success_age_seconds Time since the last successful poll of the next pitch, -1 if none succeeded yet.
+# TYPE buzzer_last_poll_success_age_seconds gauge
+buzzer_last_poll_success_age_seconds -1
+# HELP buzzer_polls_total Polls of the next pitch by result.
+# TYPE buzzer_polls_total counter
+buzzer_polls_total{result="failure"} 0
+buzzer_polls_total{result="success"} 0
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "buzzer_polls_total", "buzzer_last_poll_success_age_seconds"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- Serve(ctx, addr) }()
+
+	Releases.Inc()
+	RelayOn.WithLabelValues("horn").Add(1.5)
+	var body string
+	for deadline := time.Now().Add(2 * time.Second); ; {
+		resp, err := http.Get("http://" + addr + "/metrics")
+		if err == nil {
+			data, _ := ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+			body = string(data)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for _, want := range []string{"buzzer_releases_total 1", `buzzer_relay_on_seconds_total{relay="horn"} 1.5`, "buzzer_invalid_pin_attempts_total 0"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("%q missing:\n%s", want, body)
+		}
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("not shut down")
+	}
+}
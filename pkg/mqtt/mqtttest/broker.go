@@ -0,0 +1,244 @@
+package mqtttest
+
+// package provides an embedded MQTT broker for the tests of the MQTT transport, like net/http/httptest for HTTP
+
+import (
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// Broker is an MQTT 3.1.1 broker listening on a local port, it keeps the retained messages and supports
+// the wildcards + and #, QoS 1 is acknowledged but all messages are delivered with QoS 0 and no session is kept
+type Broker struct {
+	// URL of the broker e.g. tcp://127.0.0.1:41883
+	URL      string
+	users    map[string]string
+	listener net.Listener
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+	clients  map[*client]bool
+	retained map[string][]byte
+}
+
+// client is a connection to the broker
+type client struct {
+	conn          net.Conn
+	subscriptions map[string]bool
+}
+
+// NewBroker starts a broker on a local port, users maps the accepted user names to their passwords,
+// nil accepts every client, the broker has to be closed
+func NewBroker(users map[string]string) *Broker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("mqtttest: listening failed: " + err.Error())
+	}
+	b := &Broker{
+		URL:      "tcp://" + l.Addr().String(),
+		users:    users,
+		listener: l,
+		clients:  make(map[*client]bool),
+		retained: make(map[string][]byte),
+	}
+	b.wg.Add(1)
+	go b.accept()
+	return b
+}
+
+// Close stops the broker and disconnects all clients
+func (b *Broker) Close() {
+	b.listener.Close()
+	b.Disconnect()
+	b.wg.Wait()
+}
+
+// Disconnect closes the connections of all clients e.g. to test the reconnection
+func (b *Broker) Disconnect() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for c := range b.clients {
+		c.conn.Close()
+	}
+}
+
+// Retained returns the retained message of topic and true if there is one
+func (b *Broker) Retained(topic string) ([]byte, bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	data, ok := b.retained[topic]
+	return data, ok
+}
+
+// accept serves the connections until the listener is closed
+func (b *Broker) accept() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.wg.Add(1)
+		go b.serve(conn)
+	}
+}
+
+// serve handles the packets of a connection until it is closed or the client disconnects
+func (b *Broker) serve(conn net.Conn) {
+	defer b.wg.Done()
+	defer conn.Close()
+	p, err := packets.ReadPacket(conn)
+	if err != nil {
+		return
+	}
+	connect, ok := p.(*packets.ConnectPacket)
+	if !ok {
+		return
+	}
+	ack := packets.NewControlPacket(packets.Connack).(*packets.ConnackPacket)
+	ack.ReturnCode = connect.Validate()
+	if password, ok := b.users[connect.Username]; ack.ReturnCode == packets.Accepted && b.users != nil && (!ok || password != string(connect.Password)) {
+		ack.ReturnCode = packets.ErrRefusedBadUsernameOrPassword
+	}
+	c := &client{conn: conn, subscriptions: make(map[string]bool)}
+	if !b.add(c, ack) {
+		return
+	}
+	defer b.remove(c)
+	for {
+		p, err := packets.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+		switch p := p.(type) {
+		case *packets.PublishPacket:
+			if p.Qos > 1 {
+				return
+			}
+			if p.Qos == 1 {
+				ack := packets.NewControlPacket(packets.Puback).(*packets.PubackPacket)
+				ack.MessageID = p.MessageID
+				b.write(c, ack)
+			}
+			b.publish(p.TopicName, p.Payload, p.Retain)
+		case *packets.SubscribePacket:
+			b.subscribe(c, p)
+		case *packets.UnsubscribePacket:
+			b.unsubscribe(c, p)
+		case *packets.PingreqPacket:
+			b.write(c, packets.NewControlPacket(packets.Pingresp))
+		case *packets.DisconnectPacket:
+			return
+		}
+	}
+}
+
+// add acknowledges the connection and adds the client if it was accepted
+func (b *Broker) add(c *client, ack *packets.ConnackPacket) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := ack.Write(c.conn); err != nil || ack.ReturnCode != packets.Accepted {
+		return false
+	}
+	b.clients[c] = true
+	return true
+}
+
+// remove removes the client
+func (b *Broker) remove(c *client) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	delete(b.clients, c)
+}
+
+// write writes a packet to the client, a failure closes the connection
+func (b *Broker) write(c *client, p packets.ControlPacket) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if err := p.Write(c.conn); err != nil {
+		c.conn.Close()
+	}
+}
+
+// publish delivers a message to all clients subscribed to topic and keeps it if it is retained,
+// an empty retained message clears the retained message of topic
+func (b *Broker) publish(topic string, payload []byte, retain bool) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if retain && len(payload) == 0 {
+		delete(b.retained, topic)
+	} else if retain {
+		b.retained[topic] = payload
+	}
+	for c := range b.clients {
+		for filter := range c.subscriptions {
+			if Match(filter, topic) {
+				deliver(c, topic, payload, false)
+				break
+			}
+		}
+	}
+}
+
+// subscribe adds the subscriptions and delivers the matching retained messages
+func (b *Broker) subscribe(c *client, p *packets.SubscribePacket) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	ack := packets.NewControlPacket(packets.Suback).(*packets.SubackPacket)
+	ack.MessageID = p.MessageID
+	for _, filter := range p.Topics {
+		c.subscriptions[filter] = true
+		ack.ReturnCodes = append(ack.ReturnCodes, 0)
+	}
+	if err := ack.Write(c.conn); err != nil {
+		c.conn.Close()
+		return
+	}
+	for topic, payload := range b.retained {
+		for _, filter := range p.Topics {
+			if Match(filter, topic) {
+				deliver(c, topic, payload, true)
+				break
+			}
+		}
+	}
+}
+
+// unsubscribe removes the subscriptions
+func (b *Broker) unsubscribe(c *client, p *packets.UnsubscribePacket) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	for _, filter := range p.Topics {
+		delete(c.subscriptions, filter)
+	}
+	ack := packets.NewControlPacket(packets.Unsuback).(*packets.UnsubackPacket)
+	ack.MessageID = p.MessageID
+	if err := ack.Write(c.conn); err != nil {
+		c.conn.Close()
+	}
+}
+
+// deliver writes a message with QoS 0 to the client, the caller has to hold the lock
+func deliver(c *client, topic string, payload []byte, retained bool) {
+	p := packets.NewControlPacket(packets.Publish).(*packets.PublishPacket)
+	p.TopicName, p.Payload, p.Retain = topic, payload, retained
+	if err := p.Write(c.conn); err != nil {
+		c.conn.Close()
+	}
+}
+
+// Match returns true if the topic filter with the wildcards + (one level) and # (all remaining levels) matches topic
+func Match(filter, topic string) bool {
+	f, t := strings.Split(filter, "/"), strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
@@ -0,0 +1,141 @@
+package notify
+
+// package delivers the notifications of the sign-up flow to organizers and speakers,
+// the sinks are selected by a comma separated list e.g. "log,file:/var/log/buzzer/notify.json"
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/logging"
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// Events
+const (
+	// EventSignUp a speaker signed up for a slot, sent to the organizers
+	EventSignUp = "signup"
+	// EventApproved the sign-up was approved, sent to the speaker
+	EventApproved = "approved"
+	// EventRejected the sign-up was rejected, sent to the speaker
+	EventRejected = "rejected"
+	// EventWaitlisted the slot was taken, the speaker is on the waitlist
+	EventWaitlisted = "waitlisted"
+	// EventCancelled the pitch was cancelled, sent to the speaker and the organizers
+	EventCancelled = "cancelled"
+	// EventOffered the slot is offered to the speaker of the waitlist until the deadline
+	EventOffered = "offered"
+	// EventReassigned the speaker of the waitlist accepted the slot, sent to the organizers
+	EventReassigned = "reassigned"
+)
+
+// Notification represents a notification about a pitch
+type Notification struct {
+	Event string `json:"event"`
+	// Recipient is the contact of the speaker, empty for the organizers
+	Recipient string      `json:"recipient,omitempty"`
+	Pitch     pitch.Pitch `json:"pitch"`
+	Reason    string      `json:"reason,omitempty"`
+	// Deadline and Link to accept an offer
+	Deadline time.Time `json:"deadline,omitempty"`
+	Link     string    `json:"link,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Notifier delivers notifications
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// New returns the Notifier for the comma separated sinks: log, file:<path>, the log sink writes to logger
+func New(sinks string, logger *slog.Logger) (Notifier, error) {
+	m := Multi{}
+	for _, sink := range strings.Split(sinks, ",") {
+		sink = strings.TrimSpace(sink)
+		switch {
+		case len(sink) == 0:
+		case sink == "log":
+			m = append(m, Log{Logger: logger})
+		case strings.HasPrefix(sink, "file:"):
+			m = append(m, NewFile(strings.TrimPrefix(sink, "file:")))
+		default:
+			return nil, fmt.Errorf("no such notification sink: %s (log, file:<path>)", sink)
+		}
+	}
+	return m, nil
+}
+
+// Multi delivers notifications to all its notifiers
+type Multi []Notifier
+
+// Notify delivers n to all notifiers and returns the first error
+func (m Multi) Notify(ctx context.Context, n Notification) error {
+	var first error
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, n); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Log writes notifications to the log
+type Log struct {
+	Logger *slog.Logger
+}
+
+// Notify writes n to the log
+func (l Log) Notify(ctx context.Context, n Notification) error {
+	to := n.Recipient
+	if len(to) == 0 {
+		to = "organizers"
+	}
+	attrs := []interface{}{"recipient", to, "event", n.Event, "pitch", n.Pitch.ID, "title", n.Pitch.Title, "speaker", n.Pitch.Speaker, "date", n.Pitch.FormattedDate()}
+	if len(n.Reason) > 0 {
+		attrs = append(attrs, "reason", n.Reason)
+	}
+	if !n.Deadline.IsZero() {
+		attrs = append(attrs, "deadline", n.Deadline.Format(time.RFC3339))
+	}
+	if len(n.Link) > 0 {
+		attrs = append(attrs, "link", n.Link)
+	}
+	logging.FromContext(ctx, l.Logger).InfoContext(ctx, "notify", attrs...)
+	return nil
+}
+
+// File appends notifications as JSON, one per line
+type File struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// NewFile returns a new File
+func NewFile(path string) *File {
+	return &File{path: path}
+}
+
+// Notify appends n to the file
+func (f *File) Notify(ctx context.Context, n Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	out, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := out.Write(append(data, '\n')); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,100 @@
+package notify
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New("log, file:/tmp/notify.json,", nil); err != nil {
+		t.Error(err)
+	}
+	if _, err := New("log,mail", nil); err == nil || !strings.Contains(err.Error(), "mail") {
+		t.Errorf("unknown sink: %v", err)
+	}
+	if m, err := New("", nil); err != nil || len(m.(Multi)) != 0 {
+		t.Errorf("no sinks: %v %v", m, err)
+	}
+}
+
+func TestSinks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.json")
+	buf := &bytes.Buffer{}
+	n, err := New("log,file:"+path, slog.New(slog.NewTextHandler(buf, nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	date := time.Date(2017, 3, 30, 15, 30, 0, 0, time.UTC)
+	deadline := date.Add(-24 * time.Hour)
+	sent := []Notification{
+		{Event: EventSignUp, Pitch: pitch.Pitch{ID: "42", Speaker: "Jane", Title: "Go", Date: date, Contact: "jane@example.com"}},
+		{Event: EventOffered, Recipient: "anna@example.com", Pitch: pitch.Pitch{ID: "42", Speaker: "Anna", Title: "Rust", Date: date}, Deadline: deadline, Link: "https://buzzer.example.com/offers/t0k3n"},
+		{Event: EventRejected, Recipient: "jane@example.com", Pitch: pitch.Pitch{ID: "43", Speaker: "Jane", Title: "Go", Date: date}, Reason: "full"},
+	}
+	for _, no := range sent {
+		if err := n.Notify(context.Background(), no); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the log sink
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(sent) {
+		t.Fatalf("%d log lines, want %d:\n%s", len(lines), len(sent), buf)
+	}
+	for i, want := range [][]string{
+		{"recipient=organizers", "event=signup", "pitch=42", "speaker=Jane", "title=Go"},
+		{"recipient=anna@example.com", "event=offered", "deadline=2017-03-29T15:30:00Z", "link=https://buzzer.example.com/offers/t0k3n"},
+		{"recipient=jane@example.com", "event=rejected", "reason=full"},
+	} {
+		for _, w := range want {
+			if !strings.Contains(lines[i], w) {
+				t.Errorf("%q missing in %s", w, lines[i])
+			}
+		}
+	}
+
+	// the file sink
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	received := []Notification{}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		no := Notification{}
+		if err := json.Unmarshal(s.Bytes(), &no); err != nil {
+			t.Fatalf("%s: %v", s.Text(), err)
+		}
+		received = append(received, no)
+	}
+	if len(received) != len(sent) {
+		t.Fatalf("%d notifications in the file, want %d", len(received), len(sent))
+	}
+	for i, no := range received {
+		want := sent[i]
+		if no.Event != want.Event || no.Recipient != want.Recipient || no.Reason != want.Reason || no.Link != want.Link ||
+			!no.Deadline.Equal(want.Deadline) || no.Pitch.ID != want.Pitch.ID || no.Pitch.Speaker != want.Pitch.Speaker ||
+			no.Pitch.Contact != want.Pitch.Contact || !no.Pitch.Date.Equal(want.Pitch.Date) {
+			t.Errorf("notification %+v, want %+v", no, want)
+		}
+	}
+}
+
+func TestFileError(t *testing.T) {
+	f := NewFile(filepath.Join(t.TempDir(), "missing", "notify.json"))
+	if err := f.Notify(context.Background(), Notification{Event: EventSignUp}); err == nil {
+		t.Error("notification to a missing directory succeeded")
+	}
+}
@@ -0,0 +1,307 @@
+package pitch
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultUpdaterTimeout is the time an updater may take before the dispatcher continues without it
+const DefaultUpdaterTimeout = 10 * time.Second
+
+// EventType is the type of a change of the next pitch
+type EventType int
+
+// Event types
+const (
+	// EventNew a pitch became the next pitch
+	EventNew EventType = iota
+	// EventUpdated speaker or title of the next pitch changed
+	EventUpdated
+	// EventRescheduled the date of the next pitch changed
+	EventRescheduled
+	// EventCancelled the next pitch was cancelled or removed before it started, a pitch inserted before it is new only
+	EventCancelled
+	// EventEnteringWindow the next pitch is shown from now on
+	EventEnteringWindow
+	// EventStarted the date of the next pitch has passed
+	EventStarted
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventNew:
+		return "new"
+	case EventUpdated:
+		return "updated"
+	case EventRescheduled:
+		return "rescheduled"
+	case EventCancelled:
+		return "cancelled"
+	case EventEnteringWindow:
+		return "entering window"
+	case EventStarted:
+		return "started"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event describes a change of the next pitch
+type Event struct {
+	Type     EventType
+	Pitch    Pitch
+	Previous Pitch
+	Time     time.Time
+}
+
+// EventHandler is implemented by updaters interested in the events
+type EventHandler interface {
+	HandleEvent(e Event) error
+}
+
+// maxPending is the maximum number of calls pending while an updater is busy
+const maxPending = 16
+
+// updater is an Updater registered with the dispatcher
+type updater struct {
+	name string
+	Updater
+	busy    bool
+	pending []call
+}
+
+// call is a call of an updater by the dispatcher
+type call struct {
+	action string
+	f      func(u Updater) error
+}
+
+// slot returns the slot of the call, a pending call replaces the one of the same slot,
+// an update and a stop share the slot as both set what is shown, events have none
+func (c call) slot() string {
+	switch c.action {
+	case "update", "stop":
+		return "show"
+	case "status":
+		return "status"
+	}
+	return ""
+}
+
+// Dispatcher compares the next pitch with the previous one and updates any number of updaters
+// a failing or hanging updater does not affect the others
+type Dispatcher struct {
+	mutex    sync.Mutex
+	updaters []*updater
+	timeout  time.Duration
+	logger   *slog.Logger
+	display  *Display
+	current  Pitch
+	held     Pitch
+	phase    string
+	started  string
+}
+
+// NewDispatcher returns a new Dispatcher showing the pitches according to display (nil for DefaultDisplay)
+func NewDispatcher(display *Display, logger *slog.Logger) *Dispatcher {
+	if display == nil {
+		display = DefaultDisplay()
+	}
+	return &Dispatcher{
+		timeout: DefaultUpdaterTimeout,
+		logger:  logger,
+		display: display,
+	}
+}
+
+// Add registers an updater, it may implement StatusUpdater and EventHandler as well
+func (d *Dispatcher) Add(name string, u Updater) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.updaters = append(d.updaters, &updater{name: name, Updater: u})
+}
+
+// Next compares next with the previous next pitch, emits the events and updates the updaters
+// the updaters are updated if the shown pitch changed or its phase changed and stopped if nothing is shown,
+// a started pitch is shown for the hold time of the display although the server already delivers the following one
+func (d *Dispatcher) Next(next Pitch, now time.Time) {
+	d.mutex.Lock()
+	prev := d.current
+	d.current = next
+	events := []Event{}
+	event := func(t EventType, p Pitch) {
+		events = append(events, Event{Type: t, Pitch: p, Previous: prev, Time: now})
+	}
+	start := func(p Pitch) {
+		d.started = p.ID
+		d.held = p
+		event(EventStarted, p)
+	}
+	changed := false
+	switch {
+	case prev.ID != next.ID:
+		changed = true
+		// the server delivers the earliest pitch that is not cancelled, if the following one is not earlier
+		// the previous pitch was cancelled or removed, otherwise a pitch was inserted before it
+		switch {
+		case len(prev.ID) == 0:
+		case !prev.Date.After(now):
+			if d.started != prev.ID {
+				start(prev)
+			}
+		case prev.Status == StatusCancelled || len(next.ID) == 0 || !next.Date.Before(prev.Date):
+			event(EventCancelled, prev)
+		}
+		if len(next.ID) > 0 {
+			event(EventNew, next)
+		}
+	case !prev.Date.Equal(next.Date):
+		changed = true
+		event(EventRescheduled, next)
+	case prev.Speaker != next.Speaker || prev.Title != next.Title:
+		changed = true
+		event(EventUpdated, next)
+	}
+	if len(next.ID) > 0 && !next.Date.After(now) && d.started != next.ID {
+		start(next)
+	}
+	// the started pitch is held until the hold time passed
+	shown := next
+	if d.display.Phase(d.held, now) == PhaseRunning {
+		shown = d.held
+	}
+	phase := d.display.Phase(shown, now)
+	if phase != PhaseIdle && (d.phase == PhaseIdle || len(d.phase) == 0) && shown.ID == next.ID {
+		event(EventEnteringWindow, next)
+	}
+	previous := d.phase
+	d.phase = phase
+	d.mutex.Unlock()
+
+	for _, e := range events {
+		e := e
+		d.logger.Info("pitch event", "pitch", e.Pitch.ID, "event", e.Type.String())
+		d.each("event", isEventHandler, func(u Updater) error {
+			return u.(EventHandler).HandleEvent(e)
+		})
+	}
+	switch {
+	case d.display.Shows(phase) && (changed || phase != previous):
+		m := d.display.NewMessage(shown)
+		d.each("update", nil, func(u Updater) error {
+			return u.Update(m)
+		})
+	case !d.display.Shows(phase) && (d.display.Shows(previous) || len(previous) == 0):
+		d.each("stop", nil, func(u Updater) error {
+			return u.Stop()
+		})
+	}
+}
+
+// UpdateStatus passes the health of the poller to the updaters implementing StatusUpdater
+func (d *Dispatcher) UpdateStatus(s Status) error {
+	d.each("status", isStatusUpdater, func(u Updater) error {
+		return u.(StatusUpdater).UpdateStatus(s)
+	})
+	return nil
+}
+
+func isEventHandler(u Updater) bool {
+	_, ok := u.(EventHandler)
+	return ok
+}
+
+func isStatusUpdater(u Updater) bool {
+	_, ok := u.(StatusUpdater)
+	return ok
+}
+
+// each calls f for the updaters selected by want (nil for all) concurrently and waits at most the timeout
+// errors and panics are logged with the name of the updater, the call of an updater still busy is pending
+// until the updater returns (see pend)
+func (d *Dispatcher) each(action string, want func(u Updater) bool, f func(u Updater) error) {
+	d.mutex.Lock()
+	updaters := []*updater{}
+	for _, u := range d.updaters {
+		if want == nil || want(u.Updater) {
+			updaters = append(updaters, u)
+		}
+	}
+	d.mutex.Unlock()
+	c := call{action: action, f: f}
+	var wg sync.WaitGroup
+	for _, u := range updaters {
+		d.mutex.Lock()
+		if u.busy {
+			u.pending = pend(u.pending, c)
+			d.mutex.Unlock()
+			d.logger.Warn("updater still busy - call pending", "updater", u.name, "action", action)
+			continue
+		}
+		u.busy = true
+		d.mutex.Unlock()
+		wg.Add(1)
+		go d.run(u, c, wg.Done)
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(d.timeout):
+		d.logger.Error("updaters did not return in time", "action", action, "timeout", d.timeout)
+	}
+}
+
+// run calls c and then the calls pending meanwhile until none is left, done is called as soon as c returned
+func (d *Dispatcher) run(u *updater, c call, done func()) {
+	for {
+		d.call(u, c)
+		if done != nil {
+			done()
+			done = nil
+		}
+		d.mutex.Lock()
+		if len(u.pending) == 0 {
+			u.busy = false
+			d.mutex.Unlock()
+			return
+		}
+		c, u.pending = u.pending[0], u.pending[1:]
+		d.mutex.Unlock()
+	}
+}
+
+// call calls c of the updater u, errors and panics are logged
+func (d *Dispatcher) call(u *updater, c call) {
+	start := time.Now()
+	defer func() {
+		if r := recover(); r != nil {
+			d.logger.Error("updater panicked", "updater", u.name, "action", c.action, "panic", r)
+		}
+		d.logger.Debug("updater done", "updater", u.name, "action", c.action, "duration", time.Since(start))
+	}()
+	if err := c.f(u.Updater); err != nil {
+		d.logger.Error("updater failed", "updater", u.name, "action", c.action, "error", err)
+	}
+}
+
+// pend adds c to the pending calls of an updater: only the latest update or stop and the latest status are kept,
+// the events are kept in order up to maxPending
+func pend(pending []call, c call) []call {
+	if slot := c.slot(); len(slot) > 0 {
+		for i := range pending {
+			if pending[i].slot() == slot {
+				pending = append(pending[:i], pending[i+1:]...)
+				break
+			}
+		}
+	}
+	if len(pending) >= maxPending {
+		pending = pending[1:]
+	}
+	return append(pending, c)
+}
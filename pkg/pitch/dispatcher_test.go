@@ -0,0 +1,138 @@
+package pitch
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder records the calls, the first call blocks until release is closed
+type recorder struct {
+	sync.Mutex
+	calls   []string
+	release chan struct{}
+	once    sync.Once
+}
+
+func (r *recorder) record(call string) error {
+	r.once.Do(func() { <-r.release })
+	r.Lock()
+	defer r.Unlock()
+	r.calls = append(r.calls, call)
+	return nil
+}
+
+func (r *recorder) Update(data fmt.Stringer) error { return r.record("update " + data.String()) }
+func (r *recorder) Stop() error                    { return r.record("stop") }
+func (r *recorder) UpdateStatus(s Status) error    { return r.record("status " + s.Health.String()) }
+func (r *recorder) HandleEvent(e Event) error      { return r.record("event " + e.Type.String()) }
+
+// idle waits until the first updater is no longer busy
+func idle(t *testing.T, d *Dispatcher) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		d.mutex.Lock()
+		busy := d.updaters[0].busy
+		d.mutex.Unlock()
+		if !busy {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("updater still busy")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type text string
+
+func (t text) String() string { return string(t) }
+
+func TestDispatcherBusy(t *testing.T) {
+	d := NewDispatcher(nil, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d.timeout = 10 * time.Millisecond
+	r := &recorder{release: make(chan struct{})}
+	d.Add("recorder", r)
+	update := func(s string) func(u Updater) error {
+		return func(u Updater) error { return u.Update(text(s)) }
+	}
+	event := func(t EventType) func(u Updater) error {
+		return func(u Updater) error { return u.(EventHandler).HandleEvent(Event{Type: t}) }
+	}
+	status := func(h Health) func(u Updater) error {
+		return func(u Updater) error { return u.(StatusUpdater).UpdateStatus(Status{Health: h}) }
+	}
+	stop := func(u Updater) error { return u.Stop() }
+
+	// blocks until released, the following calls are pending
+	d.each("update", nil, update("1"))
+	d.each("update", nil, update("2"))
+	d.each("event", nil, event(EventNew))
+	d.each("status", nil, status(HealthStale))
+	d.each("stop", nil, stop)
+	d.each("event", nil, event(EventStarted))
+	d.each("status", nil, status(HealthOK))
+	d.each("update", nil, update("3"))
+	close(r.release)
+
+	idle(t, d)
+	want := []string{"update 1", "event new", "event started", "status " + HealthOK.String(), "update 3"}
+	if !reflect.DeepEqual(r.calls, want) {
+		t.Errorf("calls %q, want %q", r.calls, want)
+	}
+}
+
+func TestDispatcherNext(t *testing.T) {
+	now := time.Date(2030, 3, 30, 12, 0, 0, 0, time.UTC)
+	jane := Pitch{ID: "1", Speaker: "Jane", Title: "Go", Date: now.Add(3 * time.Hour)}
+	john := Pitch{ID: "2", Speaker: "John", Title: "Rust", Date: now.Add(2 * time.Hour)}
+	joe := Pitch{ID: "3", Speaker: "Joe", Title: "Zig", Date: now.Add(4 * time.Hour)}
+	tests := []struct {
+		name string
+		next Pitch
+		want []string
+	}{
+		{"first", jane, []string{"event new"}},
+		{"unchanged", jane, nil},
+		{"inserted before", john, []string{"event new"}},
+		{"removed", jane, []string{"event cancelled", "event new"}},
+		{"rescheduled", Pitch{ID: "1", Speaker: "Jane", Title: "Go", Date: now.Add(time.Hour)}, []string{"event rescheduled"}},
+		{"updated", Pitch{ID: "1", Speaker: "Jane", Title: "Go 2", Date: now.Add(time.Hour)}, []string{"event updated"}},
+		{"cancelled", joe, []string{"event cancelled", "event new"}},
+		{"none", Pitch{}, []string{"event cancelled"}},
+	}
+	d := NewDispatcher(DefaultDisplay(), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	r := &recorder{release: make(chan struct{})}
+	close(r.release)
+	d.Add("recorder", r)
+	for _, tt := range tests {
+		r.calls = nil
+		d.Next(tt.next, now)
+		idle(t, d)
+		events := []string{}
+		for _, c := range r.calls {
+			if strings.HasPrefix(c, "event ") {
+				events = append(events, c)
+			}
+		}
+		if len(events) != len(tt.want) || (len(events) > 0 && !reflect.DeepEqual(events, tt.want)) {
+			t.Errorf("%s: events %q, want %q", tt.name, events, tt.want)
+		}
+	}
+}
+
+func TestPendMax(t *testing.T) {
+	pending := []call{}
+	for i := 0; i < maxPending+5; i++ {
+		pending = pend(pending, call{action: fmt.Sprint(i)})
+	}
+	if len(pending) != maxPending || pending[0].action != "5" {
+		t.Errorf("%d pending, first %s", len(pending), pending[0].action)
+	}
+}
@@ -0,0 +1,209 @@
+package pitch
+
+import (
+	"bytes"
+	"fmt"
+	"text/template"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/i18n"
+)
+
+// Phases of the display
+const (
+	// PhaseIdle no pitch within the lead time
+	PhaseIdle = "idle"
+	// PhaseUpcoming the pitch starts within the lead time
+	PhaseUpcoming = "upcoming"
+	// PhaseStarting the pitch starts within a minute
+	PhaseStarting = "starting"
+	// PhaseRunning the pitch started within the hold time
+	PhaseRunning = "running"
+)
+
+// TemplateOpen is the name of the template shown for an open slot (see Pitch.Open) instead of upcoming and starting
+const TemplateOpen = "open"
+
+// Default display rules
+const (
+	DefaultLead     = 30 * time.Minute
+	DefaultStarting = time.Minute
+)
+
+// Display describes when and what a device shows
+type Display struct {
+	// Lead is the time before the start a pitch is shown
+	Lead time.Duration
+	// Hold is the time after the start a pitch is still shown
+	Hold time.Duration
+	// Starting is the time before the start the pitch is starting now
+	Starting  time.Duration
+	locale    *i18n.Locale
+	templates *template.Template
+}
+
+// MessageData is passed to the templates
+type MessageData struct {
+	Pitch
+	Phase string
+	// Date in the timezone of the pitch or the locale
+	Date time.Time
+	// Minutes until the start
+	Minutes int
+	// MinutesSince the start
+	MinutesSince int
+	Now          time.Time
+}
+
+// NewDisplay returns a new Display with the templates for the phases and the locale (nil for i18n.Default),
+// a missing or empty template is replaced by the message of the locale, nothing is shown in the idle phase by default,
+// templates may also contain the template for open slots (TemplateOpen)
+// the templates may use the functions minutes, hours, duration, time, date and t (see i18n.Locale)
+func NewDisplay(lead, hold time.Duration, templates map[string]string, locale *i18n.Locale) (*Display, error) {
+	if locale == nil {
+		locale = i18n.Default()
+	}
+	d := &Display{
+		Lead:      lead,
+		Hold:      hold,
+		Starting:  DefaultStarting,
+		locale:    locale,
+		templates: template.New("display").Funcs(funcs(locale)),
+	}
+	messages := map[string]string{
+		PhaseIdle:     "",
+		PhaseUpcoming: locale.T("message.upcoming"),
+		PhaseStarting: locale.T("message.starting"),
+		PhaseRunning:  locale.T("message.running"),
+		TemplateOpen:  locale.T("message.open"),
+	}
+	for phase, text := range templates {
+		if _, ok := messages[phase]; !ok {
+			return nil, fmt.Errorf("no such phase: %s", phase)
+		}
+		if len(text) > 0 {
+			messages[phase] = text
+		}
+	}
+	for phase, text := range messages {
+		if _, err := d.templates.New(phase).Parse(text); err != nil {
+			return nil, fmt.Errorf("template %s: %s", phase, err)
+		}
+	}
+	return d, nil
+}
+
+// funcs returns the template functions formatting in locale
+func funcs(locale *i18n.Locale) template.FuncMap {
+	return template.FuncMap{
+		"minutes":  locale.Minutes,
+		"hours":    locale.Hours,
+		"duration": locale.Duration,
+		"time":     locale.Time,
+		"date":     locale.Date,
+		"t":        locale.T,
+	}
+}
+
+// DefaultDisplay shows the pitch 30 minutes before the start until the start in the default locale
+func DefaultDisplay() *Display {
+	d, _ := NewDisplay(DefaultLead, 0, nil, nil)
+	return d
+}
+
+// Locale returns the locale of the display
+func (d *Display) Locale() *i18n.Locale {
+	return d.locale
+}
+
+// Phase returns the phase of p at now, an open slot is not running
+func (d *Display) Phase(p Pitch, now time.Time) string {
+	if len(p.ID) == 0 {
+		return PhaseIdle
+	}
+	until := p.Date.Sub(now)
+	switch {
+	case until > d.Lead:
+		return PhaseIdle
+	case until > d.Starting:
+		return PhaseUpcoming
+	case until > 0:
+		return PhaseStarting
+	case -until < d.Hold && !p.Open():
+		return PhaseRunning
+	}
+	return PhaseIdle
+}
+
+// Shows returns true if something is shown in phase
+func (d *Display) Shows(phase string) bool {
+	t := d.templates.Lookup(phase)
+	return t != nil && t.Tree != nil && t.Tree.Root != nil && len(t.Tree.Root.Nodes) > 0
+}
+
+// Render renders the template of the phase of p at now
+func (d *Display) Render(p Pitch, now time.Time) (string, error) {
+	return d.render(d.Phase(p, now), p, now)
+}
+
+// render renders the template of phase or of an open slot
+func (d *Display) render(phase string, p Pitch, now time.Time) (string, error) {
+	name := phase
+	if p.Open() && (phase == PhaseUpcoming || phase == PhaseStarting) {
+		name = TemplateOpen
+	}
+	if !d.Shows(name) {
+		return "", nil
+	}
+	if phase == PhaseIdle {
+		p = Pitch{}
+	}
+	// times are shown in the timezone of the pitch if it has one
+	loc := p.Location(d.locale.Location)
+	templates := d.templates
+	if loc.String() != d.locale.Location.String() {
+		var err error
+		if templates, err = d.templates.Clone(); err != nil {
+			return "", err
+		}
+		templates.Funcs(funcs(d.locale.In(loc)))
+	}
+	data := MessageData{
+		Pitch:        p,
+		Phase:        phase,
+		Date:         p.Date.In(loc),
+		Minutes:      int(p.Date.Sub(now).Minutes()),
+		MinutesSince: int(now.Sub(p.Date).Minutes()),
+		Now:          now.In(loc),
+	}
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Message is a pitch rendered by the template of its current phase
+type Message struct {
+	Pitch
+	display *Display
+}
+
+// NewMessage returns a new Message
+func (d *Display) NewMessage(p Pitch) *Message {
+	return &Message{Pitch: p, display: d}
+}
+
+// Phase returns the current phase
+func (m *Message) Phase() string {
+	return m.display.Phase(m.Pitch, time.Now())
+}
+
+// Message has to fullfill the Stringer interface - see also Updater interface
+func (m *Message) String() string {
+	text, err := m.display.Render(m.Pitch, time.Now())
+	if err != nil {
+		return err.Error()
+	}
+	return text
+}
@@ -1,13 +1,15 @@
 package pitch
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/marcsauter/buzzer/pkg/i18n"
 	"github.com/mholt/binding"
 )
 
@@ -17,118 +19,160 @@ type Updater interface {
 	Update(data fmt.Stringer) error
 }
 
+// Version identifies the next pitch delivered by the server for conditional requests
+type Version struct {
+	ETag         string
+	LastModified string
+}
+
+// Source provides the next pitch if it was modified since the given version e.g. *client.Client
+type Source interface {
+	NextIfModified(ctx context.Context, v Version) (next Pitch, version Version, modified bool, err error)
+}
+
+// Status of a pitch
+const (
+	// StatusPending the pitch was signed up by the speaker and waits for the approval of an organizer
+	StatusPending = "pending"
+	// StatusApproved the pitch was approved, pitches without status are approved as well
+	StatusApproved = "approved"
+	// StatusRejected the sign-up was rejected
+	StatusRejected = "rejected"
+	// StatusOffered the slot is offered to a speaker of the waitlist
+	StatusOffered = "offered"
+	// StatusCancelled the pitch was cancelled, it is kept for the history
+	StatusCancelled = "cancelled"
+)
+
 // Pitch represents a pitch
+// Date is kept in UTC, Timezone is the IANA name of the timezone the pitch takes place in
+// and is used to show the date, an empty Timezone is the timezone of the server or device
+// Venue is the id of the venue, VenueName is set by the server
+// Series is the id of the series the pitch is an occurrence of
+// Status is the state of a sign-up, Contact the address of the speaker for notifications
 type Pitch struct {
 	ID           string    `json:"id"`
 	Speaker      string    `json:"speaker"`
 	Title        string    `json:"title"`
 	Date         time.Time `json:"date"`
+	Timezone     string    `json:"timezone,omitempty"`
+	Venue        string    `json:"venue,omitempty"`
+	VenueName    string    `json:"venuename,omitempty"`
+	Series       string    `json:"series,omitempty"`
+	Abstract     string    `json:"abstract,omitempty"`
+	Contact      string    `json:"contact,omitempty"`
+	Status       string    `json:"status,omitempty"`
 	RegisteredAt time.Time `json:"registeredat"`
 	Released     bool      `json:"started"`
 	ReleasedAt   time.Time `json:"startedat"`
-	pitchURL     *url.URL
-	ticker       *time.Ticker
 }
 
 // FieldMap implements the FieldMapper interface for github.com/mholt/binding
 // these are the only vital fields
 func (p *Pitch) FieldMap(r *http.Request) binding.FieldMap {
 	return binding.FieldMap{
-		&p.ID:      "id",
-		&p.Speaker: "speaker",
-		&p.Title:   "title",
-		&p.Date:    "date",
+		&p.ID:       "id",
+		&p.Speaker:  "speaker",
+		&p.Title:    "title",
+		&p.Date:     "date",
+		&p.Timezone: "timezone",
+		&p.Venue:    "venue",
+		&p.Abstract: "abstract",
+	}
+}
+
+// Bind binds the values to a new Pitch the same way a request is bound
+// with github.com/mholt/binding, the keys are the names of the FieldMap
+func Bind(values url.Values) (Pitch, error) {
+	p := Pitch{}
+	req, err := http.NewRequest("POST", "/", strings.NewReader(values.Encode()))
+	if err != nil {
+		return p, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if errs := binding.Bind(req, &p); len(errs) > 0 {
+		return p, errs
+	}
+	if len(p.ID) == 0 {
+		return p, errors.New("pitch id missing")
+	}
+	return p, p.Normalize("")
+}
+
+// Approved returns true if the pitch is shown on the devices
+func (p *Pitch) Approved() bool {
+	return len(p.Status) == 0 || p.Status == StatusApproved
+}
+
+// Location returns the timezone of the pitch, fallback if the pitch has none or it is unknown
+func (p *Pitch) Location(fallback *time.Location) *time.Location {
+	if len(p.Timezone) == 0 {
+		return fallback
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return fallback
+	}
+	return loc
+}
+
+// Normalize validates date and timezone and converts the dates to UTC,
+// timezone is set if the pitch has none (empty: timezone of the device)
+// a date with an offset other than UTC has to match the offset of the timezone at that date,
+// e.g. 2017-03-30T17:30:00+01:00 is refused for Europe/Zurich (+02:00 after the switch to summer time)
+func (p *Pitch) Normalize(timezone string) error {
+	if p.Date.IsZero() {
+		return errors.New("pitch date missing")
+	}
+	if len(p.Timezone) == 0 {
+		p.Timezone = timezone
 	}
+	if len(p.Timezone) > 0 {
+		loc, err := time.LoadLocation(p.Timezone)
+		if err != nil {
+			return fmt.Errorf("no such timezone: %s", p.Timezone)
+		}
+		// a date in UTC (Z) is an instant valid in every timezone, any other offset (+00:00 too) has to be
+		// the offset of the timezone at this instant e.g. the skipped hour of a DST switch is refused
+		_, offset := p.Date.Zone()
+		if _, want := p.Date.In(loc).Zone(); p.Date.Location() != time.UTC && offset != want {
+			return fmt.Errorf("date %s does not match the offset of %s (%s)", p.Date.Format(time.RFC3339), p.Timezone, p.Date.In(loc).Format("-07:00"))
+		}
+	}
+	p.Date = p.Date.UTC()
+	if !p.RegisteredAt.IsZero() {
+		p.RegisteredAt = p.RegisteredAt.UTC()
+	}
+	if !p.ReleasedAt.IsZero() {
+		p.ReleasedAt = p.ReleasedAt.UTC()
+	}
+	return nil
 }
 
 // FormattedDate returns the formatted Date
 // TODO: remove if buzzer-ws is no longer in use
 func (p *Pitch) FormattedDate() string {
-	// get the loc of the browser - but for now it's reasonable assumption
-	zrh, _ := time.LoadLocation("Europe/Zurich")
-	return p.Date.In(zrh).Format("02.01.2006 15:04")
+	l := i18n.Default()
+	return l.In(p.Location(l.Location)).Date(p.Date)
 }
 
 // FormattedReleasedAt returns the formatted ReleasedAt
 // TODO: remove if buzzer-ws is no longer in use
 func (p *Pitch) FormattedReleasedAt() string {
-	// get the loc of the browser - but for now it's reasonable assumption
-	zrh, _ := time.LoadLocation("Europe/Zurich")
 	if p.ReleasedAt.After(p.RegisteredAt) {
-		return p.ReleasedAt.In(zrh).Format("02.01.2006 15:04")
+		l := i18n.Default()
+		return l.In(p.Location(l.Location)).Date(p.ReleasedAt)
 	}
 	return ""
 }
 
-// NewPitch returns a new Pitch instance
-func NewPitch(u *url.URL) *Pitch {
-	return &Pitch{
-		pitchURL: u,
-	}
-}
-
 // Pitch has to fullfill the Stringer interface - see also Updater interface
 func (p *Pitch) String() string {
-
-	text := fmt.Sprintf("In %d Minuten Pitch im PFLab: %s von %s", int(time.Until(p.Date).Minutes()), p.Title, p.Speaker)
-	return text
-}
-
-// StartCheckNext start the checker for the next pitch and updates Pitch if something changes
-func (p *Pitch) StartCheckNext(interval int, out Updater) {
-	//
-	getNextPitch := func() Pitch {
-		p.pitchURL.Path = "next"
-		resp, err := http.Get(p.pitchURL.String())
-		if err != nil {
-			log.Print(err)
-			return Pitch{}
-		}
-		if resp.StatusCode != 200 {
-			log.Println(p.pitchURL.String(), resp.Status)
-			return Pitch{}
-		}
-		defer resp.Body.Close()
-		decoder := json.NewDecoder(resp.Body)
-		var p Pitch
-		if err := decoder.Decode(&p); err != nil {
-			log.Print(err)
-			return Pitch{}
-		}
-		return p
+	text, err := DefaultDisplay().render(PhaseUpcoming, *p, time.Now())
+	if err != nil {
+		return err.Error()
 	}
-	//
-	go func() {
-		p.ticker = time.NewTicker(time.Second * time.Duration(interval))
-		for {
-			next := getNextPitch()
-			
-			zrh, _ := time.LoadLocation("Europe/Zurich")
-			pitchDate := next.Date.In(zrh)
-			minutesUntilNextPitch := int(time.Until(pitchDate).Minutes());
-			
-			
-			logText := fmt.Sprintf("ID: %s, Speaker: %s, Title: %s, Date: %s", next.ID, next.Speaker, next.Title, pitchDate)
-			
-			if len(next.ID) > 0 {
-				p.ID = next.ID
-				p.Speaker = next.Speaker
-				p.Title = next.Title
-				p.Date = next.Date
-				out.Update(p)
-			}
-			
-			if len(next.ID) <= 0 || minutesUntilNextPitch > 30 || minutesUntilNextPitch <=0 {
-				out.Stop();
-			}
-			<-p.ticker.C
-		}
-	}()
-}
-
-// StopCheckNext stop the checker for the next pitch
-func (p *Pitch) StopCheckNext() {
-	p.ticker.Stop()
+	return text
 }
 
 // Pitches represents a slice of pitches
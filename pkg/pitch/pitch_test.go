@@ -0,0 +1,66 @@
+package pitch
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeDST(t *testing.T) {
+	tests := []struct {
+		name     string
+		date     string
+		timezone string
+		want     string // UTC, empty if refused
+	}{
+		// Europe/Zurich switches to CEST on 2024-03-31 at 02:00 CET, 02:00-03:00 does not exist
+		{"before spring switch", "2024-03-31T01:59:00+01:00", "Europe/Zurich", "2024-03-31T00:59:00Z"},
+		{"after spring switch", "2024-03-31T03:00:00+02:00", "Europe/Zurich", "2024-03-31T01:00:00Z"},
+		{"skipped hour CET", "2024-03-31T02:30:00+01:00", "Europe/Zurich", ""},
+		{"skipped hour CEST", "2024-03-31T02:30:00+02:00", "Europe/Zurich", ""},
+		// Europe/Zurich switches back to CET on 2024-10-27 at 03:00 CEST, 02:00-03:00 occurs twice
+		{"ambiguous hour CEST", "2024-10-27T02:30:00+02:00", "Europe/Zurich", "2024-10-27T00:30:00Z"},
+		{"ambiguous hour CET", "2024-10-27T02:30:00+01:00", "Europe/Zurich", "2024-10-27T01:30:00Z"},
+		{"before autumn switch", "2024-10-27T01:59:00+01:00", "Europe/Zurich", ""},
+		{"after autumn switch", "2024-10-27T03:00:00+02:00", "Europe/Zurich", ""},
+		{"winter offset in summer", "2024-07-01T18:00:00+01:00", "Europe/Zurich", ""},
+		{"summer offset in winter", "2024-01-15T18:00:00+02:00", "Europe/Zurich", ""},
+		{"zero offset", "2024-07-01T18:00:00+00:00", "Europe/Zurich", ""},
+		{"zero offset in London winter", "2024-01-15T18:00:00+00:00", "Europe/London", "2024-01-15T18:00:00Z"},
+		{"UTC", "2024-03-31T00:30:00Z", "Europe/Zurich", "2024-03-31T00:30:00Z"},
+		{"no timezone", "2024-03-31T02:30:00+01:00", "", "2024-03-31T01:30:00Z"},
+	}
+	for _, tt := range tests {
+		date, err := time.Parse(time.RFC3339, tt.date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := Pitch{ID: "p", Date: date, Timezone: tt.timezone}
+		err = p.Normalize("")
+		switch {
+		case len(tt.want) == 0 && err == nil:
+			t.Errorf("%s: %s in %s accepted as %s", tt.name, tt.date, tt.timezone, p.Date.Format(time.RFC3339))
+		case len(tt.want) > 0 && err != nil:
+			t.Errorf("%s: %s", tt.name, err)
+		case len(tt.want) > 0 && p.Date.Format(time.RFC3339) != tt.want:
+			t.Errorf("%s: %s, want %s", tt.name, p.Date.Format(time.RFC3339), tt.want)
+		}
+	}
+}
+
+func TestNormalizeTimezone(t *testing.T) {
+	p := Pitch{ID: "p", Date: time.Date(2024, 7, 1, 16, 0, 0, 0, time.UTC)}
+	if err := p.Normalize("Europe/Zurich"); err != nil {
+		t.Fatal(err)
+	}
+	if p.Timezone != "Europe/Zurich" {
+		t.Errorf("timezone %q, want the default", p.Timezone)
+	}
+	p = Pitch{ID: "p", Date: p.Date, Timezone: "Mars/Olympus"}
+	if err := p.Normalize(""); err == nil {
+		t.Error("unknown timezone accepted")
+	}
+	p = Pitch{ID: "p"}
+	if err := p.Normalize(""); err == nil {
+		t.Error("missing date accepted")
+	}
+}
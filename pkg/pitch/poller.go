@@ -0,0 +1,281 @@
+package pitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/logging"
+)
+
+// Defaults of the Poller
+const (
+	DefaultMaxBackoff = 10 * time.Minute
+	// DefaultOfflineAfter is the duration of failed polls after which the poller is offline
+	DefaultOfflineAfter = 15 * time.Minute
+)
+
+// Health of the poller
+type Health int
+
+// Health states
+const (
+	// HealthOK the last poll succeeded
+	HealthOK Health = iota
+	// HealthStale the last poll failed, the last known pitch is shown
+	HealthStale
+	// HealthOffline the polls failed for longer than the offline duration or no pitch is known
+	HealthOffline
+)
+
+func (h Health) String() string {
+	switch h {
+	case HealthOK:
+		return "ok"
+	case HealthStale:
+		return "stale"
+	}
+	return "offline"
+}
+
+// Status describes the health of the poller
+type Status struct {
+	Health Health
+	// Since is the time of the first failed poll if the health is not ok
+	Since time.Time
+	// LastSuccess is the time of the last successful poll
+	LastSuccess time.Time
+	Err         error
+}
+
+// StatusUpdater is implemented by outputs showing the health of the poller
+type StatusUpdater interface {
+	UpdateStatus(s Status) error
+}
+
+// Pusher is implemented by sources pushing the next pitch e.g. *mqtt.Device, the poller polls as soon as Changed receives
+type Pusher interface {
+	Changed() <-chan struct{}
+}
+
+// cached is the content of the cache file
+type cached struct {
+	Pitch   Pitch     `json:"pitch"`
+	Version Version   `json:"version"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// Poller polls the next pitch and passes it to a Dispatcher
+// the last known pitch is kept in a cache file and shown while the server is unreachable
+type Poller struct {
+	source       Source
+	interval     time.Duration
+	cache        string
+	maxBackoff   time.Duration
+	offlineAfter time.Duration
+	logger       *slog.Logger
+	now          func() time.Time
+	mutex        sync.Mutex
+	next         Pitch
+	version      Version
+	status       Status
+	polls        uint64
+	failures     uint64
+}
+
+// NewPoller returns a new Poller polling src every interval, cache is the name of the cache file (optional)
+func NewPoller(src Source, interval time.Duration, cache string, logger *slog.Logger) *Poller {
+	return &Poller{
+		source:       src,
+		interval:     interval,
+		cache:        cache,
+		maxBackoff:   DefaultMaxBackoff,
+		offlineAfter: DefaultOfflineAfter,
+		logger:       logger,
+		now:          time.Now,
+		status:       Status{Health: HealthOffline, Since: time.Now()},
+	}
+}
+
+// Status returns the health of the poller
+func (p *Poller) Status() Status {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.status
+}
+
+// Polls returns the number of polls and of failed polls
+func (p *Poller) Polls() (polls, failures uint64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.polls, p.failures
+}
+
+// Check returns an error if the poller is offline, it is the readiness of the devices
+func (p *Poller) Check() error {
+	status := p.Status()
+	if status.Health != HealthOffline {
+		return nil
+	}
+	if status.Err != nil {
+		return fmt.Errorf("offline since %s: %w", status.Since.Format(time.RFC3339), status.Err)
+	}
+	return errors.New("no pitch known")
+}
+
+// Next returns the last known next pitch
+func (p *Poller) Next() Pitch {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.next
+}
+
+// load reads the last known pitch from the cache file
+func (p *Poller) load() {
+	if len(p.cache) == 0 {
+		return
+	}
+	data, err := ioutil.ReadFile(p.cache)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			p.logger.Error("reading cache failed", "error", err)
+		}
+		return
+	}
+	c := cached{}
+	if err := json.Unmarshal(data, &c); err != nil {
+		p.logger.Error("cache not valid", "cache", p.cache, "error", err)
+		return
+	}
+	p.mutex.Lock()
+	p.next, p.version = c.Pitch, c.Version
+	p.status = Status{Health: HealthStale, Since: p.now(), LastSuccess: c.Fetched}
+	p.mutex.Unlock()
+}
+
+// save writes the last known pitch to the cache file
+func (p *Poller) save(fetched time.Time) {
+	if len(p.cache) == 0 {
+		return
+	}
+	p.mutex.Lock()
+	data, err := json.Marshal(cached{Pitch: p.next, Version: p.version, Fetched: fetched})
+	p.mutex.Unlock()
+	if err != nil {
+		p.logger.Error("writing cache failed", "cache", p.cache, "error", err)
+		return
+	}
+	// replace the cache file atomically
+	tmp, err := ioutil.TempFile(filepath.Dir(p.cache), filepath.Base(p.cache))
+	if err != nil {
+		p.logger.Error("writing cache failed", "cache", p.cache, "error", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		p.logger.Error("writing cache failed", "cache", p.cache, "error", err)
+		os.Remove(tmp.Name())
+		return
+	}
+	if err := os.Rename(tmp.Name(), p.cache); err != nil {
+		p.logger.Error("writing cache failed", "cache", p.cache, "error", err)
+		os.Remove(tmp.Name())
+	}
+}
+
+// poll fetches the next pitch and updates the status
+// it returns true if the pitch was modified and the delay until the next poll
+// every poll has its own correlation id, it is sent to the server with the request
+func (p *Poller) poll(ctx context.Context, backoff time.Duration) (bool, time.Duration) {
+	id := logging.NewID()
+	ctx = logging.WithID(ctx, id)
+	logger := p.logger.With(logging.Key, id)
+	p.mutex.Lock()
+	version := p.version
+	p.mutex.Unlock()
+	next, version, modified, err := p.source.NextIfModified(ctx, version)
+	if ctx.Err() != nil {
+		return false, 0
+	}
+	now := p.now()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.polls++
+	if err != nil {
+		p.failures++
+		if p.status.Health == HealthOK {
+			p.status.Since = now
+		}
+		p.status.Err = err
+		p.status.Health = HealthStale
+		if len(p.next.ID) == 0 || now.Sub(p.status.Since) >= p.offlineAfter {
+			p.status.Health = HealthOffline
+		}
+		// back off exponentially
+		if backoff < p.interval {
+			backoff = p.interval
+		} else if backoff *= 2; backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+		logger.Error("poll failed", "error", err, "health", p.status.Health.String(), "since", p.status.Since, "backoff", backoff)
+		return false, backoff
+	}
+	p.status = Status{Health: HealthOK, Since: now, LastSuccess: now}
+	if modified {
+		p.next, p.version = next, version
+		logger.Info("next pitch", "pitch", next.ID, "speaker", next.Speaker, "title", next.Title, "date", next.Date)
+	} else {
+		logger.Debug("next pitch not modified")
+	}
+	return modified, 0
+}
+
+// Run polls the next pitch until ctx is done and passes it to d, a Pusher is polled when it pushes a pitch
+// failed polls do not clear the outputs, the last known pitch is shown until the server is reachable again
+func (p *Poller) Run(ctx context.Context, d *Dispatcher) error {
+	p.load()
+	var pushed <-chan struct{}
+	if pusher, ok := p.source.(Pusher); ok {
+		pushed = pusher.Changed()
+	}
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	health := Health(-1)
+	var nextPoll time.Time
+	var backoff time.Duration
+	for {
+		if now := p.now(); !now.Before(nextPoll) {
+			var modified bool
+			modified, backoff = p.poll(ctx, backoff)
+			if ctx.Err() != nil {
+				return nil
+			}
+			if modified {
+				p.save(now)
+			}
+			nextPoll = now.Add(backoff)
+		}
+		if status := p.Status(); status.Health != health {
+			health = status.Health
+			d.UpdateStatus(status)
+		}
+		d.Next(p.Next(), p.now())
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		case <-pushed:
+			nextPoll = time.Time{}
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package pitch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// result is the answer of the fake source to a poll
+type result struct {
+	next     Pitch
+	version  Version
+	modified bool
+	err      error
+}
+
+// fakeSource answers the polls with the results in order
+type fakeSource struct {
+	results []result
+}
+
+func (f *fakeSource) NextIfModified(ctx context.Context, v Version) (Pitch, Version, bool, error) {
+	r := f.results[0]
+	f.results = f.results[1:]
+	return r.next, r.version, r.modified, r.err
+}
+
+// clock is a fake clock advanced by the test
+type clock struct {
+	t time.Time
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+// testPoller returns a poller polling src every minute on the fake clock c
+func testPoller(src Source, cache string, c *clock) *Poller {
+	p := NewPoller(src, time.Minute, cache, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	p.now = c.now
+	return p
+}
+
+func TestPollBackoff(t *testing.T) {
+	failed := errors.New("connection refused")
+	jane := Pitch{ID: "42", Speaker: "Jane", Title: "Go"}
+	steps := []struct {
+		name    string
+		advance time.Duration
+		result  result
+		backoff time.Duration
+		health  Health
+	}{
+		{"no pitch known", 0, result{err: failed}, time.Minute, HealthOffline},
+		{"first pitch", time.Minute, result{next: jane, version: Version{ETag: `"1"`}, modified: true}, 0, HealthOK},
+		{"first failure", time.Minute, result{err: failed}, time.Minute, HealthStale},
+		{"doubled", time.Minute, result{err: failed}, 2 * time.Minute, HealthStale},
+		{"doubled again", 2 * time.Minute, result{err: failed}, 4 * time.Minute, HealthStale},
+		{"still stale", 4 * time.Minute, result{err: failed}, 8 * time.Minute, HealthStale},
+		{"offline and capped", 8 * time.Minute, result{err: failed}, DefaultMaxBackoff, HealthOffline},
+		{"still capped", 10 * time.Minute, result{err: failed}, DefaultMaxBackoff, HealthOffline},
+		{"reachable again", 10 * time.Minute, result{}, 0, HealthOK},
+	}
+	src := &fakeSource{}
+	for _, s := range steps {
+		src.results = append(src.results, s.result)
+	}
+	c := &clock{t: time.Date(2030, 3, 30, 12, 0, 0, 0, time.UTC)}
+	p := testPoller(src, "", c)
+	var backoff time.Duration
+	var failedSince time.Time
+	for _, s := range steps {
+		c.t = c.t.Add(s.advance)
+		_, backoff = p.poll(context.Background(), backoff)
+		status := p.Status()
+		if backoff != s.backoff || status.Health != s.health {
+			t.Errorf("%s: backoff %s, health %s, want %s, %s", s.name, backoff, status.Health, s.backoff, s.health)
+		}
+		if s.result.err == nil {
+			if !status.LastSuccess.Equal(c.t) || status.Err != nil {
+				t.Errorf("%s: status %+v, want last success now", s.name, status)
+			}
+			continue
+		}
+		if s.name == "first failure" {
+			failedSince = c.t
+		}
+		if status.Err != failed || (len(p.Next().ID) > 0 && !status.Since.Equal(failedSince)) {
+			t.Errorf("%s: status %+v, want failing since %s", s.name, status, failedSince)
+		}
+	}
+	if p.Next().ID != "42" {
+		t.Errorf("next pitch %+v, want the last known 42", p.Next())
+	}
+	if polls, failures := p.Polls(); polls != 9 || failures != 7 {
+		t.Errorf("%d polls, %d failed, want 9, 7", polls, failures)
+	}
+}
+
+func TestPollerCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := filepath.Join(dir, "buzzer.cache")
+	c := &clock{t: time.Date(2030, 3, 30, 12, 0, 0, 0, time.UTC)}
+	jane := Pitch{ID: "42", Speaker: "Jane", Title: "Go", Date: time.Date(2030, 3, 30, 17, 30, 0, 0, time.UTC)}
+	p := testPoller(&fakeSource{results: []result{{next: jane, version: Version{ETag: `"1"`}, modified: true}}}, cache, c)
+	if modified, _ := p.poll(context.Background(), 0); !modified {
+		t.Fatal("not modified")
+	}
+	p.save(c.t)
+	// replaced atomically, no temporary file is left
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0].Name() != "buzzer.cache" {
+		t.Errorf("files %v, want the cache only", files)
+	}
+
+	// restored on the start, stale until the first poll
+	c.t = c.t.Add(time.Hour)
+	restored := testPoller(&fakeSource{}, cache, c)
+	restored.load()
+	status := restored.Status()
+	if next := restored.Next(); next.ID != "42" || !next.Date.Equal(jane.Date) || restored.version.ETag != `"1"` {
+		t.Errorf("restored %+v %+v, want 42", next, restored.version)
+	}
+	if status.Health != HealthStale || !status.Since.Equal(c.t) || !status.LastSuccess.Equal(c.t.Add(-time.Hour)) {
+		t.Errorf("status %+v, want stale since now", status)
+	}
+
+	// not valid or not writable
+	if err := ioutil.WriteFile(cache, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	broken := testPoller(&fakeSource{}, cache, c)
+	broken.load()
+	if broken.Status().Health != HealthOffline || len(broken.Next().ID) > 0 {
+		t.Errorf("status %+v, pitch %+v, want offline without pitch", broken.Status(), broken.Next())
+	}
+	p.cache = filepath.Join(dir, "missing", "buzzer.cache")
+	p.save(c.t)
+	if data, err := ioutil.ReadFile(cache); err != nil || string(data) != "{" {
+		t.Errorf("cache %q, %v, want unchanged", data, err)
+	}
+}
@@ -0,0 +1,122 @@
+package pitch
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/ical"
+)
+
+// ExceptFormat is the format of the dates skipped by a series
+const ExceptFormat = "2006-01-02"
+
+// Series represents a recurring pitch slot e.g. weekly on thursday 17:30 except on holidays
+// the occurrences are pitches with the id <series id>-<YYYYMMDD> and without speaker until one is assigned
+type Series struct {
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+	Venue string `json:"venue,omitempty"`
+	// Timezone of the time of day of the occurrences (IANA name)
+	Timezone string `json:"timezone,omitempty"`
+	// Start is the first occurrence
+	Start time.Time `json:"start"`
+	// RRule describes the recurrence (see ical.ParseRecurrence) e.g. FREQ=WEEKLY;BYDAY=TH
+	RRule string `json:"rrule"`
+	// Except are the dates without occurrence (YYYY-MM-DD)
+	Except []string `json:"except,omitempty"`
+}
+
+// Validate checks the series, timezone is set if the series has none
+func (s *Series) Validate(timezone string) error {
+	if len(s.ID) == 0 {
+		return errors.New("series id missing")
+	}
+	if s.Start.IsZero() {
+		return errors.New("series start missing")
+	}
+	if len(s.Timezone) == 0 {
+		s.Timezone = timezone
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("no such timezone: %s", s.Timezone)
+	}
+	if _, err := ical.ParseRecurrence(s.RRule); err != nil {
+		return err
+	}
+	for _, d := range s.Except {
+		if _, err := time.Parse(ExceptFormat, d); err != nil {
+			return fmt.Errorf("except %q is not a date (YYYY-MM-DD)", d)
+		}
+	}
+	s.Start = s.Start.UTC()
+	return nil
+}
+
+// Location returns the timezone of the series, UTC if it is unknown
+func (s *Series) Location() *time.Location {
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Occurrences returns the pitches of the series within [from, to) without the excepted dates
+func (s *Series) Occurrences(from, to time.Time) ([]Pitch, error) {
+	r, err := ical.ParseRecurrence(s.RRule)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return nil, err
+	}
+	except := make(map[string]bool)
+	for _, d := range s.Except {
+		except[d] = true
+	}
+	pitches := []Pitch{}
+	for _, t := range r.Between(s.Start.In(loc), from, to) {
+		if except[t.Format(ExceptFormat)] {
+			continue
+		}
+		pitches = append(pitches, Pitch{
+			ID:       s.OccurrenceID(t),
+			Title:    s.Title,
+			Date:     t.UTC(),
+			Timezone: s.Timezone,
+			Venue:    s.Venue,
+			Series:   s.ID,
+		})
+	}
+	return pitches, nil
+}
+
+// OccurrenceID returns the id of the occurrence at t
+func (s *Series) OccurrenceID(t time.Time) string {
+	return fmt.Sprintf("%s-%s", s.ID, t.Format("20060102"))
+}
+
+// Skip adds the date of the occurrence with the given id to the excepted dates,
+// the date of the id is used even if the occurrence was moved to another day
+func (s *Series) Skip(id string) error {
+	t, err := time.Parse("20060102", strings.TrimPrefix(id, s.ID+"-"))
+	if err != nil {
+		return fmt.Errorf("%s is not an occurrence of series %s", id, s.ID)
+	}
+	date := t.Format(ExceptFormat)
+	for _, d := range s.Except {
+		if d == date {
+			return nil
+		}
+	}
+	s.Except = append(s.Except, date)
+	return nil
+}
+
+// Open returns true if the pitch is a slot without speaker e.g. an occurrence of a series or a cancelled pitch
+func (p *Pitch) Open() bool {
+	return len(p.ID) > 0 && len(p.Speaker) == 0
+}
@@ -0,0 +1,37 @@
+package pitch
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Venue represents a room pitches take place in
+// Timezone is the timezone of the pitches in the venue without one (IANA name)
+type Venue struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Validate checks the venue, the name defaults to the id
+func (v *Venue) Validate() error {
+	if len(v.ID) == 0 {
+		return errors.New("venue id missing")
+	}
+	if len(v.Name) == 0 {
+		v.Name = v.ID
+	}
+	if len(v.Timezone) > 0 {
+		if _, err := time.LoadLocation(v.Timezone); err != nil {
+			return fmt.Errorf("no such timezone: %s", v.Timezone)
+		}
+	}
+	return nil
+}
+
+// At returns true if the pitch takes place in the venue with the given id
+// pitches without venue take place in every venue, every pitch takes place in venue ""
+func (p *Pitch) At(venue string) bool {
+	return len(venue) == 0 || len(p.Venue) == 0 || p.Venue == venue
+}
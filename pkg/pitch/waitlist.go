@@ -0,0 +1,59 @@
+package pitch
+
+import "time"
+
+// Events of the history of a pitch
+const (
+	HistorySignUp     = "signup"
+	HistoryApproved   = "approved"
+	HistoryRejected   = "rejected"
+	HistoryCancelled  = "cancelled"
+	HistoryWaitlisted = "waitlisted"
+	HistoryOffered    = "offered"
+	HistoryAccepted   = "accepted"
+	HistoryDeclined   = "declined"
+	HistoryExpired    = "expired"
+)
+
+// Events of the schedule and the devices in the history of a pitch
+const (
+	HistoryCreated     = "created"
+	HistoryRescheduled = "rescheduled"
+	HistoryReleased    = "released"
+	HistoryTimeUp      = "timeup"
+)
+
+// Candidate is a speaker on the waitlist of a slot
+type Candidate struct {
+	Speaker  string    `json:"speaker"`
+	Title    string    `json:"title"`
+	Abstract string    `json:"abstract,omitempty"`
+	Contact  string    `json:"contact"`
+	Added    time.Time `json:"added"`
+}
+
+// Offer is a slot offered to a candidate of the waitlist until the deadline
+type Offer struct {
+	Candidate
+	Token    string    `json:"token"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// HistoryEntry records an event of a pitch e.g. a change of the speaker or the release,
+// Date is the date of the pitch at the time of the event, Device the device reporting a release or time-up
+type HistoryEntry struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Date    time.Time `json:"date"`
+	Speaker string    `json:"speaker,omitempty"`
+	Title   string    `json:"title,omitempty"`
+	Reason  string    `json:"reason,omitempty"`
+	Device  string    `json:"device,omitempty"`
+}
+
+// Slot is the state of the sign-up of a pitch: history, waitlist and the current offer
+type Slot struct {
+	History  []HistoryEntry `json:"history"`
+	Waitlist []Candidate    `json:"waitlist"`
+	Offer    *Offer         `json:"offer,omitempty"`
+}
@@ -2,8 +2,13 @@ package ticker
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/tarm/serial"
 )
@@ -45,22 +50,61 @@ const (
 	eot          = "\x04"
 )
 
+// refreshInterval is the interval the text of the last update is rendered again
+const refreshInterval = time.Minute
+
 //
 type Ticker struct {
 	devName string
-	port    *serial.Port
+	logger  *slog.Logger
+	port    io.WriteCloser
 	effect  string
+	refresh time.Duration
+	mutex   sync.Mutex
+	data    fmt.Stringer
+	text    string
+	err     error
 }
 
 //
-func NewTicker(name string) (*Ticker, error) {
-	t := &Ticker{devName: name, effect: "\x61"}
+func NewTicker(name string, logger *slog.Logger) (*Ticker, error) {
+	t := &Ticker{devName: name, logger: logger, effect: "\x61", refresh: refreshInterval}
 	if err := t.open(); err != nil {
 		return nil, err
 	}
 	return t, nil
 }
 
+// Run shows the text of the last update again if it changed e.g. the minutes until the pitch
+// until ctx is done
+func (t *Ticker) Run(ctx context.Context) error {
+	ticker := time.NewTicker(t.refresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		t.mutex.Lock()
+		data, text := t.data, t.text
+		t.mutex.Unlock()
+		if data == nil || data.String() == text {
+			continue
+		}
+		if err := t.Update(data); err != nil {
+			t.logger.Error("ticker update failed", "port", t.devName, "error", err)
+		}
+	}
+}
+
+// Close closes the serial port
+func (t *Ticker) Close() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.port.Close()
+}
+
 func (t *Ticker) open() error {
 	c := &serial.Config{Name: t.devName, Baud: 9600}
 	port, err := serial.OpenPort(c)
@@ -115,6 +159,24 @@ func (t *Ticker) Start(text string) error {
 
 //
 func (t *Ticker) Stop() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.data, t.text = nil, ""
+	t.err = t.stop()
+	return t.err
+}
+
+// Check returns the error of the last write to the serial port, nil if it succeeded
+func (t *Ticker) Check() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.err != nil {
+		return fmt.Errorf("%s: %w", t.devName, t.err)
+	}
+	return nil
+}
+
+func (t *Ticker) stop() error {
 	var buf bytes.Buffer
 	buf.WriteString(packetHeader)
 	buf.WriteString(stopModifier)
@@ -130,11 +192,12 @@ func (t *Ticker) Stop() error {
 //
 func (t *Ticker) Update(data fmt.Stringer) error {
 	text := data.String()
-	if err := t.Stop(); err != nil {
-		return err
-	}
-	if err := t.Start(text); err != nil {
-		return err
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.data, t.text = data, text
+	if t.err = t.stop(); t.err != nil {
+		return t.err
 	}
-	return nil
+	t.err = t.Start(text)
+	return t.err
 }
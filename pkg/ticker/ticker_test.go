@@ -0,0 +1,155 @@
+package ticker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// port records the packets written to the serial port
+type port struct {
+	sync.Mutex
+	written strings.Builder
+	err     error
+	closed  bool
+}
+
+func (p *port) Write(b []byte) (int, error) {
+	p.Lock()
+	defer p.Unlock()
+	if p.err != nil {
+		return 0, p.err
+	}
+	return p.written.Write(b)
+}
+
+func (p *port) Close() error {
+	p.Lock()
+	defer p.Unlock()
+	p.closed = true
+	return nil
+}
+
+// packets returns and clears the packets written
+func (p *port) packets() string {
+	p.Lock()
+	defer p.Unlock()
+	s := p.written.String()
+	p.written.Reset()
+	return s
+}
+
+// text is the text of an update, it can be changed e.g. the minutes until the pitch
+type text struct {
+	sync.Mutex
+	s string
+}
+
+func (t *text) String() string {
+	t.Lock()
+	defer t.Unlock()
+	return t.s
+}
+
+func (t *text) set(s string) {
+	t.Lock()
+	defer t.Unlock()
+	t.s = s
+}
+
+// testTicker returns a ticker writing to p
+func testTicker(p *port) *Ticker {
+	return &Ticker{devName: "/dev/ttyUSB0", logger: slog.New(slog.NewTextHandler(io.Discard, nil)), port: p, effect: "\x61", refresh: refreshInterval}
+}
+
+const (
+	stopPacket  = "\x01\x5a\x30\x30\x02\x41\x41\x1b\x20\x61\x20\x04"
+	startPrefix = "\x01\x5a\x30\x30\x02\x41\x41\x1b\x20a\x20"
+)
+
+func TestUpdate(t *testing.T) {
+	p := &port{}
+	tk := testTicker(p)
+	if err := tk.Update(&text{s: "Jane: Go in 5 min"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := p.packets(), stopPacket+startPrefix+"Jane: Go in 5 min\x04"; got != want {
+		t.Errorf("packets %q, want %q", got, want)
+	}
+	if err := tk.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if got := p.packets(); got != stopPacket {
+		t.Errorf("packets %q, want the stop packet", got)
+	}
+	if tk.data != nil || len(tk.text) > 0 {
+		t.Errorf("text %q kept after the stop", tk.text)
+	}
+
+	// the error of the last write is the health of the ticker
+	p.err = errors.New("input/output error")
+	if err := tk.Update(&text{s: "Jane"}); err != p.err {
+		t.Errorf("error %v, want %v", err, p.err)
+	}
+	if err := tk.Check(); err == nil || err.Error() != "/dev/ttyUSB0: input/output error" {
+		t.Errorf("check %v, want the write error", err)
+	}
+	p.err = nil
+	if err := tk.Stop(); err != nil || tk.Check() != nil {
+		t.Errorf("error %v, check %v, want none", err, tk.Check())
+	}
+	if err := tk.Close(); err != nil || !p.closed {
+		t.Errorf("port not closed: %v", err)
+	}
+}
+
+func TestEffect(t *testing.T) {
+	tk := testTicker(&port{})
+	for name, effect := range map[string]string{"rotate": "\x61", "fixed": "\x62", "rollLeft": "\x67", "wipeDown": "\x6a"} {
+		if err := tk.Effect(name); err != nil || tk.effect != effect {
+			t.Errorf("%s: effect %q, %v, want %q", name, tk.effect, err, effect)
+		}
+	}
+	if err := tk.Effect("blink"); err == nil || err.Error() != "no such effect: blink" {
+		t.Errorf("error %v, want no such effect", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	p := &port{}
+	tk := testTicker(p)
+	tk.refresh = 5 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- tk.Run(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}()
+
+	data := &text{s: "Jane: Go in 5 min"}
+	if err := tk.Update(data); err != nil {
+		t.Fatal(err)
+	}
+	p.packets()
+	// unchanged text is not written again
+	time.Sleep(20 * time.Millisecond)
+	if got := p.packets(); len(got) > 0 {
+		t.Errorf("packets %q, want none", got)
+	}
+	data.set("Jane: Go in 4 min")
+	deadline := time.Now().Add(time.Second)
+	for got := ""; !strings.Contains(got, "Jane: Go in 4 min"); got += p.packets() {
+		if time.Now().After(deadline) {
+			t.Fatal("changed text not shown")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
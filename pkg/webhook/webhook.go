@@ -0,0 +1,458 @@
+package webhook
+
+// package delivers the lifecycle events of the pitches to outgoing webhooks e.g. of a chat,
+// the payloads are signed with HMAC-SHA256, failed deliveries are retried with backoff and every attempt is logged
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+	"gopkg.in/yaml.v2"
+)
+
+// Events
+const (
+	// EventScheduled a pitch with speaker was created, approved or taken over from the waitlist
+	EventScheduled = "scheduled"
+	// EventRescheduled the date of a scheduled pitch changed
+	EventRescheduled = "rescheduled"
+	// EventCancelled the speaker cancelled the pitch
+	EventCancelled = "cancelled"
+	// EventStarting the pitch starts within the lead time
+	EventStarting = "starting"
+	// EventReleased the pitch was released by a device
+	EventReleased = "released"
+	// EventTimeUp the time of the pitch is up
+	EventTimeUp = "timeup"
+)
+
+// Events contains all events, a hook without events subscribes to all of them
+var Events = []string{EventScheduled, EventRescheduled, EventCancelled, EventStarting, EventReleased, EventTimeUp}
+
+// Headers of a delivery, the signature is "sha256=" and the hex encoded HMAC-SHA256 of "<timestamp>.<body>" (see Sign)
+const (
+	HeaderEvent     = "X-Buzzer-Event"
+	HeaderDelivery  = "X-Buzzer-Delivery"
+	HeaderTimestamp = "X-Buzzer-Timestamp"
+	HeaderSignature = "X-Buzzer-Signature"
+)
+
+// Defaults
+const (
+	DefaultRetries = 5
+	DefaultBackoff = time.Second
+	DefaultTimeout = 10 * time.Second
+	DefaultWorkers = 4
+	maxBackoff     = 5 * time.Minute
+	queueSize      = 256
+)
+
+// redacted replaces the credentials in URLs and header values
+const redacted = "xxxxx"
+
+// Event represents a lifecycle event of a pitch, Reason is the reason of a cancellation or the previous date of a rescheduled pitch
+type Event struct {
+	ID     string      `json:"id"`
+	Event  string      `json:"event"`
+	Time   time.Time   `json:"time"`
+	Pitch  pitch.Pitch `json:"pitch"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+// Hook represents an outgoing webhook
+// Template is a text/template rendering the JSON payload from the Event (default: the Event as JSON),
+// the function json encodes a value e.g. {"text": {{json .Pitch.Title}}}
+type Hook struct {
+	Name     string            `yaml:"name" json:"name"`
+	URL      string            `yaml:"url" json:"url"`
+	Secret   string            `yaml:"secret" json:"-"`
+	Events   []string          `yaml:"events" json:"events,omitempty"`
+	Template string            `yaml:"template" json:"template,omitempty"`
+	Headers  map[string]string `yaml:"headers" json:"headers,omitempty"`
+	Retries  int               `yaml:"retries" json:"retries"`
+	tmpl     *template.Template
+}
+
+// Subscribed returns true if the hook subscribed to the event
+func (h *Hook) Subscribed(event string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload returns the payload of the event rendered by the template of the hook
+func (h *Hook) Payload(e Event) ([]byte, error) {
+	if h.tmpl == nil {
+		return json.Marshal(e)
+	}
+	var buf bytes.Buffer
+	if err := h.tmpl.Execute(&buf, e); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("hook %s: template does not render valid JSON", h.Name)
+	}
+	return buf.Bytes(), nil
+}
+
+// Redacted returns the hook as shown to the users: the URL without user, path and query (e.g. the token of a chat)
+// and the values of the headers (e.g. Authorization) are replaced
+func (h *Hook) Redacted() Hook {
+	r := *h
+	r.URL = redactURL(h.URL)
+	if len(h.Headers) > 0 {
+		r.Headers = make(map[string]string)
+		for k := range h.Headers {
+			r.Headers[k] = redacted
+		}
+	}
+	return r
+}
+
+// redactURL returns the scheme and the host of the URL, the rest is replaced
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil {
+		return redacted
+	}
+	r := url.URL{Scheme: u.Scheme, Host: u.Host}
+	if u.User != nil || len(u.Path) > 1 || len(u.RawQuery) > 0 {
+		r.Path = "/" + redacted
+	}
+	return r.String()
+}
+
+// validate checks the hook, sets the defaults and parses the template
+func (h *Hook) validate() error {
+	if len(h.Name) == 0 {
+		return errors.New("name missing")
+	}
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return fmt.Errorf("hook %s: %q is not an http(s) URL", h.Name, h.URL)
+	}
+	if len(h.Secret) == 0 {
+		return fmt.Errorf("hook %s: secret missing", h.Name)
+	}
+	for _, e := range h.Events {
+		known := false
+		for _, k := range Events {
+			known = known || e == k
+		}
+		if !known {
+			return fmt.Errorf("hook %s: no such event: %s (%s)", h.Name, e, strings.Join(Events, ", "))
+		}
+	}
+	if h.Retries <= 0 {
+		h.Retries = DefaultRetries
+	}
+	if len(h.Template) > 0 {
+		funcs := template.FuncMap{"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		}}
+		if h.tmpl, err = template.New(h.Name).Funcs(funcs).Parse(h.Template); err != nil {
+			return fmt.Errorf("hook %s: %s", h.Name, err)
+		}
+	}
+	return nil
+}
+
+// Load reads the hooks from a YAML file with a list of hooks
+func Load(path string) ([]*Hook, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	hooks := []*Hook{}
+	if err := yaml.UnmarshalStrict(data, &hooks); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	names := make(map[string]bool)
+	for _, h := range hooks {
+		if err := h.validate(); err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+		if names[h.Name] {
+			return nil, fmt.Errorf("%s: hook %s defined twice", path, h.Name)
+		}
+		names[h.Name] = true
+	}
+	return hooks, nil
+}
+
+// Sign returns the signature of a payload sent at timestamp (Unix time)
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature and the timestamp of a delivery received, the timestamp must not be older than tolerance
+func Verify(secret string, r *http.Request, body []byte, tolerance time.Duration) error {
+	timestamp, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return errors.New("timestamp missing")
+	}
+	if d := time.Since(time.Unix(timestamp, 0)); d > tolerance || d < -tolerance {
+		return errors.New("timestamp out of tolerance")
+	}
+	if !hmac.Equal([]byte(r.Header.Get(HeaderSignature)), []byte(Sign(secret, timestamp, body))) {
+		return errors.New("signature not valid")
+	}
+	return nil
+}
+
+// Delivery represents an attempt to deliver an event to a hook, Error is empty if it succeeded
+type Delivery struct {
+	ID       string        `json:"id"`
+	Hook     string        `json:"hook"`
+	Event    string        `json:"event"`
+	Pitch    string        `json:"pitch"`
+	Attempt  int           `json:"attempt"`
+	Time     time.Time     `json:"time"`
+	Status   int           `json:"status,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// job is an event to deliver to a hook
+type job struct {
+	hook  *Hook
+	event Event
+}
+
+// Dispatcher delivers the events to the subscribed hooks and appends the attempts to the delivery log (one JSON entry per line),
+// the queued events are delivered by a fixed number of workers
+type Dispatcher struct {
+	hooks   []*Hook
+	client  *http.Client
+	backoff time.Duration
+	workers int
+	queue   chan job
+	logger  *slog.Logger
+	mutex   sync.Mutex
+	log     string
+}
+
+// New returns a Dispatcher for the hooks logging the deliveries to the file log
+func New(hooks []*Hook, log string, logger *slog.Logger) *Dispatcher {
+	return &Dispatcher{
+		hooks:   hooks,
+		client:  &http.Client{Timeout: DefaultTimeout},
+		backoff: DefaultBackoff,
+		workers: DefaultWorkers,
+		queue:   make(chan job, queueSize),
+		logger:  logger,
+		log:     log,
+	}
+}
+
+// Hooks returns the hooks
+func (d *Dispatcher) Hooks() []*Hook {
+	return d.hooks
+}
+
+// Publish queues the event for the subscribed hooks, it does not block: the event is dropped if the queue is full
+func (d *Dispatcher) Publish(e Event) {
+	if len(e.ID) == 0 {
+		e.ID = newID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for _, h := range d.hooks {
+		if !h.Subscribed(e.Event) {
+			continue
+		}
+		select {
+		case d.queue <- job{hook: h, event: e}:
+		default:
+			d.logger.Error("webhook queue full - event dropped", "hook", h.Name, "event", e.Event, "pitch", e.Pitch.ID)
+		}
+	}
+}
+
+// Run delivers the queued events with the workers until ctx is done, deliveries waiting for a retry are abandoned
+// a worker retrying a delivery (see deliver) does not take further events, the others go on
+func (d *Dispatcher) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < d.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-d.queue:
+					d.deliver(ctx, j)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// deliver sends the event to the hook, failed attempts are retried with exponential backoff
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	body, err := j.hook.Payload(j.event)
+	if err != nil {
+		d.record(Delivery{ID: j.event.ID, Hook: j.hook.Name, Event: j.event.Event, Pitch: j.event.Pitch.ID, Time: time.Now(), Error: err.Error()})
+		return
+	}
+	backoff := d.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.send(ctx, j, body, attempt)
+		if err == nil || !retry || attempt > j.hook.Retries {
+			if err != nil {
+				d.logger.Error("webhook delivery failed", "hook", j.hook.Name, "event", j.event.Event, "pitch", j.event.Pitch.ID, "attempts", attempt, "error", err)
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// send posts the payload to the hook and records the attempt, retry is true if the attempt may be repeated
+// i.e. the hook was not reached or answered with 429 or 5xx
+func (d *Dispatcher) send(ctx context.Context, j job, body []byte, attempt int) (retry bool, err error) {
+	start := time.Now()
+	delivery := Delivery{ID: j.event.ID, Hook: j.hook.Name, Event: j.event.Event, Pitch: j.event.Pitch.ID, Attempt: attempt, Time: start}
+	defer func() {
+		delivery.Duration = time.Since(start)
+		if err != nil {
+			delivery.Error = err.Error()
+		}
+		d.record(delivery)
+	}()
+	req, err := http.NewRequest("POST", j.hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	for k, v := range j.hook.Headers {
+		req.Header.Set(k, v)
+	}
+	timestamp := start.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, j.event.Event)
+	req.Header.Set(HeaderDelivery, j.event.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(j.hook.Secret, timestamp, body))
+	res, err := d.client.Do(req)
+	if err != nil {
+		// the error contains the URL
+		if uerr, ok := err.(*url.Error); ok {
+			uerr.URL = redactURL(uerr.URL)
+		}
+		return true, err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1<<16))
+	delivery.Status = res.StatusCode
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, fmt.Errorf("%s responded %s", j.hook.Name, res.Status)
+}
+
+// record appends the delivery to the delivery log
+func (d *Dispatcher) record(delivery Delivery) {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		d.logger.Error("encoding webhook delivery failed", "error", err)
+		return
+	}
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	f, err := os.OpenFile(d.log, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err == nil {
+		_, err = f.Write(append(data, '\n'))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		d.logger.Error("writing webhook delivery log failed", "log", d.log, "error", err)
+	}
+}
+
+// Deliveries returns the last attempts (limit, 0: all) of the hook and the event, empty for all hooks and events
+func (d *Dispatcher) Deliveries(hook, event string, limit int) ([]Delivery, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	deliveries := []Delivery{}
+	f, err := os.Open(d.log)
+	if os.IsNotExist(err) {
+		return deliveries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(line) > 0 {
+			var delivery Delivery
+			if jerr := json.Unmarshal(line, &delivery); jerr != nil {
+				return nil, jerr
+			}
+			if (len(hook) == 0 || delivery.Hook == hook) && (len(event) == 0 || delivery.Event == event) {
+				deliveries = append(deliveries, delivery)
+				if limit > 0 && len(deliveries) > limit {
+					deliveries = deliveries[1:]
+				}
+			}
+		}
+		if err == io.EOF {
+			return deliveries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// newID returns a random id of an event
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,326 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marcsauter/buzzer/pkg/pitch"
+)
+
+// receiver is a webhook receiving the deliveries, it answers with the status codes in turn, 200 after the last one
+type receiver struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	statuses []int
+	bodies   []string
+	headers  []http.Header
+	errs     []error
+}
+
+func newReceiver(t *testing.T, secret string, statuses ...int) *receiver {
+	rcv := &receiver{statuses: statuses}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		rcv.mutex.Lock()
+		defer rcv.mutex.Unlock()
+		rcv.bodies = append(rcv.bodies, string(body))
+		rcv.headers = append(rcv.headers, r.Header)
+		rcv.errs = append(rcv.errs, Verify(secret, r, body, time.Minute))
+		status := http.StatusOK
+		if len(rcv.statuses) > 0 {
+			status, rcv.statuses = rcv.statuses[0], rcv.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+// testHook returns a validated hook
+func testHook(t *testing.T, h Hook) *Hook {
+	t.Helper()
+	if err := h.validate(); err != nil {
+		t.Fatal(err)
+	}
+	return &h
+}
+
+// run runs a dispatcher of the hooks with a short backoff until the test ends
+func run(t *testing.T, hooks ...*Hook) *Dispatcher {
+	d := New(hooks, filepath.Join(t.TempDir(), "webhooks.log"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d.backoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return d
+}
+
+// wait returns the deliveries once there are n
+func wait(t *testing.T, d *Dispatcher, n int) []Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		deliveries, err := d.Deliveries("", "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(deliveries) >= n {
+			return deliveries
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d deliveries, want %d: %+v", len(deliveries), n, deliveries)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+var testPitch = pitch.Pitch{ID: "42", Speaker: "Marc", Title: "Buzzer", Date: time.Date(2017, 3, 30, 15, 30, 0, 0, time.UTC)}
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"event":"scheduled"}`)
+	now := time.Now().Unix()
+	request := func(secret string, timestamp int64) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		r.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+		r.Header.Set(HeaderSignature, Sign(secret, timestamp, body))
+		return r
+	}
+	if err := Verify("s3cr3t", request("s3cr3t", now), body, time.Minute); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	if err := Verify("s3cr3t", request("wrong", now), body, time.Minute); err == nil {
+		t.Error("signature with the wrong secret accepted")
+	}
+	if err := Verify("s3cr3t", request("s3cr3t", now), []byte(`{"event":"cancelled"}`), time.Minute); err == nil {
+		t.Error("signature of another body accepted")
+	}
+	if err := Verify("s3cr3t", request("s3cr3t", now-120), body, time.Minute); err == nil {
+		t.Error("old timestamp accepted")
+	}
+	if err := Verify("s3cr3t", httptest.NewRequest(http.MethodPost, "/", nil), body, time.Minute); err == nil {
+		t.Error("request without signature accepted")
+	}
+	if sig := Sign("s3cr3t", 1490887800, body); !strings.HasPrefix(sig, "sha256=") || len(sig) != len("sha256=")+64 {
+		t.Errorf("signature %s", sig)
+	}
+}
+
+func TestDeliveryRetried(t *testing.T) {
+	rcv := newReceiver(t, "s3cr3t", http.StatusInternalServerError, http.StatusTooManyRequests)
+	h := testHook(t, Hook{Name: "archive", URL: rcv.URL, Secret: "s3cr3t", Headers: map[string]string{"Authorization": "Bearer abc"}})
+	d := run(t, h)
+	d.Publish(Event{Event: EventScheduled, Pitch: testPitch})
+
+	deliveries := wait(t, d, 3)
+	if len(deliveries) != 3 {
+		t.Fatalf("%d deliveries, want 3", len(deliveries))
+	}
+	for i, delivery := range deliveries {
+		if delivery.Attempt != i+1 || delivery.ID != deliveries[0].ID || delivery.Hook != "archive" || delivery.Event != EventScheduled || delivery.Pitch != "42" {
+			t.Errorf("delivery %+v", delivery)
+		}
+	}
+	if deliveries[0].Status != 500 || len(deliveries[0].Error) == 0 || deliveries[1].Status != 429 {
+		t.Errorf("failed deliveries %+v", deliveries[:2])
+	}
+	if deliveries[2].Status != 200 || len(deliveries[2].Error) > 0 {
+		t.Errorf("last delivery %+v, want succeeded", deliveries[2])
+	}
+
+	rcv.mutex.Lock()
+	defer rcv.mutex.Unlock()
+	for i, err := range rcv.errs {
+		if err != nil {
+			t.Errorf("attempt %d: %v", i+1, err)
+		}
+	}
+	header := rcv.headers[2]
+	if header.Get(HeaderEvent) != EventScheduled || header.Get(HeaderDelivery) != deliveries[0].ID || header.Get("Authorization") != "Bearer abc" {
+		t.Errorf("headers %v", header)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(rcv.bodies[2]), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != deliveries[0].ID || e.Event != EventScheduled || e.Pitch.Title != "Buzzer" {
+		t.Errorf("payload %+v", e)
+	}
+}
+
+func TestDeliveryNotRetried(t *testing.T) {
+	rcv := newReceiver(t, "s3cr3t", http.StatusBadRequest)
+	d := run(t, testHook(t, Hook{Name: "chat", URL: rcv.URL, Secret: "s3cr3t"}))
+	d.Publish(Event{Event: EventCancelled, Pitch: testPitch})
+	deliveries := wait(t, d, 1)
+	time.Sleep(20 * time.Millisecond)
+	if deliveries, _ = d.Deliveries("", "", 0); len(deliveries) != 1 || deliveries[0].Status != 400 || len(deliveries[0].Error) == 0 {
+		t.Errorf("deliveries %+v, want one failed", deliveries)
+	}
+}
+
+func TestDeliveryRetriesExhausted(t *testing.T) {
+	rcv := newReceiver(t, "s3cr3t", 500, 500, 500, 500, 500)
+	d := run(t, testHook(t, Hook{Name: "chat", URL: rcv.URL, Secret: "s3cr3t", Retries: 2}))
+	d.Publish(Event{Event: EventStarting, Pitch: testPitch})
+	wait(t, d, 3)
+	time.Sleep(20 * time.Millisecond)
+	if deliveries, _ := d.Deliveries("chat", EventStarting, 0); len(deliveries) != 3 || deliveries[2].Status != 500 {
+		t.Errorf("deliveries %+v, want 3 failed attempts", deliveries)
+	}
+}
+
+func TestDeliveryNotReached(t *testing.T) {
+	rcv := newReceiver(t, "s3cr3t")
+	rcv.Close()
+	h := testHook(t, Hook{Name: "chat", URL: strings.Replace(rcv.URL, "http://", "http://user:pw@", 1) + "/hooks/T0001?token=abc", Secret: "s3cr3t", Retries: 1})
+	d := run(t, h)
+	d.Publish(Event{Event: EventReleased, Pitch: testPitch})
+	for _, delivery := range wait(t, d, 2) {
+		if len(delivery.Error) == 0 || delivery.Status != 0 {
+			t.Errorf("delivery %+v, want failed", delivery)
+		}
+		for _, secret := range []string{"pw", "T0001", "abc"} {
+			if strings.Contains(delivery.Error, secret) {
+				t.Errorf("%q in error %s", secret, delivery.Error)
+			}
+		}
+	}
+}
+
+func TestSubscribed(t *testing.T) {
+	rcv := newReceiver(t, "s3cr3t")
+	chat := testHook(t, Hook{Name: "chat", URL: rcv.URL, Secret: "s3cr3t", Events: []string{EventStarting},
+		Template: `{"text": {{json (printf "%s talks about %s" .Pitch.Speaker .Pitch.Title)}}}`})
+	archive := testHook(t, Hook{Name: "archive", URL: rcv.URL, Secret: "s3cr3t"})
+	d := run(t, chat, archive)
+	d.Publish(Event{Event: EventScheduled, Pitch: testPitch})
+	d.Publish(Event{Event: EventStarting, Pitch: testPitch})
+	wait(t, d, 3)
+	time.Sleep(20 * time.Millisecond)
+	if deliveries, _ := d.Deliveries("chat", "", 0); len(deliveries) != 1 || deliveries[0].Event != EventStarting {
+		t.Errorf("deliveries of chat %+v, want starting only", deliveries)
+	}
+	if deliveries, _ := d.Deliveries("archive", "", 0); len(deliveries) != 2 {
+		t.Errorf("deliveries of archive %+v, want all", deliveries)
+	}
+	if deliveries, _ := d.Deliveries("", "", 1); len(deliveries) != 1 {
+		t.Errorf("deliveries %+v, want the last one", deliveries)
+	}
+	rcv.mutex.Lock()
+	defer rcv.mutex.Unlock()
+	found := false
+	for _, body := range rcv.bodies {
+		found = found || body == `{"text": "Marc talks about Buzzer"}`
+	}
+	if !found {
+		t.Errorf("payload of the template missing: %q", rcv.bodies)
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	var (
+		mutex         sync.Mutex
+		running, peak int
+		release       = make(chan struct{})
+		received      = make(chan struct{}, 10)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		if running++; running > peak {
+			peak = running
+		}
+		mutex.Unlock()
+		received <- struct{}{}
+		<-release
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+	}))
+	defer srv.Close()
+	d := New([]*Hook{testHook(t, Hook{Name: "slow", URL: srv.URL, Secret: "s3cr3t"})}, filepath.Join(t.TempDir(), "webhooks.log"), slog.New(slog.NewTextHandler(io.Discard, nil)))
+	d.workers = 2
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	for i := 0; i < 10; i++ {
+		d.Publish(Event{Event: EventScheduled, Pitch: testPitch})
+	}
+	// two deliveries are blocked, the others are queued
+	<-received
+	<-received
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wait(t, d, 10)
+	cancel()
+	<-done
+	if peak != 2 {
+		t.Errorf("%d concurrent deliveries, want 2", peak)
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	h := testHook(t, Hook{Name: "chat", URL: "https://user:pw@chat.example.com/hooks/T0001?token=abc", Secret: "s3cr3t", Headers: map[string]string{"Authorization": "Bearer abc"}})
+	r := h.Redacted()
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"pw", "T0001", "abc", "s3cr3t"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("%q in %s", secret, data)
+		}
+	}
+	if r.URL != "https://chat.example.com/xxxxx" || r.Headers["Authorization"] != redacted {
+		t.Errorf("redacted %+v", r)
+	}
+	if h.URL == r.URL || h.Headers["Authorization"] != "Bearer abc" {
+		t.Errorf("hook %+v changed", h)
+	}
+	if u := redactURL("https://chat.example.com"); u != "https://chat.example.com" {
+		t.Errorf("URL without credentials redacted: %s", u)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	for content, want := range map[string]string{
+		"- name: chat\n  url: https://chat.example.com\n  secret: s\n":                                                             "",
+		"- name: chat\n  url: ftp://chat.example.com\n  secret: s\n":                                                               "not an http(s) URL",
+		"- name: chat\n  url: https://chat.example.com\n":                                                                          "secret missing",
+		"- name: chat\n  url: https://chat.example.com\n  secret: s\n  events: [started]\n":                                        "no such event",
+		"- name: chat\n  url: https://chat.example.com\n  secret: s\n  template: '{{'\n":                                           "hook chat",
+		"- name: chat\n  url: https://chat.example.com\n  secret: s\n- name: chat\n  url: https://chat.example.com\n  secret: s\n": "defined twice",
+	} {
+		path := filepath.Join(t.TempDir(), "webhooks.yaml")
+		if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		hooks, err := Load(path)
+		switch {
+		case len(want) == 0 && (err != nil || len(hooks) != 1 || hooks[0].Retries != DefaultRetries):
+			t.Errorf("%q: %v", content, err)
+		case len(want) > 0 && (err == nil || !strings.Contains(err.Error(), want)):
+			t.Errorf("%q: %v, want %q", content, err, want)
+		}
+	}
+}